@@ -0,0 +1,146 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// AbstentionCost trains a classifier which may abstain
+// from predicting on hard examples, in the spirit of the
+// deep abstaining classifier of Thulasidasan et al.
+// (2019).
+//
+// For an expected vector of length n, the actual vector
+// has length n+1 and contains n class logits followed by
+// a logit for abstaining.
+// The abstention probability p is the last component of
+// the softmax of the actual vector.
+//
+// The cost is the expected cost of the model's choice,
+//
+//	p*RejectionCost + (1-p)*L
+//
+// where L is CostFunc's cost of the n class logits.
+// Thus, the model abstains when L exceeds RejectionCost,
+// and larger values of RejectionCost discourage
+// abstention.
+type AbstentionCost struct {
+	RejectionCost float64
+	CostFunc      CostFunc
+}
+
+func (c AbstentionCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	n := len(x)
+	if len(a.Output()) != n+1 {
+		panic("actual vector must have one more entry than the expected vector")
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		probs := (&autofunc.Softmax{}).Apply(a)
+		pAbstain := autofunc.Slice(probs, n, n+1)
+		pPredict := autofunc.AddScaler(autofunc.Scale(pAbstain, -1), 1)
+		classCost := c.CostFunc.Cost(x, autofunc.Slice(a, 0, n))
+		return autofunc.Add(autofunc.Scale(pAbstain, c.RejectionCost),
+			autofunc.Mul(pPredict, classCost))
+	})
+}
+
+func (c AbstentionCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n := len(x)
+	if len(a.Output()) != n+1 {
+		panic("actual vector must have one more entry than the expected vector")
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		probs := (&autofunc.Softmax{}).ApplyR(v, a)
+		pAbstain := autofunc.SliceR(probs, n, n+1)
+		pPredict := autofunc.AddScalerR(autofunc.ScaleR(pAbstain, -1), 1)
+		classCost := c.CostFunc.CostR(v, x, autofunc.SliceR(a, 0, n))
+		return autofunc.AddR(autofunc.ScaleR(pAbstain, c.RejectionCost),
+			autofunc.MulR(pPredict, classCost))
+	})
+}
+
+// LearningToDeferCost trains a classifier which may
+// defer its decision to an expert, using the consistent
+// surrogate loss of Mozannar and Sontag (2020).
+//
+// The expected vector has length n+1 and contains a
+// one-hot label for n classes followed by the expert's
+// cost on the sample, in [0, 1] (e.g. 1 if the expert
+// misclassifies the sample, and 0 otherwise).
+// The actual vector also has length n+1 and contains n
+// class logits followed by a logit for deferring.
+//
+// The expert's cost is deliberately part of the expected
+// vector rather than a field: it differs from sample to
+// sample, and a CostFunc only ever sees one sample's
+// expected vector, so a field could only hold a fixed
+// cost per class.
+//
+// The cost is
+//
+//	L - (1-e)*log(p)
+//
+// where L is CostFunc's cost of all n+1 logits against
+// the one-hot label (with a 0 for deferring), e is the
+// expert's cost, and p is the softmax probability of
+// deferring.
+// If CostFunc is nil, L is the softmax cross entropy, in
+// which case the cost is exactly the Mozannar-Sontag
+// surrogate.
+// A non-nil CostFunc is intentionally given the defer
+// logit too, since the surrogate treats deferring as an
+// extra class whose target is 0; CostFunc should thus
+// normalize over all n+1 logits, like a softmax.
+// Thus, the model learns to defer on samples which the
+// expert handles well and which it cannot classify
+// itself.
+type LearningToDeferCost struct {
+	CostFunc CostFunc
+}
+
+func (l LearningToDeferCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	target, deferWeight := l.target(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logProbs := (&LogSoftmaxLayer{}).Apply(a)
+		var classCost autofunc.Result
+		if l.CostFunc != nil {
+			classCost = l.CostFunc.Cost(target, a)
+		} else {
+			classCost = DotCost{}.Cost(target, logProbs)
+		}
+		logDefer := autofunc.Slice(logProbs, len(x)-1, len(x))
+		return autofunc.Add(classCost, autofunc.Scale(logDefer, -deferWeight))
+	})
+}
+
+func (l LearningToDeferCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	target, deferWeight := l.target(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		logProbs := (&LogSoftmaxLayer{}).ApplyR(v, a)
+		var classCost autofunc.RResult
+		if l.CostFunc != nil {
+			classCost = l.CostFunc.CostR(v, target, a)
+		} else {
+			classCost = DotCost{}.CostR(v, target, logProbs)
+		}
+		logDefer := autofunc.SliceR(logProbs, len(x)-1, len(x))
+		return autofunc.AddR(classCost, autofunc.ScaleR(logDefer, -deferWeight))
+	})
+}
+
+// target returns the label padded with a 0 for
+// deferring, and the weight 1-e of the deferral term.
+func (l LearningToDeferCost) target(x, a linalg.Vector) (linalg.Vector, float64) {
+	if len(x) < 2 || len(a) != len(x) {
+		panic("expected and actual vectors must have n+1 entries")
+	}
+	expertCost := x[len(x)-1]
+	if expertCost < 0 || expertCost > 1 {
+		panic("expert cost must be in [0, 1]")
+	}
+	target := x.Copy()
+	target[len(x)-1] = 0
+	return target, 1 - expertCost
+}
@@ -0,0 +1,81 @@
+package neuralnet
+
+import (
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestAbstentionCostGradient(t *testing.T) {
+	cost := AbstentionCost{RejectionCost: 0.7, CostFunc: softmaxCETestCost{}}
+	checkCostFuncGradients(t, cost, linalg.Vector{0, 1, 0}, linalg.Vector{0.5, -0.3, 1, 0.2})
+}
+
+func TestAbstentionCostRejection(t *testing.T) {
+	// The classifier is unsure, so its cross entropy is
+	// about log(3), which is roughly 1.1.
+	expected := linalg.Vector{0, 1, 0}
+	abstainGrad := func(rejection float64) float64 {
+		actual := &autofunc.Variable{Vector: linalg.Vector{0, 0, 0, 0}}
+		cost := AbstentionCost{RejectionCost: rejection, CostFunc: softmaxCETestCost{}}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+		return grad[actual][3]
+	}
+	if g := abstainGrad(0.5); g >= 0 {
+		t.Errorf("cheap rejection should encourage abstaining, got gradient %f", g)
+	}
+	if g := abstainGrad(3); g <= 0 {
+		t.Errorf("expensive rejection should discourage abstaining, got gradient %f", g)
+	}
+}
+
+func TestLearningToDeferCostGradient(t *testing.T) {
+	cost := LearningToDeferCost{}
+	checkCostFuncGradients(t, cost, linalg.Vector{0, 1, 0, 0.9}, linalg.Vector{0.5, -0.3, 1, 0.2})
+	cost.CostFunc = softmaxCETestCost{}
+	checkCostFuncGradients(t, cost, linalg.Vector{1, 0, 0, 0.2}, linalg.Vector{0.5, -0.3, 1, 0.2})
+}
+
+func TestLearningToDeferCostTraining(t *testing.T) {
+	cost := LearningToDeferCost{}
+
+	// Both ambiguous samples are trained on conflicting
+	// labels, so the model cannot classify them itself.
+	// The expert is perfect on the first one and always
+	// wrong on the second, even though their labels are
+	// the same.
+	goodExpert := &autofunc.Variable{Vector: make(linalg.Vector, 4)}
+	goodExpertLabels := []linalg.Vector{{1, 0, 0, 0}, {0, 1, 0, 0}}
+	badExpert := &autofunc.Variable{Vector: make(linalg.Vector, 4)}
+	badExpertLabels := []linalg.Vector{{1, 0, 0, 1}, {0, 1, 0, 1}}
+
+	// The model can classify this sample, and the expert
+	// cannot.
+	easy := &autofunc.Variable{Vector: make(linalg.Vector, 4)}
+	easyLabel := linalg.Vector{0, 0, 1, 1}
+
+	for i := 0; i < 200; i++ {
+		vars := []*autofunc.Variable{goodExpert, badExpert, easy}
+		grad := autofunc.NewGradient(vars)
+		for j := range goodExpertLabels {
+			cost.Cost(goodExpertLabels[j], goodExpert).PropagateGradient(linalg.Vector{1}, grad)
+			cost.Cost(badExpertLabels[j], badExpert).PropagateGradient(linalg.Vector{1}, grad)
+		}
+		cost.Cost(easyLabel, easy).PropagateGradient(linalg.Vector{1}, grad)
+		for _, v := range vars {
+			v.Vector.Add(grad[v].Scale(-0.1))
+		}
+	}
+
+	if idx := maxIndex(goodExpert.Vector); idx != 3 {
+		t.Errorf("expected to defer to a good expert, got logits %v", goodExpert.Vector)
+	}
+	if idx := maxIndex(badExpert.Vector); idx == 3 {
+		t.Errorf("expected not to defer to a bad expert, got logits %v", badExpert.Vector)
+	}
+	if idx := maxIndex(easy.Vector); idx != 2 {
+		t.Errorf("expected to predict class 2 on easy sample, got logits %v", easy.Vector)
+	}
+}
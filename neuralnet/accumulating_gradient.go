@@ -0,0 +1,64 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// An AccumulatingGradient sums the gradients of several
+// micro-batches so that a single optimizer step can use
+// their average, simulating a larger batch size without
+// the memory cost of evaluating it at once.
+type AccumulatingGradient struct {
+	sum   autofunc.Gradient
+	count int
+}
+
+// NewAccumulatingGradient creates an AccumulatingGradient
+// for the given variables.
+func NewAccumulatingGradient(vars []*autofunc.Variable) *AccumulatingGradient {
+	return &AccumulatingGradient{sum: autofunc.NewGradient(vars)}
+}
+
+// Add adds the gradient of one micro-batch.
+// The gradient must be for the same variables that were
+// passed to NewAccumulatingGradient.
+func (a *AccumulatingGradient) Add(g autofunc.Gradient) {
+	a.sum.Add(g)
+	a.count++
+}
+
+// Propagate back-propagates the gradient of a cost (such
+// as the output of a CostFunc) directly into the
+// accumulated sum, counting it as one micro-batch.
+func (a *AccumulatingGradient) Propagate(cost autofunc.Result) {
+	upstream := make(linalg.Vector, len(cost.Output()))
+	for i := range upstream {
+		upstream[i] = 1
+	}
+	cost.PropagateGradient(upstream, a.sum)
+	a.count++
+}
+
+// Count returns the number of micro-batches which have
+// been accumulated since the last reset.
+func (a *AccumulatingGradient) Count() int {
+	return a.count
+}
+
+// Gradient returns the average of the accumulated
+// micro-batch gradients.
+// The result is a copy, so it can be modified freely.
+func (a *AccumulatingGradient) Gradient() autofunc.Gradient {
+	res := a.sum.Copy()
+	if a.count > 0 {
+		res.Scale(1 / float64(a.count))
+	}
+	return res
+}
+
+// Reset clears the accumulated gradients.
+func (a *AccumulatingGradient) Reset() {
+	a.sum.Zero()
+	a.count = 0
+}
@@ -0,0 +1,52 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestAccumulatingGradient(t *testing.T) {
+	param := &autofunc.Variable{Vector: linalg.Vector{0.5, -1}}
+	targets := []linalg.Vector{{1, 2}, {0, 1}, {-1, 3}, {2, -2}}
+	batchCost := func(batch []linalg.Vector) autofunc.Result {
+		var costs []autofunc.Result
+		for _, target := range batch {
+			costs = append(costs, MeanSquaredCost{}.Cost(target, param))
+		}
+		return autofunc.Scale(autofunc.SumAll(autofunc.Concat(costs...)),
+			1/float64(len(batch)))
+	}
+
+	vars := []*autofunc.Variable{param}
+	fullGrad := autofunc.NewGradient(vars)
+	batchCost(targets).PropagateGradient(linalg.Vector{1}, fullGrad)
+
+	acc := NewAccumulatingGradient(vars)
+	acc.Propagate(batchCost(targets[:2]))
+	microGrad := autofunc.NewGradient(vars)
+	batchCost(targets[2:]).PropagateGradient(linalg.Vector{1}, microGrad)
+	acc.Add(microGrad)
+
+	if acc.Count() != 2 {
+		t.Errorf("expected count 2 but got %d", acc.Count())
+	}
+	accGrad := acc.Gradient()
+	for i, x := range fullGrad[param] {
+		if math.Abs(accGrad[param][i]-x) > 1e-10 {
+			t.Errorf("gradient %d: expected %f but got %f", i, x, accGrad[param][i])
+		}
+	}
+
+	acc.Reset()
+	if acc.Count() != 0 {
+		t.Errorf("expected count 0 after reset but got %d", acc.Count())
+	}
+	for i, x := range acc.Gradient()[param] {
+		if x != 0 {
+			t.Errorf("gradient %d should be 0 after reset but got %f", i, x)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// BrierScoreCost computes the multi-class Brier score,
+// i.e. the sum of the squared differences between the
+// predicted class probabilities and a one-hot target.
+//
+// The actual vector should already be a probability
+// distribution (e.g. the output of a SoftmaxLayer).
+// The Brier score is a proper scoring rule, so it is
+// minimized by calibrated probabilities.
+// Unlike cross entropy, it is bounded between 0 and 2,
+// which limits the influence of mislabeled samples.
+type BrierScoreCost struct{}
+
+func (_ BrierScoreCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return MeanSquaredCost{}.Cost(x, a)
+}
+
+func (_ BrierScoreCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return MeanSquaredCost{}.CostR(v, x, a)
+}
+
+// LogLossCost computes the clipped log loss used by
+// scikit-learn's log_loss, -sum(x*log(a)).
+//
+// The actual vector contains predicted probabilities,
+// which are clamped to [Eps, 1-Eps] before taking logs
+// so that degenerate predictions give a finite cost.
+// Clamped probabilities receive no gradient.
+// If Eps is 0, no clamping is performed.
+type LogLossCost struct {
+	Eps float64
+}
+
+func (l LogLossCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if l.Eps != 0 {
+		a = clamp(a, l.Eps, 1-l.Eps)
+	}
+	return DotCost{}.Cost(x, autofunc.Log{}.Apply(a))
+}
+
+func (l LogLossCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if l.Eps != 0 {
+		a = clampR(v, a, l.Eps, 1-l.Eps)
+	}
+	return DotCost{}.CostR(v, x, autofunc.Log{}.ApplyR(v, a))
+}
+
+const (
+	minFitTemperature   = 0.01
+	maxFitTemperature   = 100.0
+	temperatureFitIters = 100
+)
+
+// FitTemperature fits a temperature for post-hoc
+// calibration of a classifier, as in Guo et al. (2017).
+//
+// The layer should output logits, and the elements of s
+// must be VectorSamples with one-hot (or soft) targets.
+// The returned temperature minimizes the negative
+// log-likelihood of softmax(logits/T) on s, and logits
+// should be divided by it at inference time.
+//
+// The NLL is convex in 1/T, so the search is a golden
+// section search over 1/T.
+func FitTemperature(layer autofunc.Func, s sgd.SampleSet) float64 {
+	logits := make([]linalg.Vector, s.Len())
+	targets := make([]linalg.Vector, s.Len())
+	for i := range logits {
+		vs := s.GetSample(i).(VectorSample)
+		logits[i] = layer.Apply(&autofunc.Variable{Vector: vs.Input}).Output()
+		targets[i] = vs.Output
+	}
+	nll := func(invTemp float64) float64 {
+		var total float64
+		for i, l := range logits {
+			scaled := &autofunc.Variable{Vector: l.Copy().Scale(invTemp)}
+			logProbs := (&LogSoftmaxLayer{}).Apply(scaled)
+			total += DotCost{}.Cost(targets[i], logProbs).Output()[0]
+		}
+		return total
+	}
+
+	ratio := (math.Sqrt(5) - 1) / 2
+	lo, hi := 1/maxFitTemperature, 1/minFitTemperature
+	mid1 := hi - ratio*(hi-lo)
+	mid2 := lo + ratio*(hi-lo)
+	cost1, cost2 := nll(mid1), nll(mid2)
+	for i := 0; i < temperatureFitIters; i++ {
+		if cost1 < cost2 {
+			hi, mid2, cost2 = mid2, mid1, cost1
+			mid1 = hi - ratio*(hi-lo)
+			cost1 = nll(mid1)
+		} else {
+			lo, mid1, cost1 = mid1, mid2, cost2
+			mid2 = lo + ratio*(hi-lo)
+			cost2 = nll(mid2)
+		}
+	}
+	return 2 / (lo + hi)
+}
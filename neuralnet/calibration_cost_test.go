@@ -0,0 +1,79 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestBrierScoreCostBounds(t *testing.T) {
+	expected := linalg.Vector{0, 1, 0}
+	perfect := &autofunc.Variable{Vector: linalg.Vector{0, 1, 0}}
+	if cost := (BrierScoreCost{}).Cost(expected, perfect).Output()[0]; cost != 0 {
+		t.Errorf("perfect prediction: expected 0 but got %f", cost)
+	}
+	wrong := &autofunc.Variable{Vector: linalg.Vector{0, 0, 1}}
+	if cost := (BrierScoreCost{}).Cost(expected, wrong).Output()[0]; math.Abs(cost-2) > 1e-8 {
+		t.Errorf("wrong prediction: expected 2 but got %f", cost)
+	}
+}
+
+func TestBrierScoreCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, BrierScoreCost{}, linalg.Vector{0, 1, 0},
+		linalg.Vector{0.2, 0.5, 0.3})
+}
+
+func TestLogLossCostClamping(t *testing.T) {
+	expected := linalg.Vector{0, 1}
+	degenerate := &autofunc.Variable{Vector: linalg.Vector{1, 0}}
+
+	cost := LogLossCost{Eps: 1e-15}.Cost(expected, degenerate).Output()[0]
+	if math.IsInf(cost, 0) || math.IsNaN(cost) {
+		t.Fatalf("clamped cost should be finite but got %f", cost)
+	}
+	if math.Abs(cost+math.Log(1e-15)) > 1e-8 {
+		t.Errorf("expected %f but got %f", -math.Log(1e-15), cost)
+	}
+
+	cost = LogLossCost{}.Cost(expected, degenerate).Output()[0]
+	if !math.IsInf(cost, 1) {
+		t.Errorf("unclamped cost should be infinite but got %f", cost)
+	}
+}
+
+func TestLogLossCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, LogLossCost{Eps: 0.05}, linalg.Vector{0.3, 0.7},
+		linalg.Vector{0.4, 0.6})
+}
+
+func TestFitTemperature(t *testing.T) {
+	// The true probability of the first class is about
+	// sigmoid(1), but the model's logits are scaled up by
+	// a factor of 4, making it overconfident.
+	var samples sgd.SliceSampleSet
+	for i := 0; i < 100; i++ {
+		target := linalg.Vector{0, 1}
+		if i < 73 {
+			target = linalg.Vector{1, 0}
+		}
+		samples = append(samples, VectorSample{Input: linalg.Vector{1, 0}, Output: target})
+	}
+	layer := &RescaleLayer{Scale: 4}
+
+	temp := FitTemperature(layer, samples)
+	if math.Abs(temp-4) > 0.1 {
+		t.Errorf("expected temperature near 4 but got %f", temp)
+	}
+
+	nll := func(temp float64) float64 {
+		logProb := -math.Log(1 + math.Exp(-4/temp))
+		logInvProb := -math.Log(1 + math.Exp(4/temp))
+		return -(73*logProb + 27*logInvProb)
+	}
+	if fitted, orig := nll(temp), nll(1); fitted >= orig {
+		t.Errorf("fitted NLL %f should be lower than original NLL %f", fitted, orig)
+	}
+}
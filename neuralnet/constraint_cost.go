@@ -0,0 +1,72 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// MonotonicityCost softly constrains a model to be
+// non-decreasing in some input feature.
+//
+// The actual vector contains the predictions for n pairs
+// of inputs which differ only in the feature, packed as
+// [low1, ..., lowN, high1, ..., highN], where highI is the
+// prediction for the input with the larger feature value.
+// Each pair adds a penalty of
+//
+//	Penalty * max(0, lowI - highI)^2
+//
+// so that monotonic predictions are not penalized.
+//
+// If the expected vector is non-empty, it must contain a
+// target for every prediction, and CostFunc's cost of the
+// predictions is added to the penalty.
+// To constrain a model to be non-increasing, swap the
+// order of the pairs.
+type MonotonicityCost struct {
+	Penalty  float64
+	CostFunc CostFunc
+}
+
+func (m MonotonicityCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	n := m.numPairs(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		low := autofunc.Slice(a, 0, n)
+		high := autofunc.Slice(a, n, 2*n)
+		diff := autofunc.Add(low, autofunc.Scale(high, -1))
+		mask := &autofunc.Variable{Vector: positiveMask(diff.Output())}
+		violations := autofunc.SumAll(autofunc.Square(autofunc.Mul(mask, diff)))
+		penalty := autofunc.Scale(violations, m.Penalty)
+		if len(x) == 0 {
+			return penalty
+		}
+		return autofunc.Add(m.CostFunc.Cost(x, a), penalty)
+	})
+}
+
+func (m MonotonicityCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n := m.numPairs(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		low := autofunc.SliceR(a, 0, n)
+		high := autofunc.SliceR(a, n, 2*n)
+		diff := autofunc.AddR(low, autofunc.ScaleR(high, -1))
+		mask := &autofunc.Variable{Vector: positiveMask(diff.Output())}
+		violations := autofunc.SumAllR(autofunc.SquareR(autofunc.MulR(autofunc.NewRVariable(mask, v), diff)))
+		penalty := autofunc.ScaleR(violations, m.Penalty)
+		if len(x) == 0 {
+			return penalty
+		}
+		return autofunc.AddR(m.CostFunc.CostR(v, x, a), penalty)
+	})
+}
+
+func (m MonotonicityCost) numPairs(x, a linalg.Vector) int {
+	if len(a)%2 != 0 {
+		panic("actual vector must contain pairs of predictions")
+	}
+	if len(x) != 0 && len(x) != len(a) {
+		panic("expected vector must be empty or match actual size")
+	}
+	return len(a) / 2
+}
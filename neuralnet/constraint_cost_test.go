@@ -0,0 +1,32 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestMonotonicityCost(t *testing.T) {
+	cost := MonotonicityCost{Penalty: 2}
+
+	monotonic := &autofunc.Variable{Vector: linalg.Vector{0.1, 0.5, 0.3, 0.5, 0.9, 0.3}}
+	if c := cost.Cost(nil, monotonic).Output()[0]; c != 0 {
+		t.Errorf("monotonic predictions: expected 0 but got %f", c)
+	}
+
+	violating := &autofunc.Variable{Vector: linalg.Vector{0.1, 0.5, 0.3, 0.5, 0.2, 0}}
+	exp := 2 * (0.3*0.3 + 0.3*0.3)
+	if c := cost.Cost(nil, violating).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("violating predictions: expected %f but got %f", exp, c)
+	}
+
+	cost.CostFunc = MeanSquaredCost{}
+	expected := linalg.Vector{0, 1, 0, 1, 0, 1}
+	exp += MeanSquaredCost{}.Cost(expected, violating).Output()[0]
+	if c := cost.Cost(expected, violating).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("with CostFunc: expected %f but got %f", exp, c)
+	}
+	checkCostFuncGradients(t, cost, expected, violating.Vector)
+}
@@ -0,0 +1,747 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// InfoNCECost implements the InfoNCE contrastive loss.
+//
+// The actual vector contains similarity scores between
+// an anchor and several candidates, where the first
+// score is for the positive candidate and the remaining
+// scores are for negatives.
+// The cost is the cross entropy of a softmax over the
+// scores divided by Temperature, with the positive as
+// the correct class.
+// The expected vector is ignored.
+type InfoNCECost struct {
+	Temperature float64
+}
+
+func (i InfoNCECost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	scaled := autofunc.Scale(a, 1/i.Temperature)
+	return CategoricalNLLCost{}.Cost(linalg.Vector{0}, scaled)
+}
+
+func (i InfoNCECost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	scaled := autofunc.ScaleR(a, 1/i.Temperature)
+	return CategoricalNLLCost{}.CostR(v, linalg.Vector{0}, scaled)
+}
+
+// NTXentCost implements the normalized temperature-scaled
+// cross entropy loss used by SimCLR.
+//
+// The actual vector contains 2N embeddings of Dim
+// components each, which should already be normalized to
+// unit length.
+// The first N embeddings are the first augmented view of
+// each of N inputs, and the last N embeddings are the
+// second view of the same inputs, in the same order.
+// Thus, embedding i and embedding i+N form a positive
+// pair, and every other embedding is a negative.
+//
+// The cost is the InfoNCE loss of each embedding against
+// the rest of the batch (excluding itself), averaged over
+// all 2N embeddings.
+// The expected vector is ignored.
+type NTXentCost struct {
+	Temperature float64
+	Dim         int
+}
+
+func (n NTXentCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	count := n.embeddingCount(a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		embeddings := autofunc.Split(count, a)
+		losses := make([]autofunc.Result, count)
+		for i, emb := range embeddings {
+			pair := (i + count/2) % count
+			sims := []autofunc.Result{dotProduct(emb, embeddings[pair])}
+			for j, other := range embeddings {
+				if j != i && j != pair {
+					sims = append(sims, dotProduct(emb, other))
+				}
+			}
+			losses[i] = InfoNCECost{Temperature: n.Temperature}.Cost(nil,
+				autofunc.Concat(sims...))
+		}
+		return autofunc.Scale(autofunc.SumAll(autofunc.Concat(losses...)), 1/float64(count))
+	})
+}
+
+func (n NTXentCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	count := n.embeddingCount(a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		embeddings := autofunc.SplitR(count, a)
+		losses := make([]autofunc.RResult, count)
+		for i, emb := range embeddings {
+			pair := (i + count/2) % count
+			sims := []autofunc.RResult{dotProductR(emb, embeddings[pair])}
+			for j, other := range embeddings {
+				if j != i && j != pair {
+					sims = append(sims, dotProductR(emb, other))
+				}
+			}
+			losses[i] = InfoNCECost{Temperature: n.Temperature}.CostR(v, nil,
+				autofunc.ConcatR(sims...))
+		}
+		return autofunc.ScaleR(autofunc.SumAllR(autofunc.ConcatR(losses...)),
+			1/float64(count))
+	})
+}
+
+func (n NTXentCost) embeddingCount(a linalg.Vector) int {
+	if n.Dim <= 0 || len(a)%(n.Dim*2) != 0 {
+		panic("actual vector must contain an even number of embeddings")
+	}
+	return len(a) / n.Dim
+}
+
+func dotProduct(a, b autofunc.Result) autofunc.Result {
+	return autofunc.SumAll(autofunc.Mul(a, b))
+}
+
+func dotProductR(a, b autofunc.RResult) autofunc.RResult {
+	return autofunc.SumAllR(autofunc.MulR(a, b))
+}
+
+// BarlowTwinsCost implements the redundancy reduction
+// loss from Zbontar et al. (2021).
+//
+// The actual vector contains 2N embeddings of Dim
+// components each.
+// The first N embeddings are the first augmented view of
+// each of N inputs, and the last N embeddings are the
+// second view of the same inputs, in the same order.
+//
+// Each embedding component is standardized across the
+// batch, and the cross-correlation matrix C between the
+// two views is computed.
+// The cost is sum((1-C_ii)^2) + Lambda*sum(C_ij^2) for
+// j != i.
+// The expected vector is ignored.
+type BarlowTwinsCost struct {
+	Lambda float64
+	Dim    int
+}
+
+func (b BarlowTwinsCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	count := b.batchSize(a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		colsA := embeddingColumns(autofunc.Slice(a, 0, count*b.Dim), b.Dim)
+		colsB := embeddingColumns(autofunc.Slice(a, count*b.Dim, count*b.Dim*2), b.Dim)
+		for i := range colsA {
+			colsA[i] = standardize(colsA[i])
+			colsB[i] = standardize(colsB[i])
+		}
+		var diagTerms, offDiagTerms []autofunc.Result
+		for i, colA := range colsA {
+			for j, colB := range colsB {
+				corr := autofunc.Scale(dotProduct(colA, colB), 1/float64(count))
+				if i == j {
+					diagTerms = append(diagTerms, autofunc.AddScaler(corr, -1))
+				} else {
+					offDiagTerms = append(offDiagTerms, corr)
+				}
+			}
+		}
+		cost := autofunc.SquaredNorm{}.Apply(autofunc.Concat(diagTerms...))
+		if len(offDiagTerms) > 0 {
+			offDiag := autofunc.SquaredNorm{}.Apply(autofunc.Concat(offDiagTerms...))
+			cost = autofunc.Add(cost, autofunc.Scale(offDiag, b.Lambda))
+		}
+		return cost
+	})
+}
+
+func (b BarlowTwinsCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	count := b.batchSize(a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		colsA := embeddingColumnsR(autofunc.SliceR(a, 0, count*b.Dim), b.Dim)
+		colsB := embeddingColumnsR(autofunc.SliceR(a, count*b.Dim, count*b.Dim*2), b.Dim)
+		for i := range colsA {
+			colsA[i] = standardizeR(v, colsA[i])
+			colsB[i] = standardizeR(v, colsB[i])
+		}
+		var diagTerms, offDiagTerms []autofunc.RResult
+		for i, colA := range colsA {
+			for j, colB := range colsB {
+				corr := autofunc.ScaleR(dotProductR(colA, colB), 1/float64(count))
+				if i == j {
+					diagTerms = append(diagTerms, autofunc.AddScalerR(corr, -1))
+				} else {
+					offDiagTerms = append(offDiagTerms, corr)
+				}
+			}
+		}
+		cost := autofunc.SquaredNorm{}.ApplyR(v, autofunc.ConcatR(diagTerms...))
+		if len(offDiagTerms) > 0 {
+			offDiag := autofunc.SquaredNorm{}.ApplyR(v, autofunc.ConcatR(offDiagTerms...))
+			cost = autofunc.AddR(cost, autofunc.ScaleR(offDiag, b.Lambda))
+		}
+		return cost
+	})
+}
+
+func (b BarlowTwinsCost) batchSize(a linalg.Vector) int {
+	if b.Dim <= 0 || len(a)%(b.Dim*2) != 0 {
+		panic("actual vector must contain two equal batches of embeddings")
+	}
+	return len(a) / (b.Dim * 2)
+}
+
+// standardizeEpsilon is added to variances before they
+// are used as divisors.
+const standardizeEpsilon = 1e-8
+
+// embeddingColumns splits a batch of concatenated
+// embeddings into one Result per embedding component,
+// each containing that component for every embedding.
+func embeddingColumns(batch autofunc.Result, dim int) []autofunc.Result {
+	count := len(batch.Output()) / dim
+	cols := make([]autofunc.Result, dim)
+	for i := range cols {
+		entries := make([]autofunc.Result, count)
+		for j := range entries {
+			entries[j] = autofunc.Slice(batch, j*dim+i, j*dim+i+1)
+		}
+		cols[i] = autofunc.Concat(entries...)
+	}
+	return cols
+}
+
+func embeddingColumnsR(batch autofunc.RResult, dim int) []autofunc.RResult {
+	count := len(batch.Output()) / dim
+	cols := make([]autofunc.RResult, dim)
+	for i := range cols {
+		entries := make([]autofunc.RResult, count)
+		for j := range entries {
+			entries[j] = autofunc.SliceR(batch, j*dim+i, j*dim+i+1)
+		}
+		cols[i] = autofunc.ConcatR(entries...)
+	}
+	return cols
+}
+
+// standardize shifts and scales a vector so that its
+// entries have zero mean and unit variance.
+func standardize(vec autofunc.Result) autofunc.Result {
+	return autofunc.Pool(vec, func(vec autofunc.Result) autofunc.Result {
+		n := float64(len(vec.Output()))
+		mean := autofunc.Scale(autofunc.SumAll(vec), 1/n)
+		centered := autofunc.AddFirst(vec, autofunc.Scale(mean, -1))
+		variance := autofunc.Scale(autofunc.SquaredNorm{}.Apply(centered), 1/n)
+		logVar := autofunc.Log{}.Apply(autofunc.AddScaler(variance, standardizeEpsilon))
+		invStd := autofunc.Exp{}.Apply(autofunc.Scale(logVar, -0.5))
+		return autofunc.ScaleFirst(centered, invStd)
+	})
+}
+
+func standardizeR(v autofunc.RVector, vec autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(vec, func(vec autofunc.RResult) autofunc.RResult {
+		n := float64(len(vec.Output()))
+		mean := autofunc.ScaleR(autofunc.SumAllR(vec), 1/n)
+		centered := autofunc.AddFirstR(vec, autofunc.ScaleR(mean, -1))
+		variance := autofunc.ScaleR(autofunc.SquaredNorm{}.ApplyR(v, centered), 1/n)
+		logVar := autofunc.Log{}.ApplyR(v, autofunc.AddScalerR(variance, standardizeEpsilon))
+		invStd := autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(logVar, -0.5))
+		return autofunc.ScaleFirstR(centered, invStd)
+	})
+}
+
+// VICRegCost implements the variance-invariance-covariance
+// regularization loss from Bardes et al. (2022).
+//
+// The actual vector contains 2N embeddings of Dim
+// components each, laid out like for BarlowTwinsCost:
+// N first views followed by N second views.
+//
+// The cost is a weighted sum of three terms.
+// The invariance term, weighted by SimCoeff, is the mean
+// squared difference between the two views.
+// The variance term, weighted by VarCoeff, is a hinge
+// loss which keeps the standard deviation of every
+// component above 1, averaged over the components.
+// The covariance term, weighted by CovCoeff, is the sum
+// of the squared off-diagonal covariances divided by Dim.
+// The variance and covariance terms are summed over both
+// views.
+// The expected vector is ignored.
+type VICRegCost struct {
+	SimCoeff float64
+	VarCoeff float64
+	CovCoeff float64
+	Dim      int
+}
+
+func (c VICRegCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	count := c.batchSize(a.Output())
+	size := count * c.Dim
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		viewA := autofunc.Slice(a, 0, size)
+		viewB := autofunc.Slice(a, size, size*2)
+		diff := autofunc.Add(viewA, autofunc.Scale(viewB, -1))
+		sim := autofunc.Scale(autofunc.SquaredNorm{}.Apply(diff), c.SimCoeff/float64(size))
+
+		var variance, covariance autofunc.Result
+		for _, view := range []autofunc.Result{viewA, viewB} {
+			v, cov := c.viewTerms(view)
+			if variance == nil {
+				variance, covariance = v, cov
+			} else {
+				variance = autofunc.Add(variance, v)
+				covariance = autofunc.Add(covariance, cov)
+			}
+		}
+		return autofunc.Add(sim, autofunc.Add(autofunc.Scale(variance, c.VarCoeff),
+			autofunc.Scale(covariance, c.CovCoeff)))
+	})
+}
+
+func (c VICRegCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	count := c.batchSize(a.Output())
+	size := count * c.Dim
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		viewA := autofunc.SliceR(a, 0, size)
+		viewB := autofunc.SliceR(a, size, size*2)
+		diff := autofunc.AddR(viewA, autofunc.ScaleR(viewB, -1))
+		sim := autofunc.ScaleR(autofunc.SquaredNorm{}.ApplyR(v, diff),
+			c.SimCoeff/float64(size))
+
+		var variance, covariance autofunc.RResult
+		for _, view := range []autofunc.RResult{viewA, viewB} {
+			vr, cov := c.viewTermsR(v, view)
+			if variance == nil {
+				variance, covariance = vr, cov
+			} else {
+				variance = autofunc.AddR(variance, vr)
+				covariance = autofunc.AddR(covariance, cov)
+			}
+		}
+		return autofunc.AddR(sim, autofunc.AddR(autofunc.ScaleR(variance, c.VarCoeff),
+			autofunc.ScaleR(covariance, c.CovCoeff)))
+	})
+}
+
+// viewTerms computes the (unweighted) variance and
+// covariance terms for a batch of embeddings.
+func (c VICRegCost) viewTerms(view autofunc.Result) (variance, covariance autofunc.Result) {
+	cols := embeddingColumns(view, c.Dim)
+	count := float64(len(cols[0].Output()))
+	stds := make([]autofunc.Result, len(cols))
+	for i, col := range cols {
+		mean := autofunc.Scale(autofunc.SumAll(col), 1/count)
+		cols[i] = autofunc.AddFirst(col, autofunc.Scale(mean, -1))
+		colVar := autofunc.Scale(autofunc.SquaredNorm{}.Apply(cols[i]), 1/(count-1))
+		logVar := autofunc.Log{}.Apply(autofunc.AddScaler(colVar, vicRegEpsilon))
+		stds[i] = autofunc.Exp{}.Apply(autofunc.Scale(logVar, 0.5))
+	}
+	hinges := autofunc.AddScaler(autofunc.Scale(autofunc.Concat(stds...), -1), 1)
+	hingeMask := &autofunc.Variable{Vector: positiveMask(hinges.Output())}
+	variance = autofunc.Scale(autofunc.SumAll(autofunc.Mul(hingeMask, hinges)),
+		1/float64(c.Dim))
+
+	covs := []autofunc.Result{&autofunc.Variable{Vector: linalg.Vector{0}}}
+	for i, col1 := range cols {
+		for j, col2 := range cols {
+			if i != j {
+				covs = append(covs, autofunc.Scale(dotProduct(col1, col2), 1/(count-1)))
+			}
+		}
+	}
+	covariance = autofunc.Scale(autofunc.SquaredNorm{}.Apply(autofunc.Concat(covs...)),
+		1/float64(c.Dim))
+	return
+}
+
+func (c VICRegCost) viewTermsR(v autofunc.RVector,
+	view autofunc.RResult) (variance, covariance autofunc.RResult) {
+	cols := embeddingColumnsR(view, c.Dim)
+	count := float64(len(cols[0].Output()))
+	stds := make([]autofunc.RResult, len(cols))
+	for i, col := range cols {
+		mean := autofunc.ScaleR(autofunc.SumAllR(col), 1/count)
+		cols[i] = autofunc.AddFirstR(col, autofunc.ScaleR(mean, -1))
+		colVar := autofunc.ScaleR(autofunc.SquaredNorm{}.ApplyR(v, cols[i]), 1/(count-1))
+		logVar := autofunc.Log{}.ApplyR(v, autofunc.AddScalerR(colVar, vicRegEpsilon))
+		stds[i] = autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(logVar, 0.5))
+	}
+	hinges := autofunc.AddScalerR(autofunc.ScaleR(autofunc.ConcatR(stds...), -1), 1)
+	hingeMask := &autofunc.Variable{Vector: positiveMask(hinges.Output())}
+	variance = autofunc.ScaleR(autofunc.SumAllR(autofunc.MulR(
+		autofunc.NewRVariable(hingeMask, v), hinges)), 1/float64(c.Dim))
+
+	zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+	covs := []autofunc.RResult{autofunc.NewRVariable(zero, v)}
+	for i, col1 := range cols {
+		for j, col2 := range cols {
+			if i != j {
+				covs = append(covs, autofunc.ScaleR(dotProductR(col1, col2), 1/(count-1)))
+			}
+		}
+	}
+	covariance = autofunc.ScaleR(autofunc.SquaredNorm{}.ApplyR(v, autofunc.ConcatR(covs...)),
+		1/float64(c.Dim))
+	return
+}
+
+func (c VICRegCost) batchSize(a linalg.Vector) int {
+	if c.Dim <= 0 || len(a)%(c.Dim*2) != 0 || len(a) < c.Dim*4 {
+		panic("actual vector must contain two equal batches of at least two embeddings")
+	}
+	return len(a) / (c.Dim * 2)
+}
+
+// vicRegEpsilon is added to variances before computing
+// standard deviations, as in the original paper.
+const vicRegEpsilon = 1e-4
+
+// CosineSimilarityMatrix computes the cosine similarity
+// between every pair of embeddings.
+//
+// Embeddings with a magnitude of zero have a similarity
+// of zero with every embedding, including themselves.
+func CosineSimilarityMatrix(embeddings []linalg.Vector) [][]float64 {
+	normalized := make([]linalg.Vector, len(embeddings))
+	for i, emb := range embeddings {
+		normalized[i] = emb.Copy()
+		if mag := emb.Mag(); mag != 0 {
+			normalized[i].Scale(1 / mag)
+		}
+	}
+	res := make([][]float64, len(embeddings))
+	for i, emb1 := range normalized {
+		res[i] = make([]float64, len(embeddings))
+		for j, emb2 := range normalized {
+			res[i][j] = emb1.Dot(emb2)
+		}
+	}
+	return res
+}
+
+// CosineSimilarities is a differentiable version of
+// CosineSimilarityMatrix.
+//
+// The embeddings Result contains concatenated embeddings
+// of dim components each.
+// The result is the row-major similarity matrix.
+//
+// To avoid dividing by zero, a tiny constant is added to
+// each squared magnitude before normalizing.
+func CosineSimilarities(embeddings autofunc.Result, dim int) autofunc.Result {
+	return autofunc.Pool(embeddings, func(embeddings autofunc.Result) autofunc.Result {
+		count := len(embeddings.Output()) / dim
+		normalized := autofunc.Split(count, embeddings)
+		for i, emb := range normalized {
+			normalized[i] = normalizeEmbedding(emb)
+		}
+		return autofunc.PoolAll(normalized, func(normalized []autofunc.Result) autofunc.Result {
+			sims := make([]autofunc.Result, 0, count*count)
+			for _, emb1 := range normalized {
+				for _, emb2 := range normalized {
+					sims = append(sims, dotProduct(emb1, emb2))
+				}
+			}
+			return autofunc.Concat(sims...)
+		})
+	})
+}
+
+// CosineSimilaritiesR is like CosineSimilarities, but
+// for RResults.
+func CosineSimilaritiesR(v autofunc.RVector, embeddings autofunc.RResult,
+	dim int) autofunc.RResult {
+	return autofunc.PoolR(embeddings, func(embeddings autofunc.RResult) autofunc.RResult {
+		count := len(embeddings.Output()) / dim
+		normalized := autofunc.SplitR(count, embeddings)
+		for i, emb := range normalized {
+			normalized[i] = normalizeEmbeddingR(v, emb)
+		}
+		return autofunc.PoolAllR(normalized, func(normalized []autofunc.RResult) autofunc.RResult {
+			sims := make([]autofunc.RResult, 0, count*count)
+			for _, emb1 := range normalized {
+				for _, emb2 := range normalized {
+					sims = append(sims, dotProductR(emb1, emb2))
+				}
+			}
+			return autofunc.ConcatR(sims...)
+		})
+	})
+}
+
+// normalizeEpsilon is added to squared magnitudes before
+// they are used to normalize vectors.
+const normalizeEpsilon = 1e-24
+
+func normalizeEmbedding(emb autofunc.Result) autofunc.Result {
+	return autofunc.Pool(emb, func(emb autofunc.Result) autofunc.Result {
+		sqMag := autofunc.AddScaler(autofunc.SquaredNorm{}.Apply(emb), normalizeEpsilon)
+		invMag := autofunc.Exp{}.Apply(autofunc.Scale(autofunc.Log{}.Apply(sqMag), -0.5))
+		return autofunc.ScaleFirst(emb, invMag)
+	})
+}
+
+func normalizeEmbeddingR(v autofunc.RVector, emb autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(emb, func(emb autofunc.RResult) autofunc.RResult {
+		sqMag := autofunc.AddScalerR(autofunc.SquaredNorm{}.ApplyR(v, emb), normalizeEpsilon)
+		invMag := autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(autofunc.Log{}.ApplyR(v, sqMag), -0.5))
+		return autofunc.ScaleFirstR(emb, invMag)
+	})
+}
+
+// SupConCost implements the supervised contrastive loss
+// from Khosla et al. (2020).
+//
+// The actual vector contains a batch of concatenated
+// embeddings, and the expected vector contains an
+// integer class label for each embedding.
+// Embeddings are compared by cosine similarity, so they
+// need not be normalized beforehand.
+//
+// For each anchor, the cost is the average, over every
+// other embedding with the same label, of the cross
+// entropy of a softmax over the anchor's similarities
+// (divided by Temperature) to all other embeddings.
+// The result is averaged over anchors.
+// Anchors whose class has no other members in the batch
+// have no positives and are skipped.
+type SupConCost struct {
+	Temperature float64
+}
+
+func (s SupConCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	checkLabeledBatch(x, a.Output())
+	n := len(x)
+	sims := autofunc.Scale(CosineSimilarities(a, len(a.Output())/n), 1/s.Temperature)
+	return autofunc.Pool(sims, func(sims autofunc.Result) autofunc.Result {
+		var terms []autofunc.Result
+		for i, label := range x {
+			var others, positives []autofunc.Result
+			for j, label1 := range x {
+				if j == i {
+					continue
+				}
+				sim := autofunc.Slice(sims, i*n+j, i*n+j+1)
+				others = append(others, sim)
+				if label1 == label {
+					positives = append(positives, sim)
+				}
+			}
+			if len(positives) == 0 {
+				continue
+			}
+			logDenom := autofunc.SumAllLogDomain(autofunc.Concat(others...))
+			posMean := autofunc.Scale(autofunc.SumAll(autofunc.Concat(positives...)),
+				1/float64(len(positives)))
+			terms = append(terms, autofunc.Add(logDenom, autofunc.Scale(posMean, -1)))
+		}
+		if len(terms) == 0 {
+			return &autofunc.Variable{Vector: linalg.Vector{0}}
+		}
+		return autofunc.Scale(autofunc.SumAll(autofunc.Concat(terms...)),
+			1/float64(len(terms)))
+	})
+}
+
+func (s SupConCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	checkLabeledBatch(x, a.Output())
+	n := len(x)
+	sims := autofunc.ScaleR(CosineSimilaritiesR(v, a, len(a.Output())/n), 1/s.Temperature)
+	return autofunc.PoolR(sims, func(sims autofunc.RResult) autofunc.RResult {
+		var terms []autofunc.RResult
+		for i, label := range x {
+			var others, positives []autofunc.RResult
+			for j, label1 := range x {
+				if j == i {
+					continue
+				}
+				sim := autofunc.SliceR(sims, i*n+j, i*n+j+1)
+				others = append(others, sim)
+				if label1 == label {
+					positives = append(positives, sim)
+				}
+			}
+			if len(positives) == 0 {
+				continue
+			}
+			logDenom := autofunc.SumAllLogDomainR(autofunc.ConcatR(others...))
+			posMean := autofunc.ScaleR(autofunc.SumAllR(autofunc.ConcatR(positives...)),
+				1/float64(len(positives)))
+			terms = append(terms, autofunc.AddR(logDenom, autofunc.ScaleR(posMean, -1)))
+		}
+		if len(terms) == 0 {
+			return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+		}
+		return autofunc.ScaleR(autofunc.SumAllR(autofunc.ConcatR(terms...)),
+			1/float64(len(terms)))
+	})
+}
+
+// CPCCost implements the contrastive predictive coding
+// loss from van den Oord et al. (2018).
+//
+// The actual vector is divided into PredictionSteps
+// blocks, one per future time step k.
+// Each block contains, in order, the prediction of the
+// future latent made from the context (e.g. W_k*c_t),
+// the true future latent, and NumNegatives negative
+// latents, all of the same size.
+// The latent size is inferred from the vector length.
+//
+// Candidates are scored by their dot product with the
+// prediction, and the cost is the InfoNCE loss of the
+// true latent against the negatives, summed across
+// prediction steps.
+// The expected vector is ignored.
+type CPCCost struct {
+	NumNegatives    int
+	PredictionSteps int
+}
+
+func (c CPCCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	c.checkSize(a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		var costs []autofunc.Result
+		for _, block := range autofunc.Split(c.PredictionSteps, a) {
+			latents := autofunc.Split(c.NumNegatives+2, block)
+			var scores []autofunc.Result
+			for _, candidate := range latents[1:] {
+				scores = append(scores, dotProduct(latents[0], candidate))
+			}
+			costs = append(costs, InfoNCECost{Temperature: 1}.Cost(nil,
+				autofunc.Concat(scores...)))
+		}
+		return autofunc.SumAll(autofunc.Concat(costs...))
+	})
+}
+
+func (c CPCCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	c.checkSize(a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		var costs []autofunc.RResult
+		for _, block := range autofunc.SplitR(c.PredictionSteps, a) {
+			latents := autofunc.SplitR(c.NumNegatives+2, block)
+			var scores []autofunc.RResult
+			for _, candidate := range latents[1:] {
+				scores = append(scores, dotProductR(latents[0], candidate))
+			}
+			costs = append(costs, InfoNCECost{Temperature: 1}.CostR(v, nil,
+				autofunc.ConcatR(scores...)))
+		}
+		return autofunc.SumAllR(autofunc.ConcatR(costs...))
+	})
+}
+
+func (c CPCCost) checkSize(a linalg.Vector) {
+	latents := c.PredictionSteps * (c.NumNegatives + 2)
+	if latents <= 0 || len(a)%latents != 0 || len(a) == 0 {
+		panic("actual vector does not match the CPC layout")
+	}
+}
+
+// DensePixelContrastiveCost implements a pixel-level
+// contrastive loss for dense self-supervised learning,
+// as in PixPro and DenseCL.
+//
+// The actual vector contains the per-pixel features of
+// two views of an image, each of FeatureDim components,
+// with all N pixels of the first view followed by all M
+// pixels of the second view.
+// Features should already be normalized to unit length.
+//
+// The expected vector is the correspondence map, with
+// one entry for each pixel of the first view: the index
+// of the matching pixel in the second view, or -1 if it
+// has no match.
+// Each matched pixel has the InfoNCE loss of its match
+// against every other pixel of the second view, and the
+// cost is the average over matched pixels.
+// If no pixels are matched, the cost is 0.
+type DensePixelContrastiveCost struct {
+	Temperature float64
+	FeatureDim  int
+}
+
+func (d DensePixelContrastiveCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	n, m, matched := d.pixelCounts(x, a.Output())
+	if matched == 0 {
+		return &autofunc.Variable{Vector: linalg.Vector{0}}
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		pixels := autofunc.Split(n+m, a)
+		var losses []autofunc.Result
+		for i, match := range x {
+			if match < 0 {
+				continue
+			}
+			pos := n + int(match)
+			sims := []autofunc.Result{dotProduct(pixels[i], pixels[pos])}
+			for j := n; j < n+m; j++ {
+				if j != pos {
+					sims = append(sims, dotProduct(pixels[i], pixels[j]))
+				}
+			}
+			losses = append(losses, InfoNCECost{Temperature: d.Temperature}.Cost(nil,
+				autofunc.Concat(sims...)))
+		}
+		return autofunc.Scale(autofunc.SumAll(autofunc.Concat(losses...)),
+			1/float64(matched))
+	})
+}
+
+func (d DensePixelContrastiveCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n, m, matched := d.pixelCounts(x, a.Output())
+	if matched == 0 {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		pixels := autofunc.SplitR(n+m, a)
+		var losses []autofunc.RResult
+		for i, match := range x {
+			if match < 0 {
+				continue
+			}
+			pos := n + int(match)
+			sims := []autofunc.RResult{dotProductR(pixels[i], pixels[pos])}
+			for j := n; j < n+m; j++ {
+				if j != pos {
+					sims = append(sims, dotProductR(pixels[i], pixels[j]))
+				}
+			}
+			losses = append(losses, InfoNCECost{Temperature: d.Temperature}.CostR(v, nil,
+				autofunc.ConcatR(sims...)))
+		}
+		return autofunc.ScaleR(autofunc.SumAllR(autofunc.ConcatR(losses...)),
+			1/float64(matched))
+	})
+}
+
+// pixelCounts returns the number of pixels in each view
+// and the number of matched pixels in the first view.
+func (d DensePixelContrastiveCost) pixelCounts(x, a linalg.Vector) (n, m, matched int) {
+	if d.FeatureDim <= 0 || len(a)%d.FeatureDim != 0 {
+		panic("actual vector must contain whole feature vectors")
+	}
+	n = len(x)
+	m = len(a)/d.FeatureDim - n
+	if m <= 0 {
+		panic("actual vector must contain features for both views")
+	}
+	for _, match := range x {
+		if match >= float64(m) || (match < 0 && match != -1) {
+			panic("correspondence out of range")
+		}
+		if match >= 0 {
+			matched++
+		}
+	}
+	return
+}
@@ -0,0 +1,250 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestInfoNCECostGradient(t *testing.T) {
+	checkCostFuncGradients(t, InfoNCECost{Temperature: 0.3}, nil, linalg.RandVector(5))
+}
+
+func TestInfoNCECostDirection(t *testing.T) {
+	scores := linalg.Vector{0.2, 0.5, -0.1, 0.4}
+	for _, temp := range []float64{0.1, 1, 2} {
+		actual := &autofunc.Variable{Vector: scores.Copy()}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		InfoNCECost{Temperature: temp}.Cost(nil, actual).PropagateGradient(linalg.Vector{1},
+			grad)
+
+		var expSum float64
+		for _, s := range scores {
+			expSum += math.Exp(s / temp)
+		}
+		for j, g := range grad[actual] {
+			if j == 0 && g >= 0 {
+				t.Errorf("temp %f: positive gradient %f should be negative", temp, g)
+			} else if j > 0 && g <= 0 {
+				t.Errorf("temp %f: negative %d gradient %f should be positive", temp, j, g)
+			}
+			expected := math.Exp(scores[j]/temp) / expSum / temp
+			if j == 0 {
+				expected -= 1 / temp
+			}
+			if math.Abs(g-expected) > 1e-8 {
+				t.Errorf("temp %f: entry %d should be %f but got %f", temp, j, expected, g)
+			}
+		}
+	}
+}
+
+func TestNTXentCostGradient(t *testing.T) {
+	cost := NTXentCost{Temperature: 0.5, Dim: 3}
+	checkCostFuncGradients(t, cost, nil, linalg.RandVector(12))
+}
+
+func TestNTXentCostPairs(t *testing.T) {
+	cost := NTXentCost{Temperature: 0.5, Dim: 2}
+	// Views of input 0 point mostly right, views of input 1
+	// point mostly up, so each view matches its pair.
+	matched := &autofunc.Variable{Vector: []float64{1, 0, 0, 1, 0.8, 0.6, 0.6, 0.8}}
+	// The second views are swapped between the inputs.
+	swapped := &autofunc.Variable{Vector: []float64{1, 0, 0, 1, 0.6, 0.8, 0.8, 0.6}}
+	if m, sw := cost.Cost(nil, matched).Output()[0], cost.Cost(nil, swapped).Output()[0]; m >= sw {
+		t.Errorf("matched views should have lower cost: %f vs %f", m, sw)
+	}
+}
+
+func TestDensePixelContrastiveCostGradient(t *testing.T) {
+	cost := DensePixelContrastiveCost{Temperature: 0.5, FeatureDim: 2}
+	checkCostFuncGradients(t, cost, linalg.Vector{2, -1, 0}, linalg.RandVector(12))
+}
+
+func TestDensePixelContrastiveCostTraining(t *testing.T) {
+	cost := DensePixelContrastiveCost{Temperature: 0.5, FeatureDim: 2}
+	correspondence := linalg.Vector{1, 0}
+	features := &autofunc.Variable{Vector: linalg.Vector{1, 0, 0, 1, 0.6, 0.8, 0.8, 0.6}}
+	sim := func(i, j int) float64 {
+		return features.Vector[i*2 : i*2+2].Dot(features.Vector[j*2 : j*2+2])
+	}
+	matchedBefore, unmatchedBefore := sim(0, 3), sim(0, 2)
+	for i := 0; i < 10; i++ {
+		grad := autofunc.NewGradient([]*autofunc.Variable{features})
+		cost.Cost(correspondence, features).PropagateGradient(linalg.Vector{1}, grad)
+		features.Vector.Add(grad[features].Scale(-0.05))
+	}
+	if sim(0, 3) <= matchedBefore {
+		t.Errorf("matched similarity did not increase: %f -> %f", matchedBefore, sim(0, 3))
+	}
+	if sim(0, 2) >= unmatchedBefore {
+		t.Errorf("unmatched similarity did not decrease: %f -> %f", unmatchedBefore,
+			sim(0, 2))
+	}
+
+	unmatched := &autofunc.Variable{Vector: features.Vector}
+	if c := cost.Cost(linalg.Vector{-1, -1}, unmatched).Output()[0]; c != 0 {
+		t.Errorf("expected no cost without matches but got %f", c)
+	}
+}
+
+func TestBarlowTwinsCostGradient(t *testing.T) {
+	cost := BarlowTwinsCost{Lambda: 0.1, Dim: 2}
+	checkCostFuncGradients(t, cost, nil, linalg.RandVector(12))
+}
+
+func TestBarlowTwinsCostMinimum(t *testing.T) {
+	cost := BarlowTwinsCost{Lambda: 0.5, Dim: 2}
+	view := []float64{1, 1, 1, -1, -1, 1, -1, -1}
+	identical := &autofunc.Variable{Vector: append(append([]float64{}, view...), view...)}
+	if c := cost.Cost(nil, identical).Output()[0]; math.Abs(c) > 1e-6 {
+		t.Errorf("identical decorrelated views should cost 0, got %f", c)
+	}
+
+	correlated := []float64{1, 1, 1, 1, -1, -1, -1, -1}
+	redundant := &autofunc.Variable{
+		Vector: append(append([]float64{}, correlated...), correlated...),
+	}
+	if c := cost.Cost(nil, redundant).Output()[0]; c < 0.5 {
+		t.Errorf("correlated components should be penalized, got %f", c)
+	}
+
+	shuffled := []float64{1, 1, -1, -1, 1, -1, -1, 1}
+	mismatched := &autofunc.Variable{Vector: append(append([]float64{}, view...), shuffled...)}
+	if c := cost.Cost(nil, mismatched).Output()[0]; c < 0.5 {
+		t.Errorf("mismatched views should be penalized, got %f", c)
+	}
+}
+
+func TestVICRegCostGradient(t *testing.T) {
+	cost := VICRegCost{SimCoeff: 25, VarCoeff: 25, CovCoeff: 1, Dim: 2}
+	checkCostFuncGradients(t, cost, nil, linalg.RandVector(12))
+}
+
+func TestVICRegCostCoefficients(t *testing.T) {
+	actual := linalg.RandVector(16).Scale(0.5)
+	gradFor := func(c VICRegCost) linalg.Vector {
+		c.Dim = 2
+		variable := &autofunc.Variable{Vector: actual}
+		grad := autofunc.NewGradient([]*autofunc.Variable{variable})
+		c.Cost(nil, variable).PropagateGradient(linalg.Vector{1}, grad)
+		return grad[variable]
+	}
+	simGrad := gradFor(VICRegCost{SimCoeff: 1})
+	varGrad := gradFor(VICRegCost{VarCoeff: 1})
+	covGrad := gradFor(VICRegCost{CovCoeff: 1})
+	for i, g := range []linalg.Vector{simGrad, varGrad, covGrad} {
+		if g.MaxAbs() == 0 {
+			t.Errorf("term %d has no gradient", i)
+		}
+	}
+
+	combined := gradFor(VICRegCost{SimCoeff: 2, VarCoeff: 3, CovCoeff: 5})
+	expected := simGrad.Copy().Scale(2).Add(varGrad.Copy().Scale(3)).Add(covGrad.Copy().Scale(5))
+	if combined.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-8 {
+		t.Errorf("expected gradient %v but got %v", expected, combined)
+	}
+}
+
+func TestCosineSimilarityMatrix(t *testing.T) {
+	embeddings := []linalg.Vector{{1, 2, 3}, {-2, 0.5, 1}, {0, 0, 0}, {3, -1, 0.5}}
+	matrix := CosineSimilarityMatrix(embeddings)
+	for i, row := range matrix {
+		for j, x := range row {
+			if i == j && i != 2 && math.Abs(x-1) > 1e-8 {
+				t.Errorf("diagonal entry %d should be 1 but got %f", i, x)
+			}
+			if math.Abs(x-matrix[j][i]) > 1e-8 {
+				t.Errorf("entry %d,%d is not symmetric", i, j)
+			}
+			if (i == 2 || j == 2) && x != 0 {
+				t.Errorf("zero embedding gave similarity %f", x)
+			}
+		}
+	}
+
+	var joined linalg.Vector
+	for _, emb := range embeddings {
+		joined = append(joined, emb...)
+	}
+	result := CosineSimilarities(&autofunc.Variable{Vector: joined}, 3).Output()
+	for i, row := range matrix {
+		for j, x := range row {
+			if math.Abs(result[i*len(row)+j]-x) > 1e-8 {
+				t.Errorf("entry %d,%d: expected %f but got %f", i, j, x, result[i*len(row)+j])
+			}
+		}
+	}
+}
+
+func TestCosineSimilaritiesGradient(t *testing.T) {
+	in := &autofunc.Variable{Vector: linalg.RandVector(9)}
+	checker := &functest.RFuncChecker{
+		F:     cosineSimilaritiesFunc{Dim: 3},
+		Vars:  []*autofunc.Variable{in},
+		Input: in,
+		RV:    autofunc.RVector{in: linalg.RandVector(9)},
+	}
+	checker.FullCheck(t)
+}
+
+type cosineSimilaritiesFunc struct {
+	Dim int
+}
+
+func (c cosineSimilaritiesFunc) Apply(in autofunc.Result) autofunc.Result {
+	return CosineSimilarities(in, c.Dim)
+}
+
+func (c cosineSimilaritiesFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return CosineSimilaritiesR(v, in, c.Dim)
+}
+
+func TestSupConCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, SupConCost{Temperature: 0.5}, linalg.Vector{0, 1, 0, 2, 1},
+		linalg.RandVector(15))
+}
+
+func TestSupConCostPull(t *testing.T) {
+	cost := SupConCost{Temperature: 0.5}
+	labels := linalg.Vector{0, 0, 1, 2}
+	embeddings := &autofunc.Variable{Vector: linalg.Vector{1, 0, 0, 1, -1, 0, 0, -1}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{embeddings})
+	cost.Cost(labels, embeddings).PropagateGradient(linalg.Vector{1}, grad)
+
+	// A descent step should rotate the first embedding
+	// toward the second one, its only positive.
+	if step := grad[embeddings][1]; step >= 0 {
+		t.Errorf("first embedding is not pulled toward its positive: %v", grad[embeddings])
+	}
+
+	// When every label is unique, there are no positives
+	// and the cost is zero.
+	if c := cost.Cost(linalg.Vector{0, 1, 2, 3}, embeddings).Output()[0]; c != 0 {
+		t.Errorf("expected zero cost without positives, got %f", c)
+	}
+}
+
+func TestCPCCost(t *testing.T) {
+	cost := CPCCost{NumNegatives: 2, PredictionSteps: 2}
+	checkCostFuncGradients(t, cost, nil, linalg.RandVector(16))
+
+	// Each step has a prediction, a positive, and two
+	// negatives in two dimensions.
+	matching := linalg.Vector{
+		1, 0, 1, 0, 0, 1, -1, 0,
+		0, 2, 0, 1, 1, 0, 0, -1,
+	}
+	mismatched := linalg.Vector{
+		1, 0, 0, 1, 1, 0, -1, 0,
+		0, 2, 1, 0, 0, 1, 0, -1,
+	}
+	good := cost.Cost(nil, &autofunc.Variable{Vector: matching}).Output()[0]
+	bad := cost.Cost(nil, &autofunc.Variable{Vector: mismatched}).Output()[0]
+	if good >= bad {
+		t.Errorf("matching predictions should cost less: %f vs %f", good, bad)
+	}
+}
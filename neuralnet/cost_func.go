@@ -1,6 +1,8 @@
 package neuralnet
 
 import (
+	"math"
+	"runtime"
 	"sync"
 
 	"github.com/unixpickle/autofunc"
@@ -20,27 +22,234 @@ type CostFunc interface {
 		actual autofunc.RResult) autofunc.RResult
 }
 
+// A BatchCostFunc is a CostFunc which can evaluate the
+// total cost of a batch of samples in a single Result.
+//
+// The expected and actual vectors contain the
+// concatenated vectors of n samples, as produced by an
+// autofunc.Batcher.
+type BatchCostFunc interface {
+	CostFunc
+
+	BatchCost(expected linalg.Vector, actual autofunc.Result, n int) autofunc.Result
+	BatchCostR(v autofunc.RVector, expected linalg.Vector, actual autofunc.RResult,
+		n int) autofunc.RResult
+}
+
+// BatchCost computes the total cost of a batch of n
+// samples, given their concatenated expected and actual
+// vectors.
+//
+// If c is a BatchCostFunc, its BatchCost method is used.
+// Otherwise, c is applied to each sample separately.
+func BatchCost(c CostFunc, expected linalg.Vector, actual autofunc.Result,
+	n int) autofunc.Result {
+	if bc, ok := c.(BatchCostFunc); ok {
+		return bc.BatchCost(expected, actual, n)
+	}
+	inSize, outSize := batchSizes(expected, actual.Output(), n)
+	return autofunc.Pool(actual, func(actual autofunc.Result) autofunc.Result {
+		var sum autofunc.Result
+		for i := 0; i < n; i++ {
+			x := expected[i*inSize : (i+1)*inSize]
+			a := autofunc.Slice(actual, i*outSize, (i+1)*outSize)
+			if cost := c.Cost(x, a); sum == nil {
+				sum = cost
+			} else {
+				sum = autofunc.Add(sum, cost)
+			}
+		}
+		return sum
+	})
+}
+
+// BatchCostR is like BatchCost, but for RResults.
+func BatchCostR(v autofunc.RVector, c CostFunc, expected linalg.Vector,
+	actual autofunc.RResult, n int) autofunc.RResult {
+	if bc, ok := c.(BatchCostFunc); ok {
+		return bc.BatchCostR(v, expected, actual, n)
+	}
+	inSize, outSize := batchSizes(expected, actual.Output(), n)
+	return autofunc.PoolR(actual, func(actual autofunc.RResult) autofunc.RResult {
+		var sum autofunc.RResult
+		for i := 0; i < n; i++ {
+			x := expected[i*inSize : (i+1)*inSize]
+			a := autofunc.SliceR(actual, i*outSize, (i+1)*outSize)
+			if cost := c.CostR(v, x, a); sum == nil {
+				sum = cost
+			} else {
+				sum = autofunc.AddR(sum, cost)
+			}
+		}
+		return sum
+	})
+}
+
+// batchSizes returns the per-sample sizes of the
+// expected and actual vectors of a batch.
+func batchSizes(expected, actual linalg.Vector, n int) (expSize, actSize int) {
+	if n <= 0 || len(expected)%n != 0 || len(actual)%n != 0 {
+		panic("vector sizes must be divisible by batch size")
+	}
+	return len(expected) / n, len(actual) / n
+}
+
+// checkElementwiseBatch checks the sizes of a batch for a
+// cost which is a sum of independent per-component terms.
+// Such a cost can be applied to the whole batch at once.
+func checkElementwiseBatch(expected, actual linalg.Vector, n int) {
+	if len(expected) != len(actual) {
+		panic("expected and actual sizes must match")
+	}
+	batchSizes(expected, actual, n)
+}
+
+// totalCostChunkSize is the number of samples which
+// TotalCost evaluates per unit of work.
+const totalCostChunkSize = 64
+
 // TotalCost returns the total cost of a layer on a
 // set of VectorSamples.
 // The elements of s must be VectorSamples.
+//
+// Samples are evaluated concurrently on up to GOMAXPROCS
+// goroutines, so layer must be safe to apply from
+// multiple goroutines at once.
+// The samples are summed in fixed-size chunks whose
+// partial sums are added in order, so the result does
+// not depend on scheduling or on GOMAXPROCS.
+//
+// If c is a PreActivationCostFunc and layer is a Network
+// ending with the activation c expects, the activation
+// is skipped and the cost is computed from its input.
 func TotalCost(c CostFunc, layer autofunc.Func, s sgd.SampleSet) float64 {
+	return TotalCostFunc(c, layer, s, vectorSampleData)
+}
+
+// TotalCostFunc is like TotalCost, but it uses extract to
+// get the input and desired output of each sample, so
+// the elements of s need not be VectorSamples.
+// Like layer, extract must be safe to call from multiple
+// goroutines at once.
+func TotalCostFunc(c CostFunc, layer autofunc.Func, s sgd.SampleSet,
+	extract func(sample interface{}) (input, output linalg.Vector)) float64 {
+	costs := sampleCosts(c, layer, s, extract)
 	var totalCost float64
-	for i := 0; i < s.Len(); i++ {
-		sample := s.GetSample(i)
-		vs := sample.(VectorSample)
-		inVar := &autofunc.Variable{vs.Input}
-		result := layer.Apply(inVar)
-		costOut := c.Cost(vs.Output, result)
-		totalCost += costOut.Output()[0]
+	for start := 0; start < len(costs); start += totalCostChunkSize {
+		end := start + totalCostChunkSize
+		if end > len(costs) {
+			end = len(costs)
+		}
+		var sum float64
+		for _, cost := range costs[start:end] {
+			sum += cost
+		}
+		totalCost += sum
 	}
 	return totalCost
 }
 
+// SampleCosts is like TotalCost, but it returns the cost
+// of each sample separately.
+// The i-th cost corresponds to the i-th sample in s.
+func SampleCosts(c CostFunc, layer autofunc.Func, s sgd.SampleSet) []float64 {
+	return sampleCosts(c, layer, s, vectorSampleData)
+}
+
+func sampleCosts(c CostFunc, layer autofunc.Func, s sgd.SampleSet,
+	extract func(sample interface{}) (input, output linalg.Vector)) []float64 {
+	costs := make([]float64, s.Len())
+	numChunks := (s.Len() + totalCostChunkSize - 1) / totalCostChunkSize
+	preCost, preLayer, usePre := preActivationFunc(c, layer)
+
+	chunks := make(chan int, numChunks)
+	for i := 0; i < numChunks; i++ {
+		chunks <- i
+	}
+	close(chunks)
+
+	goCount := runtime.GOMAXPROCS(0)
+	if goCount > numChunks {
+		goCount = numChunks
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < goCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				start := chunk * totalCostChunkSize
+				end := start + totalCostChunkSize
+				if end > s.Len() {
+					end = s.Len()
+				}
+				for j := start; j < end; j++ {
+					input, output := extract(s.GetSample(j))
+					inVar := &autofunc.Variable{input}
+					if usePre {
+						logits := preLayer.Apply(inVar)
+						costs[j] = preCost.CostLogits(output, logits).Output()[0]
+					} else {
+						result := layer.Apply(inVar)
+						costs[j] = c.Cost(output, result).Output()[0]
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return costs
+}
+
+// vectorSampleData is the sample extractor used by
+// TotalCost, which requires VectorSamples.
+func vectorSampleData(sample interface{}) (input, output linalg.Vector) {
+	vs := sample.(VectorSample)
+	return vs.Input, vs.Output
+}
+
 // TotalCostBatcher is like TotalCost, but it applies a
 // batcher to multiple inputs at once.
 // If batchSize is 0, the full sample set will be applied
 // at once.
+//
+// The concatenated input and output buffers are reused
+// from batch to batch, so neither b nor c may retain the
+// vectors passed to them.
+//
+// If c is a PreActivationCostFunc and b was made by
+// Network.BatchLearner, the cost of each sample's logits
+// is computed separately, so the result is correct even
+// though the cost is not a sum of per-component terms.
 func TotalCostBatcher(c CostFunc, b autofunc.Batcher, s sgd.SampleSet, batchSize int) float64 {
+	return totalCostBatches(c, b, s, batchSize, false)
+}
+
+// TotalCostMatrix is like TotalCostBatcher, but the
+// desired outputs of each batch are treated as the rows
+// of a matrix and evaluated with CostMatrix.
+//
+// Unlike TotalCostBatcher, this gives the same result as
+// TotalCost for costs which normalize over each sample's
+// output, since such costs see one row at a time.
+func TotalCostMatrix(c CostFunc, b autofunc.Batcher, s sgd.SampleSet, batchSize int) float64 {
+	return totalCostBatches(c, b, s, batchSize, true)
+}
+
+func totalCostBatches(c CostFunc, b autofunc.Batcher, s sgd.SampleSet, batchSize int,
+	matrix bool) float64 {
+	if s.Len() == 0 {
+		return 0
+	}
+	maxBatch := batchSize
+	if maxBatch == 0 || maxBatch > s.Len() {
+		maxBatch = s.Len()
+	}
+	first := s.GetSample(0).(VectorSample)
+	input := make(linalg.Vector, 0, maxBatch*len(first.Input))
+	desired := make(linalg.Vector, 0, maxBatch*len(first.Output))
+	preCost, preBatcher, usePre := preActivationBatcher(c, b)
+
 	var totalCost float64
 	i := 0
 	for i < s.Len() {
@@ -48,21 +257,135 @@ func TotalCostBatcher(c CostFunc, b autofunc.Batcher, s sgd.SampleSet, batchSize
 		if bs == 0 || bs > s.Len()-i {
 			bs = s.Len() - i
 		}
-		var input, desired linalg.Vector
+		input, desired = input[:0], desired[:0]
 		for j := 0; j < bs; j++ {
 			sample := s.GetSample(j + i).(VectorSample)
 			input = append(input, sample.Input...)
 			desired = append(desired, sample.Output...)
 		}
 		inVar := &autofunc.Variable{Vector: input}
-		result := b.Batch(inVar, bs)
-		costOut := c.Cost(desired, result)
-		totalCost += costOut.Output()[0]
+		if usePre {
+			logits := autofunc.Split(bs, preBatcher.Batch(inVar, bs))
+			outSize := len(desired) / bs
+			for j, l := range logits {
+				sampleDesired := desired[j*outSize : (j+1)*outSize]
+				totalCost += preCost.CostLogits(sampleDesired, l).Output()[0]
+			}
+		} else if matrix {
+			result := b.Batch(inVar, bs)
+			desiredMat := linalg.Matrix{
+				Rows: bs,
+				Cols: len(desired) / bs,
+				Data: desired,
+			}
+			totalCost += CostMatrix(c, desiredMat, result).Output()[0]
+		} else {
+			result := b.Batch(inVar, bs)
+			costOut := c.Cost(desired, result)
+			totalCost += costOut.Output()[0]
+		}
 		i += bs
 	}
 	return totalCost
 }
 
+// MeanCostBatcher is like TotalCostBatcher, but it
+// applies the cost function to each sample's output
+// separately and returns the average cost per sample.
+//
+// TotalCostBatcher applies the cost function once to the
+// concatenated outputs of a batch, which only gives the
+// per-sample result for costs that are sums of
+// independent per-component terms.
+// Costs which normalize over their input (e.g. a softmax
+// cross entropy) or which expect a fixed output size
+// should be evaluated with MeanCostBatcher (or
+// TotalCostMatrix) instead.
+func MeanCostBatcher(c CostFunc, b autofunc.Batcher, s sgd.SampleSet, batchSize int) float64 {
+	if s.Len() == 0 {
+		return 0
+	}
+	var totalCost float64
+	i := 0
+	for i < s.Len() {
+		bs := batchSize
+		if bs == 0 || bs > s.Len()-i {
+			bs = s.Len() - i
+		}
+		var input linalg.Vector
+		for j := 0; j < bs; j++ {
+			sample := s.GetSample(j + i).(VectorSample)
+			input = append(input, sample.Input...)
+		}
+		inVar := &autofunc.Variable{Vector: input}
+		output := b.Batch(inVar, bs).Output()
+		outSize := len(output) / bs
+		for j := 0; j < bs; j++ {
+			sample := s.GetSample(j + i).(VectorSample)
+			outVar := &autofunc.Variable{Vector: output[j*outSize : (j+1)*outSize]}
+			totalCost += c.Cost(sample.Output, outVar).Output()[0]
+		}
+		i += bs
+	}
+	return totalCost / float64(s.Len())
+}
+
+// A ContributionCostFunc is a CostFunc which can split
+// its cost into contributions whose sum is the cost,
+// e.g. by combining the contributions of the costs it
+// wraps.
+type ContributionCostFunc interface {
+	CostFunc
+
+	CostContributions(expected linalg.Vector, actual autofunc.Result) linalg.Vector
+}
+
+// CostContributions returns the contribution of each
+// output component to a cost, which is useful to find
+// the outputs a model struggles with.
+//
+// Costs which are sums of independent per-component
+// terms (MeanSquaredCost, AbsCost, HuberCost,
+// SmoothL1Cost, LogCoshCost, PNormCost, PoissonCost,
+// CrossEntropyCost, KLDivergenceCost, SigmoidCECost,
+// and DotCost, or pointers to them) are decomposed into
+// one value per component.
+// Costs which implement ContributionCostFunc, such as
+// CompositeCost, RegularizingCost, and the scheduled
+// costs, decide their own decomposition.
+// For any other cost, the result contains a single
+// element: the total cost.
+func CostContributions(c CostFunc, expected linalg.Vector, actual autofunc.Result) linalg.Vector {
+	if cc, ok := c.(ContributionCostFunc); ok {
+		return cc.CostContributions(expected, actual)
+	}
+	switch c.(type) {
+	case MeanSquaredCost, AbsCost, HuberCost, SmoothL1Cost, LogCoshCost, PNormCost,
+		PoissonCost, CrossEntropyCost, KLDivergenceCost, SigmoidCECost, DotCost,
+		*MeanSquaredCost, *AbsCost, *HuberCost, *SmoothL1Cost, *LogCoshCost, *PNormCost,
+		*PoissonCost, *CrossEntropyCost, *KLDivergenceCost, *SigmoidCECost, *DotCost:
+		return elementCosts(c, expected, actual).Output()
+	default:
+		return c.Cost(expected, actual).Output()
+	}
+}
+
+// addContributions adds scale times the contributions
+// of c into res, starting at the given offset.
+// It returns false if c does not decompose into one
+// value per component of expected.
+func addContributions(res linalg.Vector, offset int, c CostFunc, scale float64,
+	expected linalg.Vector, actual autofunc.Result) bool {
+	contribs := CostContributions(c, expected, actual)
+	if len(contribs) != len(expected) {
+		return false
+	}
+	for i, x := range contribs {
+		res[offset+i] += scale * x
+	}
+	return true
+}
+
 // MeanSquaredCost computes the cost as ||a-x||^2
 // where a is the actual output and x is the desired
 // output.
@@ -82,6 +405,20 @@ func (_ MeanSquaredCost) CostR(v autofunc.RVector, a linalg.Vector,
 	return autofunc.SquaredNorm{}.ApplyR(v, autofunc.AddR(aVarR, x))
 }
 
+// BatchCost computes the total cost of a batch of n
+// samples in a single Result.
+func (_ MeanSquaredCost) BatchCost(x linalg.Vector, a autofunc.Result, n int) autofunc.Result {
+	checkElementwiseBatch(x, a.Output(), n)
+	return MeanSquaredCost{}.Cost(x, a)
+}
+
+// BatchCostR is like BatchCost, but for RResults.
+func (_ MeanSquaredCost) BatchCostR(v autofunc.RVector, x linalg.Vector, a autofunc.RResult,
+	n int) autofunc.RResult {
+	checkElementwiseBatch(x, a.Output(), n)
+	return MeanSquaredCost{}.CostR(v, x, a)
+}
+
 type meanSquaredResult struct {
 	OutputLock   sync.RWMutex
 	OutputVector linalg.Vector
@@ -160,39 +497,381 @@ func (_ AbsCost) CostR(v autofunc.RVector, x linalg.Vector, a autofunc.RResult)
 	return autofunc.SumAllR(autofunc.MulR(autofunc.NewRVariable(mask, v), diff))
 }
 
+// BatchCost computes the total cost of a batch of n
+// samples in a single Result.
+func (_ AbsCost) BatchCost(x linalg.Vector, a autofunc.Result, n int) autofunc.Result {
+	checkElementwiseBatch(x, a.Output(), n)
+	return AbsCost{}.Cost(x, a)
+}
+
+// BatchCostR is like BatchCost, but for RResults.
+func (_ AbsCost) BatchCostR(v autofunc.RVector, x linalg.Vector, a autofunc.RResult,
+	n int) autofunc.RResult {
+	checkElementwiseBatch(x, a.Output(), n)
+	return AbsCost{}.CostR(v, x, a)
+}
+
+// HuberCost implements the Huber loss in its smooth L1
+// form.
+//
+// For each residual r, the cost is r^2/(2*Delta) if
+// |r| < Delta and |r|-Delta/2 otherwise, making it
+// quadratic near zero and linear for outliers.
+//
+// With Delta=0, this is equivalent to AbsCost.
+type HuberCost struct {
+	Delta float64
+}
+
+func (h HuberCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	diff := autofunc.Add(xVar, a)
+	quadMask, linMask, linCount := h.masks(diff.Output())
+	lin := autofunc.SumAll(autofunc.Mul(&autofunc.Variable{Vector: linMask}, diff))
+	lin = autofunc.AddScaler(lin, -h.Delta/2*float64(linCount))
+	if h.Delta == 0 {
+		return lin
+	}
+	quad := autofunc.Mul(&autofunc.Variable{Vector: quadMask}, diff)
+	quadSum := autofunc.Scale(autofunc.SquaredNorm{}.Apply(quad), 1/(2*h.Delta))
+	return autofunc.Add(quadSum, lin)
+}
+
+func (h HuberCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	diff := autofunc.AddR(xVar, a)
+	quadMask, linMask, linCount := h.masks(diff.Output())
+	linVar := autofunc.NewRVariable(&autofunc.Variable{Vector: linMask}, v)
+	lin := autofunc.SumAllR(autofunc.MulR(linVar, diff))
+	lin = autofunc.AddScalerR(lin, -h.Delta/2*float64(linCount))
+	if h.Delta == 0 {
+		return lin
+	}
+	quadVar := autofunc.NewRVariable(&autofunc.Variable{Vector: quadMask}, v)
+	quad := autofunc.MulR(quadVar, diff)
+	quadSum := autofunc.ScaleR(autofunc.SquaredNorm{}.ApplyR(v, quad), 1/(2*h.Delta))
+	return autofunc.AddR(quadSum, lin)
+}
+
+// masks returns a 0/1 mask selecting the quadratic
+// residuals, a sign mask selecting the linear residuals,
+// and the number of linear residuals.
+func (h HuberCost) masks(diff linalg.Vector) (quad, lin linalg.Vector, linCount int) {
+	quad = make(linalg.Vector, len(diff))
+	lin = make(linalg.Vector, len(diff))
+	for i, val := range diff {
+		if math.Abs(val) < h.Delta {
+			quad[i] = 1
+		} else if val < 0 {
+			lin[i] = -1
+			linCount++
+		} else {
+			lin[i] = 1
+			linCount++
+		}
+	}
+	return
+}
+
+// SmoothL1Cost implements the smooth L1 loss used for
+// box regression in Fast and Faster R-CNN.
+//
+// For each residual z, the cost is 0.5*z^2 if |z| < 1 and
+// |z|-0.5 otherwise.
+// This is HuberCost with its Delta fixed at 1, matching
+// the definition used in the detection literature.
+type SmoothL1Cost struct{}
+
+func (_ SmoothL1Cost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return HuberCost{Delta: 1}.Cost(x, a)
+}
+
+func (_ SmoothL1Cost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return HuberCost{Delta: 1}.CostR(v, x, a)
+}
+
+// LogCoshCost computes the sum of log(cosh(a-x)), where a
+// is the actual output and x is the desired output.
+//
+// Like HuberCost, this is quadratic for small residuals
+// and linear for large ones, but it is smooth everywhere.
+// It is computed as |z| + log(1+exp(-2|z|)) - log(2),
+// which does not overflow for large residuals.
+type LogCoshCost struct{}
+
+func (_ LogCoshCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	return autofunc.SumAll(logCoshFunc.Apply(autofunc.Add(xVar, a)))
+}
+
+func (_ LogCoshCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	return autofunc.SumAllR(logCoshFunc.ApplyR(v, autofunc.AddR(xVar, a)))
+}
+
+var logCoshFunc = &elemFunc{
+	F: func(x float64) float64 {
+		abs := math.Abs(x)
+		return abs + math.Log1p(math.Exp(-2*abs)) - math.Ln2
+	},
+	Deriv: math.Tanh,
+	SecondDeriv: func(x float64) float64 {
+		t := math.Tanh(x)
+		return 1 - t*t
+	},
+}
+
+// poissonEpsilon is added to predicted rates before
+// taking their logarithm, so that a rate of 0 does not
+// produce an infinite cost.
+const poissonEpsilon = 1e-8
+
+// PoissonCost computes the Poisson negative log
+// likelihood sum(a - x*log(a)), where a is the actual
+// output (the predicted rates) and x is the desired
+// output (the observed counts).
+// Terms which do not depend on a (i.e. log(x!)) are
+// omitted.
+//
+// The caller is responsible for ensuring that a is
+// non-negative, e.g. by feeding it through an
+// exponential or a softplus.
+type PoissonCost struct{}
+
+func (_ PoissonCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logA := autofunc.Log{}.Apply(autofunc.AddScaler(a, poissonEpsilon))
+		return autofunc.SumAll(autofunc.Add(a, autofunc.Mul(xVar, logA)))
+	})
+}
+
+func (_ PoissonCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		logA := autofunc.Log{}.ApplyR(v, autofunc.AddScalerR(a, poissonEpsilon))
+		return autofunc.SumAllR(autofunc.AddR(a, autofunc.MulR(xVar, logA)))
+	})
+}
+
+// MaxAbsCost implements the L-infinity cost.
+// In other words, it computes the largest absolute
+// difference between actual and expected values.
+//
+// Only the component with the largest absolute
+// difference receives a gradient.
+// If several components tie, the first one is used.
+type MaxAbsCost struct{}
+
+func (_ MaxAbsCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	diff := autofunc.Add(xVar, a)
+	mask := &autofunc.Variable{Vector: maxAbsMask(diff.Output())}
+	return autofunc.SumAll(autofunc.Mul(mask, diff))
+}
+
+func (_ MaxAbsCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	diff := autofunc.AddR(xVar, a)
+	mask := &autofunc.Variable{Vector: maxAbsMask(diff.Output())}
+	return autofunc.SumAllR(autofunc.MulR(autofunc.NewRVariable(mask, v), diff))
+}
+
+// maxAbsMask returns a vector which is zero everywhere
+// except at the first component of v with the largest
+// absolute value, where it holds that component's sign.
+func maxAbsMask(v linalg.Vector) linalg.Vector {
+	mask := make(linalg.Vector, len(v))
+	if len(v) == 0 {
+		return mask
+	}
+	maxIdx := 0
+	for i, val := range v {
+		if math.Abs(val) > math.Abs(v[maxIdx]) {
+			maxIdx = i
+		}
+	}
+	if v[maxIdx] < 0 {
+		mask[maxIdx] = -1
+	} else {
+		mask[maxIdx] = 1
+	}
+	return mask
+}
+
+// pNormEpsilon bounds the magnitude of residuals used to
+// compute the second derivative of PNormCost, which is
+// unbounded near zero for P < 2.
+const pNormEpsilon = 1e-8
+
+// PNormCost computes the sum of |a-x|^P, where a is the
+// actual output and x is the desired output.
+// P must be at least 1.
+//
+// With P=1, this is equivalent to AbsCost, and with P=2,
+// it is equivalent to MeanSquaredCost.
+type PNormCost struct {
+	P float64
+}
+
+func (p PNormCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	return autofunc.SumAll(p.powFunc().Apply(autofunc.Add(xVar, a)))
+}
+
+func (p PNormCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	return autofunc.SumAllR(p.powFunc().ApplyR(v, autofunc.AddR(xVar, a)))
+}
+
+func (p PNormCost) powFunc() *elemFunc {
+	if p.P < 1 {
+		panic("P must be at least 1")
+	}
+	sign := func(x float64) float64 {
+		if x < 0 {
+			return -1
+		}
+		return 1
+	}
+	return &elemFunc{
+		F: func(x float64) float64 {
+			return math.Pow(math.Abs(x), p.P)
+		},
+		Deriv: func(x float64) float64 {
+			return p.P * math.Pow(math.Abs(x), p.P-1) * sign(x)
+		},
+		SecondDeriv: func(x float64) float64 {
+			mag := math.Max(math.Abs(x), pNormEpsilon)
+			return p.P * (p.P - 1) * math.Pow(mag, p.P-2)
+		},
+	}
+}
+
 // CrossEntropyCost computes the cost using the
 // definition of cross entropy.
-type CrossEntropyCost struct{}
+//
+// If Epsilon is non-zero, the actual values are clipped
+// to [Epsilon, 1-Epsilon] before taking logs, so that
+// activations of exactly 0 or 1 give a finite cost and
+// gradient.
+// Clipped components receive no gradient.
+type CrossEntropyCost struct {
+	Epsilon float64
+}
 
-func (_ CrossEntropyCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+func (c CrossEntropyCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if c.Epsilon != 0 {
+		a = clamp(a, c.Epsilon, 1-c.Epsilon)
+	}
 	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
-		xVar := &autofunc.Variable{x}
-		logA := autofunc.Log{}.Apply(a)
-		oneMinusA := autofunc.AddScaler(autofunc.Scale(a, -1), 1)
-		oneMinusX := autofunc.AddScaler(autofunc.Scale(xVar, -1), 1)
-		log1A := autofunc.Log{}.Apply(oneMinusA)
-
-		errorVec := autofunc.Add(autofunc.Mul(xVar, logA),
-			autofunc.Mul(oneMinusX, log1A))
-		return autofunc.Scale(autofunc.SumAll(errorVec), -1)
+		return autofunc.Scale(autofunc.SumAll(crossEntropyTerms(x, a)), -1)
 	})
 }
 
-func (_ CrossEntropyCost) CostR(v autofunc.RVector, x linalg.Vector,
+func (c CrossEntropyCost) CostR(v autofunc.RVector, x linalg.Vector,
 	a autofunc.RResult) autofunc.RResult {
+	if c.Epsilon != 0 {
+		a = clampR(v, a, c.Epsilon, 1-c.Epsilon)
+	}
 	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
-		xVar := autofunc.NewRVariable(&autofunc.Variable{x}, autofunc.RVector{})
-		logA := autofunc.Log{}.ApplyR(v, a)
-		oneMinusA := autofunc.AddScalerR(autofunc.ScaleR(a, -1), 1)
-		oneMinusX := autofunc.AddScalerR(autofunc.ScaleR(xVar, -1), 1)
-		log1A := autofunc.Log{}.ApplyR(v, oneMinusA)
-
-		errorVec := autofunc.AddR(autofunc.MulR(xVar, logA),
-			autofunc.MulR(oneMinusX, log1A))
-		return autofunc.ScaleR(autofunc.SumAllR(errorVec), -1)
+		return autofunc.ScaleR(autofunc.SumAllR(crossEntropyTermsR(v, x, a)), -1)
 	})
 }
 
+// crossEntropyTerms computes x*log(a) + (1-x)*log(1-a)
+// for each component, i.e. the negative cross entropy
+// of each component.
+func crossEntropyTerms(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{x}
+	logA := autofunc.Log{}.Apply(a)
+	oneMinusA := autofunc.AddScaler(autofunc.Scale(a, -1), 1)
+	oneMinusX := autofunc.AddScaler(autofunc.Scale(xVar, -1), 1)
+	log1A := autofunc.Log{}.Apply(oneMinusA)
+	return autofunc.Add(autofunc.Mul(xVar, logA), autofunc.Mul(oneMinusX, log1A))
+}
+
+func crossEntropyTermsR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{x}, autofunc.RVector{})
+	logA := autofunc.Log{}.ApplyR(v, a)
+	oneMinusA := autofunc.AddScalerR(autofunc.ScaleR(a, -1), 1)
+	oneMinusX := autofunc.AddScalerR(autofunc.ScaleR(xVar, -1), 1)
+	log1A := autofunc.Log{}.ApplyR(v, oneMinusA)
+	return autofunc.AddR(autofunc.MulR(xVar, logA), autofunc.MulR(oneMinusX, log1A))
+}
+
+// BatchCost computes the total cost of a batch of n
+// samples in a single Result.
+func (c CrossEntropyCost) BatchCost(x linalg.Vector, a autofunc.Result, n int) autofunc.Result {
+	checkElementwiseBatch(x, a.Output(), n)
+	return c.Cost(x, a)
+}
+
+// BatchCostR is like BatchCost, but for RResults.
+func (c CrossEntropyCost) BatchCostR(v autofunc.RVector, x linalg.Vector, a autofunc.RResult,
+	n int) autofunc.RResult {
+	checkElementwiseBatch(x, a.Output(), n)
+	return c.CostR(v, x, a)
+}
+
+// KLDivergenceCost computes the KL divergence
+// sum(x*(log(x)-log(a))) of the actual distribution a
+// from the expected distribution x.
+//
+// Unlike CrossEntropyCost, this includes the entropy of
+// the expected distribution, so the cost is 0 when a
+// matches x exactly.
+// Components where x is 0 contribute nothing, following
+// the convention that 0*log(0) = 0.
+//
+// The caller is responsible for ensuring that a is a
+// valid probability distribution, e.g. by feeding it
+// through a SoftmaxLayer.
+type KLDivergenceCost struct{}
+
+func (_ KLDivergenceCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	negEntropy, zeroMask := klTargetTerms(x)
+	xVar := &autofunc.Variable{Vector: x}
+	logA := autofunc.Log{}.Apply(autofunc.Add(a, &autofunc.Variable{Vector: zeroMask}))
+	crossEntropy := autofunc.Scale(autofunc.SumAll(autofunc.Mul(xVar, logA)), -1)
+	return autofunc.AddScaler(crossEntropy, negEntropy)
+}
+
+func (_ KLDivergenceCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	negEntropy, zeroMask := klTargetTerms(x)
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x}, v)
+	maskVar := autofunc.NewRVariable(&autofunc.Variable{Vector: zeroMask}, v)
+	logA := autofunc.Log{}.ApplyR(v, autofunc.AddR(a, maskVar))
+	crossEntropy := autofunc.ScaleR(autofunc.SumAllR(autofunc.MulR(xVar, logA)), -1)
+	return autofunc.AddScalerR(crossEntropy, negEntropy)
+}
+
+// klTargetTerms returns the negative entropy of x, along
+// with a mask which is 1 wherever x is 0.
+//
+// Adding the mask to the actual distribution before
+// taking its log prevents log(0) for components whose
+// contribution is zeroed out anyway.
+func klTargetTerms(x linalg.Vector) (negEntropy float64, zeroMask linalg.Vector) {
+	zeroMask = make(linalg.Vector, len(x))
+	for i, p := range x {
+		if p == 0 {
+			zeroMask[i] = 1
+		} else {
+			negEntropy += p * math.Log(p)
+		}
+	}
+	return
+}
+
 // DotCost simply computes the negative of the dot
 // product of the actual and expected vectors.
 // This is equivalent to cross entropy cost when
@@ -242,8 +921,87 @@ func (_ SigmoidCECost) CostR(v autofunc.RVector, x linalg.Vector,
 	return autofunc.ScaleR(autofunc.SumAllR(sums), -1)
 }
 
+// FocalCost implements the focal loss from Lin et al.
+// (2017) for class-imbalanced binary classification.
+//
+// Like SigmoidCECost, it takes logits for the actual
+// vector and probabilities for the expected vector.
+// Each component's cross entropy is multiplied by
+// (1-p_t)^Gamma, where p_t is the probability assigned
+// to the correct label, so that well-classified examples
+// contribute less to the cost.
+//
+// If Alpha is non-zero, positive terms are further
+// weighted by Alpha and negative terms by 1-Alpha.
+// With Gamma=0 and Alpha=0, this is equivalent to
+// SigmoidCECost.
+type FocalCost struct {
+	Gamma float64
+	Alpha float64
+}
+
+func (f FocalCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logsig := autofunc.LogSigmoid{}
+		log := logsig.Apply(a)
+		invLog := logsig.Apply(autofunc.Scale(a, -1))
+
+		posWeight, negWeight := f.labelWeights(x)
+		posTerm := autofunc.Mul(&autofunc.Variable{Vector: posWeight}, log)
+		negTerm := autofunc.Mul(&autofunc.Variable{Vector: negWeight}, invLog)
+		if f.Gamma != 0 {
+			posTerm = autofunc.Mul(posTerm,
+				autofunc.Exp{}.Apply(autofunc.Scale(invLog, f.Gamma)))
+			negTerm = autofunc.Mul(negTerm,
+				autofunc.Exp{}.Apply(autofunc.Scale(log, f.Gamma)))
+		}
+		return autofunc.Scale(autofunc.SumAll(autofunc.Add(posTerm, negTerm)), -1)
+	})
+}
+
+func (f FocalCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		logsig := autofunc.LogSigmoid{}
+		log := logsig.ApplyR(v, a)
+		invLog := logsig.ApplyR(v, autofunc.ScaleR(a, -1))
+
+		posWeight, negWeight := f.labelWeights(x)
+		posVar := autofunc.NewRVariable(&autofunc.Variable{Vector: posWeight}, v)
+		negVar := autofunc.NewRVariable(&autofunc.Variable{Vector: negWeight}, v)
+		posTerm := autofunc.MulR(posVar, log)
+		negTerm := autofunc.MulR(negVar, invLog)
+		if f.Gamma != 0 {
+			posTerm = autofunc.MulR(posTerm,
+				autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(invLog, f.Gamma)))
+			negTerm = autofunc.MulR(negTerm,
+				autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(log, f.Gamma)))
+		}
+		return autofunc.ScaleR(autofunc.SumAllR(autofunc.AddR(posTerm, negTerm)), -1)
+	})
+}
+
+// labelWeights returns the coefficients of the positive
+// and negative log-likelihood terms for each component.
+func (f FocalCost) labelWeights(x linalg.Vector) (pos, neg linalg.Vector) {
+	pos = x.Copy()
+	neg = x.Copy().Scale(-1)
+	for i := range neg {
+		neg[i]++
+	}
+	if f.Alpha != 0 {
+		pos.Scale(f.Alpha)
+		neg.Scale(1 - f.Alpha)
+	}
+	return
+}
+
 // RegularizingCost adds onto another cost function
 // the squared magnitudes of various variables.
+//
+// If L1Penalty is non-zero, the absolute values of the
+// variables' components are added as well, giving an
+// elastic net penalty.
 type RegularizingCost struct {
 	Variables []*autofunc.Variable
 
@@ -251,6 +1009,17 @@ type RegularizingCost struct {
 	// magnitudes of the regularized variables.
 	Penalty float64
 
+	// L1Penalty is used as a coefficient for the
+	// sums of absolute values of the regularized
+	// variables.
+	L1Penalty float64
+
+	// Filter, if non-nil, decides which of the
+	// Variables are regularized.
+	// Variables for which it returns false (e.g. biases)
+	// are left out of the penalty.
+	Filter func(*autofunc.Variable) bool
+
 	CostFunc CostFunc
 }
 
@@ -258,19 +1027,46 @@ func (r *RegularizingCost) Cost(a linalg.Vector, x autofunc.Result) autofunc.Res
 	regFunc := autofunc.SquaredNorm{}
 	cost := r.CostFunc.Cost(a, x)
 	for _, variable := range r.Variables {
+		if r.Filter != nil && !r.Filter(variable) {
+			continue
+		}
 		norm := regFunc.Apply(variable)
 		cost = autofunc.Add(cost, autofunc.Scale(norm, r.Penalty))
+		if r.L1Penalty != 0 {
+			zero := make(linalg.Vector, len(variable.Vector))
+			l1 := AbsCost{}.Cost(zero, variable)
+			cost = autofunc.Add(cost, autofunc.Scale(l1, r.L1Penalty))
+		}
 	}
 	return cost
 }
 
+// CostContributions returns the contributions of
+// CostFunc followed by one extra element for the total
+// regularization penalty, which does not belong to any
+// output component.
+func (r *RegularizingCost) CostContributions(a linalg.Vector, x autofunc.Result) linalg.Vector {
+	contribs := CostContributions(r.CostFunc, a, x)
+	penalty := r.Cost(a, x).Output()[0] - r.CostFunc.Cost(a, x).Output()[0]
+	return append(contribs.Copy(), penalty)
+}
+
 func (r *RegularizingCost) CostR(v autofunc.RVector, a linalg.Vector,
 	x autofunc.RResult) autofunc.RResult {
 	regFunc := autofunc.SquaredNorm{}
 	cost := r.CostFunc.CostR(v, a, x)
 	for _, variable := range r.Variables {
-		norm := regFunc.ApplyR(v, autofunc.NewRVariable(variable, v))
+		if r.Filter != nil && !r.Filter(variable) {
+			continue
+		}
+		rVar := autofunc.NewRVariable(variable, v)
+		norm := regFunc.ApplyR(v, rVar)
 		cost = autofunc.AddR(cost, autofunc.ScaleR(norm, r.Penalty))
+		if r.L1Penalty != 0 {
+			zero := make(linalg.Vector, len(variable.Vector))
+			l1 := AbsCost{}.CostR(v, zero, rVar)
+			cost = autofunc.AddR(cost, autofunc.ScaleR(l1, r.L1Penalty))
+		}
 	}
 	return cost
 }
@@ -3,6 +3,7 @@ package neuralnet
 import (
 	"math"
 	"math/rand"
+	"runtime"
 	"testing"
 
 	"github.com/unixpickle/autofunc"
@@ -23,6 +24,32 @@ func (m meanSquaredTestFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) aut
 	return MeanSquaredCost{}.CostR(v, m.Expected, in)
 }
 
+type costFuncTestFunc struct {
+	Cost     CostFunc
+	Expected linalg.Vector
+}
+
+func (c costFuncTestFunc) Apply(in autofunc.Result) autofunc.Result {
+	return c.Cost.Cost(c.Expected, in)
+}
+
+func (c costFuncTestFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return c.Cost.CostR(v, c.Expected, in)
+}
+
+// checkCostFuncGradients verifies the gradients and
+// r-gradients of a CostFunc at the given point.
+func checkCostFuncGradients(t *testing.T, c CostFunc, expected, actual linalg.Vector) {
+	actualVar := &autofunc.Variable{Vector: actual}
+	funcTest := &functest.RFuncChecker{
+		F:     costFuncTestFunc{Cost: c, Expected: expected},
+		Vars:  []*autofunc.Variable{actualVar},
+		Input: actualVar,
+		RV:    autofunc.RVector{actualVar: linalg.RandVector(len(actual))},
+	}
+	funcTest.FullCheck(t)
+}
+
 func TestMeanSquaredCostGradient(t *testing.T) {
 	actual := &autofunc.Variable{make(linalg.Vector, 10)}
 	expected := make(linalg.Vector, len(actual.Vector))
@@ -56,6 +83,122 @@ func TestMeanSquaredCostRGradient(t *testing.T) {
 	funcTest.FullCheck(t)
 }
 
+func TestTotalCost(t *testing.T) {
+	net := Network{NewDenseLayer(2, 3)}
+	samples := totalCostTestSamples(1000, 2, 3)
+	cf := MeanSquaredCost{}
+
+	var expected float64
+	for _, s := range samples {
+		vs := s.(VectorSample)
+		expected += cf.Cost(vs.Output, net.Apply(&autofunc.Variable{Vector: vs.Input})).Output()[0]
+	}
+
+	n := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(n)
+	var first float64
+	for i, procs := range []int{1, 2, 4} {
+		runtime.GOMAXPROCS(procs)
+		actual := TotalCost(cf, net, samples)
+		if math.Abs(actual-expected) > 1e-5 {
+			t.Errorf("GOMAXPROCS %d: expected %v got %v", procs, expected, actual)
+		}
+		if i == 0 {
+			first = actual
+		} else if actual != first {
+			t.Errorf("GOMAXPROCS %d: got %v but GOMAXPROCS 1 gave %v", procs, actual, first)
+		}
+	}
+}
+
+func TestSampleCosts(t *testing.T) {
+	net := Network{NewDenseLayer(2, 3)}
+	samples := totalCostTestSamples(150, 2, 3)
+	cf := MeanSquaredCost{}
+
+	costs := SampleCosts(cf, net, samples)
+	if len(costs) != len(samples) {
+		t.Fatalf("expected %d costs but got %d", len(samples), len(costs))
+	}
+	var sum float64
+	for i, s := range samples {
+		vs := s.(VectorSample)
+		exp := cf.Cost(vs.Output, net.Apply(&autofunc.Variable{Vector: vs.Input})).Output()[0]
+		if costs[i] != exp {
+			t.Errorf("sample %d: expected %v got %v", i, exp, costs[i])
+		}
+		sum += costs[i]
+	}
+	if total := TotalCost(cf, net, samples); math.Abs(total-sum) > 1e-8 {
+		t.Errorf("costs sum to %v but TotalCost gave %v", sum, total)
+	}
+}
+
+type taggedTestSample struct {
+	Tag    string
+	Sample VectorSample
+}
+
+func TestTotalCostFunc(t *testing.T) {
+	net := Network{NewDenseLayer(2, 3)}
+	samples := totalCostTestSamples(150, 2, 3)
+	tagged := make(sgd.SliceSampleSet, len(samples))
+	for i, s := range samples {
+		tagged[i] = taggedTestSample{Tag: "sample", Sample: s.(VectorSample)}
+	}
+	extract := func(s interface{}) (input, output linalg.Vector) {
+		ts := s.(taggedTestSample)
+		return ts.Sample.Input, ts.Sample.Output
+	}
+	cf := MeanSquaredCost{}
+	expected := TotalCost(cf, net, samples)
+	if actual := TotalCostFunc(cf, net, tagged, extract); actual != expected {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func BenchmarkTotalCostSerial(b *testing.B) {
+	n := runtime.GOMAXPROCS(0)
+	runtime.GOMAXPROCS(1)
+	benchmarkTotalCost(b)
+	runtime.GOMAXPROCS(n)
+}
+
+func BenchmarkTotalCostParallel(b *testing.B) {
+	benchmarkTotalCost(b)
+}
+
+func benchmarkTotalCost(b *testing.B) {
+	net := Network{NewDenseLayer(50, 100), NewDenseLayer(100, 10)}
+	samples := totalCostTestSamples(10000, 50, 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		TotalCost(MeanSquaredCost{}, net, samples)
+	}
+}
+
+func BenchmarkTotalCostBatcher(b *testing.B) {
+	net := Network{NewDenseLayer(50, 100), NewDenseLayer(100, 10)}
+	samples := totalCostTestSamples(1000, 50, 10)
+	batcher := net.BatchLearner()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		TotalCostBatcher(MeanSquaredCost{}, batcher, samples, 32)
+	}
+}
+
+func totalCostTestSamples(count, inSize, outSize int) sgd.SliceSampleSet {
+	samples := make(sgd.SliceSampleSet, count)
+	for i := range samples {
+		samples[i] = VectorSample{
+			Input:  linalg.RandVector(inSize),
+			Output: linalg.RandVector(outSize),
+		}
+	}
+	return samples
+}
+
 func TestTotalCostBatcher(t *testing.T) {
 	net := Network{NewDenseLayer(2, 3)}
 	samples := sgd.SliceSampleSet{
@@ -74,3 +217,488 @@ func TestTotalCostBatcher(t *testing.T) {
 		}
 	}
 }
+
+func TestTotalCostMatrix(t *testing.T) {
+	net := Network{NewDenseLayer(2, 3)}
+	samples := totalCostTestSamples(7, 2, 3)
+	for _, cf := range []CostFunc{MeanSquaredCost{}, softmaxCETestCost{}} {
+		expected := TotalCost(cf, net, samples)
+		for _, batchSize := range []int{1, 0, 3, 10} {
+			actual := TotalCostMatrix(cf, net.BatchLearner(), samples, batchSize)
+			if math.Abs(actual-expected) > 1e-5 {
+				t.Errorf("%T batch %d: expected %v got %v", cf, batchSize, expected, actual)
+			}
+		}
+	}
+}
+
+type softmaxCETestCost struct{}
+
+func (_ softmaxCETestCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return DotCost{}.Cost(x, (&LogSoftmaxLayer{}).Apply(a))
+}
+
+func (_ softmaxCETestCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return DotCost{}.CostR(v, x, (&LogSoftmaxLayer{}).ApplyR(v, a))
+}
+
+type batchCostTestFunc struct {
+	Cost     CostFunc
+	Expected linalg.Vector
+	N        int
+}
+
+func (b batchCostTestFunc) Apply(in autofunc.Result) autofunc.Result {
+	return BatchCost(b.Cost, b.Expected, in, b.N)
+}
+
+func (b batchCostTestFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return BatchCostR(v, b.Cost, b.Expected, in, b.N)
+}
+
+func TestBatchCost(t *testing.T) {
+	expected := linalg.Vector{1, 0, 0, 0, 0, 1, 0, 1, 0}
+	actual := linalg.Vector{0.2, -0.5, 1, 0.3, 0.7, -1, 0.1, 0.4, 0.9}
+	for _, cf := range []CostFunc{MeanSquaredCost{}, AbsCost{}, softmaxCETestCost{}} {
+		var exp float64
+		for i := 0; i < 3; i++ {
+			a := &autofunc.Variable{Vector: actual[i*3 : (i+1)*3]}
+			exp += cf.Cost(expected[i*3:(i+1)*3], a).Output()[0]
+		}
+		a := &autofunc.Variable{Vector: actual}
+		if c := BatchCost(cf, expected, a, 3).Output()[0]; math.Abs(c-exp) > 1e-10 {
+			t.Errorf("%T: expected %f but got %f", cf, exp, c)
+		}
+
+		actualVar := &autofunc.Variable{Vector: actual.Copy()}
+		funcTest := &functest.RFuncChecker{
+			F:     batchCostTestFunc{Cost: cf, Expected: expected, N: 3},
+			Vars:  []*autofunc.Variable{actualVar},
+			Input: actualVar,
+			RV:    autofunc.RVector{actualVar: linalg.RandVector(len(actual))},
+		}
+		funcTest.FullCheck(t)
+	}
+
+	probs := linalg.Vector{0.2, 0.5, 0.3, 0.6, 0.1, 0.3}
+	var exp float64
+	for i := 0; i < 2; i++ {
+		a := &autofunc.Variable{Vector: probs[i*3 : (i+1)*3]}
+		exp += CrossEntropyCost{}.Cost(expected[i*3:(i+1)*3], a).Output()[0]
+	}
+	a := &autofunc.Variable{Vector: probs}
+	c := BatchCost(CrossEntropyCost{}, expected[:6], a, 2).Output()[0]
+	if math.Abs(c-exp) > 1e-10 {
+		t.Errorf("CrossEntropyCost: expected %f but got %f", exp, c)
+	}
+}
+
+func TestMeanCostBatcher(t *testing.T) {
+	net := Network{NewDenseLayer(2, 3)}
+	samples := sgd.SliceSampleSet{
+		VectorSample{Input: []float64{1, -1}, Output: []float64{1, 0, 0}},
+		VectorSample{Input: []float64{1, 1}, Output: []float64{0, 1, 0}},
+		VectorSample{Input: []float64{-1, -1}, Output: []float64{0, 0, 1}},
+		VectorSample{Input: []float64{-1, 1}, Output: []float64{0, 1, 0}},
+		VectorSample{Input: []float64{0.5, 0.75}, Output: []float64{1, 0, 0}},
+	}
+	cf := softmaxCETestCost{}
+	expected := TotalCost(cf, net, samples) / float64(samples.Len())
+	for _, batchSize := range []int{1, 0, 3, 5, 10} {
+		actual := MeanCostBatcher(cf, net.BatchLearner(), samples, batchSize)
+		if math.Abs(actual-expected) > 1e-5 {
+			t.Errorf("batch %d: expected %v got %v", batchSize, expected, actual)
+		}
+	}
+
+	// A softmax over the concatenated outputs mixes the
+	// samples together, so the two functions must differ.
+	concatenated := TotalCostBatcher(cf, net.BatchLearner(), samples, 0) /
+		float64(samples.Len())
+	if math.Abs(concatenated-expected) < 1e-5 {
+		t.Errorf("concatenated cost %v should differ from per-sample cost %v",
+			concatenated, expected)
+	}
+}
+
+func TestLogCoshCost(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.3, -2.5, 0.5}}
+	exp := math.Log(math.Cosh(0.3)) + math.Log(math.Cosh(-0.5))
+	if c := (LogCoshCost{}).Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	// For huge residuals, log(cosh(z)) is |z|-log(2).
+	huge := &autofunc.Variable{Vector: linalg.Vector{1001, -2000, 0.5}}
+	exp = 1000 + 1998 - 2*math.Ln2
+	if c := (LogCoshCost{}).Cost(expected, huge).Output()[0]; math.Abs(c-exp) > 1e-8 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	checkCostFuncGradients(t, LogCoshCost{}, expected, linalg.Vector{1.3, -2.5, 0.4})
+	checkCostFuncGradients(t, LogCoshCost{}, expected, linalg.Vector{1001, -2000, 40})
+}
+
+func TestMaxAbsCost(t *testing.T) {
+	expected := linalg.Vector{1, 2, 3, 4}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, 0, 3.1, 6}}
+	out := MaxAbsCost{}.Cost(expected, actual)
+	if out.Output()[0] != 2 {
+		t.Errorf("expected cost 2 but got %f", out.Output()[0])
+	}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+
+	// The second and last components tie, so only the
+	// first of them receives a gradient.
+	expGrad := linalg.Vector{0, -1, 0, 0}
+	for i, x := range expGrad {
+		if grad[actual][i] != x {
+			t.Errorf("gradient %d: expected %f but got %f", i, x, grad[actual][i])
+		}
+	}
+
+	checkCostFuncGradients(t, MaxAbsCost{}, expected, linalg.Vector{1.5, 0.5, 3.1, 3})
+}
+
+func TestHuberCost(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5, 3}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, -5, 0.3, 3}}
+
+	// Residuals are 0.5, -3, -0.2, and 0.
+	cost := HuberCost{Delta: 1}.Cost(expected, actual).Output()[0]
+	if exp := 0.125 + 2.5 + 0.02; math.Abs(cost-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, cost)
+	}
+
+	abs := AbsCost{}.Cost(expected, actual).Output()[0]
+	if c := (HuberCost{}).Cost(expected, actual).Output()[0]; math.Abs(c-abs) > 1e-10 {
+		t.Errorf("Delta=0: expected %f but got %f", abs, c)
+	}
+
+	for _, delta := range []float64{0, 0.5, 1} {
+		checkCostFuncGradients(t, HuberCost{Delta: delta}, expected,
+			linalg.Vector{1.4, -5, 0.3, 3.1})
+	}
+}
+
+func TestSmoothL1Cost(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5, 3}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, -5, 0.3, 3}}
+
+	// Residuals are 0.5, -3, -0.2, and 0.
+	if c := (SmoothL1Cost{}).Cost(expected, actual).Output()[0]; math.Abs(c-2.645) > 1e-10 {
+		t.Errorf("expected 2.645 but got %f", c)
+	}
+	checkCostFuncGradients(t, SmoothL1Cost{}, expected, linalg.Vector{1.4, -5, 0.3, 3.1})
+
+	// The value and derivative are continuous at z=1.
+	costAt := func(z float64) (float64, float64) {
+		actual := &autofunc.Variable{Vector: linalg.Vector{z}}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		out := SmoothL1Cost{}.Cost(linalg.Vector{0}, actual)
+		out.PropagateGradient(linalg.Vector{1}, grad)
+		return out.Output()[0], grad[actual][0]
+	}
+	below, belowDeriv := costAt(1 - 1e-9)
+	at, atDeriv := costAt(1)
+	if math.Abs(below-0.5) > 1e-8 || math.Abs(at-0.5) > 1e-8 {
+		t.Errorf("expected 0.5 on both sides of z=1 but got %f and %f", below, at)
+	}
+	if math.Abs(belowDeriv-1) > 1e-8 || math.Abs(atDeriv-1) > 1e-8 {
+		t.Errorf("expected derivative 1 on both sides of z=1 but got %f and %f",
+			belowDeriv, atDeriv)
+	}
+}
+
+func TestCrossEntropyCostEpsilon(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1, 0}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0, 1, 1, 0.3}}
+	cost := CrossEntropyCost{Epsilon: 1e-6}
+
+	out := cost.Cost(expected, actual)
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	if c := out.Output()[0]; math.IsNaN(c) || math.IsInf(c, 0) {
+		t.Errorf("expected finite cost but got %f", c)
+	}
+	for i, g := range grad[actual] {
+		if math.IsNaN(g) || math.IsInf(g, 0) {
+			t.Errorf("gradient %d: expected finite value but got %f", i, g)
+		}
+	}
+
+	exp := -2*math.Log(1e-6) - math.Log(1-1e-6) - math.Log(0.7)
+	if c := out.Output()[0]; math.Abs(c-exp) > 1e-6 {
+		t.Errorf("expected cost %f but got %f", exp, c)
+	}
+
+	inRange := linalg.Vector{0.2, 0.6, 0.9, 0.3}
+	plain := CrossEntropyCost{}.Cost(expected, &autofunc.Variable{Vector: inRange})
+	clipped := cost.Cost(expected, &autofunc.Variable{Vector: inRange})
+	if plain.Output()[0] != clipped.Output()[0] {
+		t.Errorf("clipping changed in-range cost from %f to %f", plain.Output()[0],
+			clipped.Output()[0])
+	}
+	checkCostFuncGradients(t, cost, expected, inRange)
+}
+
+func TestKLDivergenceCost(t *testing.T) {
+	expected := linalg.Vector{0.5, 0, 0.3, 0.2}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.4, 0.1, 0.3, 0.2}}
+	exp := 0.5 * math.Log(0.5/0.4)
+	if c := (KLDivergenceCost{}).Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	same := &autofunc.Variable{Vector: expected.Copy()}
+	if c := (KLDivergenceCost{}).Cost(expected, same).Output()[0]; math.Abs(c) > 1e-10 {
+		t.Errorf("expected zero cost for identical distributions but got %f", c)
+	}
+
+	// A zero in both distributions must not produce NaNs.
+	zero := &autofunc.Variable{Vector: linalg.Vector{0.5, 0, 0.3, 0.2}}
+	out := KLDivergenceCost{}.Cost(expected, zero)
+	grad := autofunc.NewGradient([]*autofunc.Variable{zero})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	if math.IsNaN(out.Output()[0]) || math.IsNaN(grad[zero][1]) {
+		t.Error("unexpected NaN for zero probabilities")
+	}
+
+	checkCostFuncGradients(t, KLDivergenceCost{}, expected, actual.Vector)
+}
+
+func TestFocalCost(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1, 0, 0.3}
+	logits := linalg.Vector{2, -1.5, -0.5, 0.7, 0.1}
+	actual := &autofunc.Variable{Vector: logits}
+
+	sigmoidCE := SigmoidCECost{}.Cost(expected, actual).Output()[0]
+	if c := (FocalCost{}).Cost(expected, actual).Output()[0]; math.Abs(c-sigmoidCE) > 1e-10 {
+		t.Errorf("Gamma=0: expected %f but got %f", sigmoidCE, c)
+	}
+
+	var exp float64
+	for i, y := range expected {
+		p := 1 / (1 + math.Exp(-logits[i]))
+		exp -= 0.25*y*math.Pow(1-p, 2)*math.Log(p) +
+			0.75*(1-y)*math.Pow(p, 2)*math.Log(1-p)
+	}
+	focal := FocalCost{Gamma: 2, Alpha: 0.25}
+	if c := focal.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("Gamma=2: expected %f but got %f", exp, c)
+	}
+
+	for _, gamma := range []float64{0, 1, 2} {
+		checkCostFuncGradients(t, FocalCost{Gamma: gamma}, expected, logits)
+		checkCostFuncGradients(t, FocalCost{Gamma: gamma, Alpha: 0.25}, expected, logits)
+	}
+}
+
+func TestPNormCost(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5, 3}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.3, -1, 1.2, 3}}
+
+	abs := AbsCost{}.Cost(expected, actual).Output()[0]
+	if c := (PNormCost{P: 1}).Cost(expected, actual).Output()[0]; math.Abs(c-abs) > 1e-10 {
+		t.Errorf("P=1: expected %f but got %f", abs, c)
+	}
+	mse := MeanSquaredCost{}.Cost(expected, actual).Output()[0]
+	if c := (PNormCost{P: 2}).Cost(expected, actual).Output()[0]; math.Abs(c-mse) > 1e-10 {
+		t.Errorf("P=2: expected %f but got %f", mse, c)
+	}
+
+	for _, p := range []float64{1, 1.5, 2, 3.5} {
+		checkCostFuncGradients(t, PNormCost{P: p}, expected, linalg.Vector{0.3, -1, 1.2, 2.5})
+	}
+
+	// A zero residual must not produce NaNs or infinities.
+	zero := autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{1}},
+		autofunc.RVector{})
+	out := PNormCost{P: 1.5}.CostR(autofunc.RVector{}, linalg.Vector{1}, zero)
+	rgrad := autofunc.NewRGradient([]*autofunc.Variable{zero.Variable})
+	grad := autofunc.NewGradient([]*autofunc.Variable{zero.Variable})
+	out.PropagateRGradient(linalg.Vector{1}, linalg.Vector{0}, rgrad, grad)
+	if math.IsNaN(grad[zero.Variable][0]) || math.IsNaN(rgrad[zero.Variable][0]) {
+		t.Errorf("zero residual gave NaN gradients")
+	}
+}
+
+func TestRegularizingCostL1(t *testing.T) {
+	weights := &autofunc.Variable{Vector: linalg.Vector{0.5, -2, 1.5}}
+	expected := linalg.Vector{1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, 0}}
+	vars := []*autofunc.Variable{weights, actual}
+
+	l2 := &RegularizingCost{Variables: []*autofunc.Variable{weights}, Penalty: 0.1,
+		CostFunc: MeanSquaredCost{}}
+	baseline := MeanSquaredCost{}.Cost(expected, actual).Output()[0] + 0.1*6.5
+	if c := l2.Cost(expected, actual).Output()[0]; math.Abs(c-baseline) > 1e-10 {
+		t.Errorf("L2 only: expected %f but got %f", baseline, c)
+	}
+
+	elastic := &RegularizingCost{Variables: []*autofunc.Variable{weights}, Penalty: 0.1,
+		L1Penalty: 0.3, CostFunc: MeanSquaredCost{}}
+	expCost := baseline + 0.3*4
+	if c := elastic.Cost(expected, actual).Output()[0]; math.Abs(c-expCost) > 1e-10 {
+		t.Errorf("elastic: expected %f but got %f", expCost, c)
+	}
+
+	grad := autofunc.NewGradient(vars)
+	elastic.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	expGrad := linalg.Vector{2*0.1*0.5 + 0.3, 2*0.1*-2 - 0.3, 2*0.1*1.5 + 0.3}
+	for i, x := range expGrad {
+		if math.Abs(grad[weights][i]-x) > 1e-10 {
+			t.Errorf("weight %d: expected gradient %f but got %f", i, x, grad[weights][i])
+		}
+	}
+
+	rv := autofunc.RVector{weights: linalg.Vector{1, 0.5, -1}, actual: linalg.Vector{0, 0}}
+	out := elastic.CostR(rv, expected, autofunc.NewRVariable(actual, rv))
+	if math.Abs(out.Output()[0]-expCost) > 1e-10 {
+		t.Errorf("elastic R: expected %f but got %f", expCost, out.Output()[0])
+	}
+	expR := 0.1*2*(0.5-1-1.5) + 0.3*(1-0.5-1)
+	if math.Abs(out.ROutput()[0]-expR) > 1e-10 {
+		t.Errorf("elastic R: expected R output %f but got %f", expR, out.ROutput()[0])
+	}
+}
+
+func TestRegularizingCostFilter(t *testing.T) {
+	weights := &autofunc.Variable{Vector: linalg.Vector{0.5, -2, 1.5}}
+	biases := &autofunc.Variable{Vector: linalg.Vector{3}}
+	expected := linalg.Vector{1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, 0}}
+	vars := []*autofunc.Variable{weights, biases}
+
+	cost := &RegularizingCost{
+		Variables: vars,
+		Penalty:   0.1,
+		L1Penalty: 0.3,
+		Filter: func(v *autofunc.Variable) bool {
+			return len(v.Vector) > 1
+		},
+		CostFunc: MeanSquaredCost{},
+	}
+	exp := MeanSquaredCost{}.Cost(expected, actual).Output()[0] + 0.1*6.5 + 0.3*4
+	if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+	rv := autofunc.RVector{}
+	costR := cost.CostR(rv, expected, autofunc.NewRVariable(actual, rv))
+	if c := costR.Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected R cost %f but got %f", exp, c)
+	}
+
+	grad := autofunc.NewGradient(vars)
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	if grad[biases][0] != 0 {
+		t.Errorf("expected no bias gradient but got %f", grad[biases][0])
+	}
+
+	cost.Filter = nil
+	exp += 0.1*9 + 0.3*3
+	if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("nil filter: expected %f but got %f", exp, c)
+	}
+}
+
+func TestPoissonCost(t *testing.T) {
+	expected := linalg.Vector{0, 3, 1, 7}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, 2, 1, 6.5}}
+	var exp float64
+	for i, x := range expected {
+		a := actual.Vector[i]
+		exp += a - x*math.Log(a)
+	}
+	if c := (PoissonCost{}).Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-6 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	PoissonCost{}.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	for i, x := range expected {
+		expGrad := 1 - x/actual.Vector[i]
+		if math.Abs(grad[actual][i]-expGrad) > 1e-6 {
+			t.Errorf("component %d: expected gradient %f but got %f", i, expGrad,
+				grad[actual][i])
+		}
+	}
+	checkCostFuncGradients(t, PoissonCost{}, expected, actual.Vector)
+
+	zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+	if c := (PoissonCost{}).Cost(linalg.Vector{2}, zero).Output()[0]; math.IsInf(c, 0) {
+		t.Error("zero rate gave an infinite cost")
+	}
+}
+
+func TestCostContributions(t *testing.T) {
+	expected := linalg.Vector{1, 2, 3}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, 2, 1}}
+	contribs := CostContributions(MeanSquaredCost{}, expected, actual)
+	expContribs := []float64{0.25, 0, 4}
+	if len(contribs) != len(expContribs) {
+		t.Fatalf("expected %d contributions but got %d", len(expContribs), len(contribs))
+	}
+	var sum float64
+	for i, x := range expContribs {
+		if math.Abs(contribs[i]-x) > 1e-10 {
+			t.Errorf("contribution %d: expected %f but got %f", i, x, contribs[i])
+		}
+		sum += contribs[i]
+	}
+	total := MeanSquaredCost{}.Cost(expected, actual).Output()[0]
+	if math.Abs(sum-total) > 1e-10 {
+		t.Errorf("contributions sum to %f but total is %f", sum, total)
+	}
+
+	whole := CostContributions(MaxAbsCost{}, expected, actual)
+	if len(whole) != 1 || whole[0] != 2 {
+		t.Errorf("non-decomposable cost should give [2] but got %v", whole)
+	}
+}
+
+func TestCostContributionsComposite(t *testing.T) {
+	expected := linalg.Vector{1, 2, 3}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, 2, 1}}
+	mse := linalg.Vector{0.25, 0, 4}
+	checkContribs := func(name string, c CostFunc, exp linalg.Vector) {
+		contribs := CostContributions(c, expected, actual)
+		if len(contribs) != len(exp) {
+			t.Errorf("%s: expected %v but got %v", name, exp, contribs)
+			return
+		}
+		for i, x := range exp {
+			if math.Abs(contribs[i]-x) > 1e-10 {
+				t.Errorf("%s: expected %v but got %v", name, exp, contribs)
+				break
+			}
+		}
+	}
+
+	checkContribs("pointer", &MeanSquaredCost{}, mse)
+
+	scheduler := &WeightedCostScheduler{
+		Components: []ScheduledCostComponent{
+			{Name: "mse", CostFunc: MeanSquaredCost{}, Weight: 2},
+			{Name: "abs", CostFunc: AbsCost{}, Weight: 1},
+		},
+	}
+	checkContribs("scheduler", scheduler, linalg.Vector{1, 0, 10})
+
+	composite := CompositeCost{
+		{CostFunc: MeanSquaredCost{}, Weight: 1, OutputRange: [2]int{0, 1}},
+		{CostFunc: AbsCost{}, Weight: 3, OutputRange: [2]int{1, 3}},
+	}
+	checkContribs("composite", composite, linalg.Vector{0.25, 0, 6})
+
+	param := &autofunc.Variable{Vector: linalg.Vector{1, -2}}
+	reg := &RegularizingCost{
+		Variables: []*autofunc.Variable{param},
+		Penalty:   0.5,
+		CostFunc:  MeanSquaredCost{},
+	}
+	checkContribs("regularizing", reg, linalg.Vector{0.25, 0, 4, 2.5})
+}
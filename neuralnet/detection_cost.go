@@ -0,0 +1,425 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// YOLOLoss is a composite cost for YOLO-style object
+// detection heads.
+//
+// The actual vector is divided into GridSize*GridSize
+// cells in row-major order, each of which is divided
+// into NumAnchors anchor slots.
+// Each anchor slot contains 4 box coordinates, 1
+// objectness value, and NumClasses class values.
+//
+// The expected vector has the same layout and encodes
+// the target assignment: the objectness target of an
+// anchor slot is 1 if that slot is responsible for an
+// object and 0 otherwise, and the box and class entries
+// of responsible slots hold the object's box and one-hot
+// class.
+// The box and class entries of other slots are ignored.
+//
+// BoxCost and ClassCost are only applied to responsible
+// slots.
+// ObjCost is applied to every slot, since the detector
+// must also learn to predict the absence of objects.
+type YOLOLoss struct {
+	BoxCost   CostFunc
+	ObjCost   CostFunc
+	ClassCost CostFunc
+
+	GridSize   int
+	NumAnchors int
+	NumClasses int
+}
+
+func (y YOLOLoss) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	y.checkSizes(x, a.Output())
+	stride := y.slotSize()
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		var costs []autofunc.Result
+		for base := 0; base < len(x); base += stride {
+			objIdx := base + 4
+			costs = append(costs, y.ObjCost.Cost(x[objIdx:objIdx+1],
+				autofunc.Slice(a, objIdx, objIdx+1)))
+			if x[objIdx] == 0 {
+				continue
+			}
+			costs = append(costs, y.BoxCost.Cost(x[base:objIdx],
+				autofunc.Slice(a, base, objIdx)))
+			costs = append(costs, y.ClassCost.Cost(x[objIdx+1:base+stride],
+				autofunc.Slice(a, objIdx+1, base+stride)))
+		}
+		return autofunc.SumAll(autofunc.Concat(costs...))
+	})
+}
+
+func (y YOLOLoss) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	y.checkSizes(x, a.Output())
+	stride := y.slotSize()
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		var costs []autofunc.RResult
+		for base := 0; base < len(x); base += stride {
+			objIdx := base + 4
+			costs = append(costs, y.ObjCost.CostR(v, x[objIdx:objIdx+1],
+				autofunc.SliceR(a, objIdx, objIdx+1)))
+			if x[objIdx] == 0 {
+				continue
+			}
+			costs = append(costs, y.BoxCost.CostR(v, x[base:objIdx],
+				autofunc.SliceR(a, base, objIdx)))
+			costs = append(costs, y.ClassCost.CostR(v, x[objIdx+1:base+stride],
+				autofunc.SliceR(a, objIdx+1, base+stride)))
+		}
+		return autofunc.SumAllR(autofunc.ConcatR(costs...))
+	})
+}
+
+func (y YOLOLoss) slotSize() int {
+	return 5 + y.NumClasses
+}
+
+func (y YOLOLoss) checkSizes(x, a linalg.Vector) {
+	size := y.GridSize * y.GridSize * y.NumAnchors * y.slotSize()
+	if len(x) != size || len(a) != size {
+		panic("vector sizes must match the grid layout")
+	}
+}
+
+// A Box is an axis-aligned bounding box.
+type Box struct {
+	MinX, MinY float64
+	MaxX, MaxY float64
+}
+
+// Area returns the area of the box, or 0 if the box is
+// empty.
+func (b Box) Area() float64 {
+	if b.MaxX <= b.MinX || b.MaxY <= b.MinY {
+		return 0
+	}
+	return (b.MaxX - b.MinX) * (b.MaxY - b.MinY)
+}
+
+// IoU computes the intersection over union of two boxes.
+func (b Box) IoU(b1 Box) float64 {
+	inter := Box{
+		MinX: math.Max(b.MinX, b1.MinX),
+		MinY: math.Max(b.MinY, b1.MinY),
+		MaxX: math.Min(b.MaxX, b1.MaxX),
+		MaxY: math.Min(b.MaxY, b1.MaxY),
+	}.Area()
+	union := b.Area() + b1.Area() - inter
+	if union == 0 {
+		return 0
+	}
+	return inter / union
+}
+
+// MatchAnchors assigns ground-truth boxes to anchors.
+//
+// The result contains, for each anchor, the index of the
+// target with the highest IoU, or -1 if no target has an
+// IoU of at least iouThreshold with the anchor.
+// Afterwards, every target which was not assigned to any
+// anchor is force-assigned to the anchor with which it
+// has the highest IoU, so that it is not dropped.
+//
+// When a forced target wants an anchor which another
+// target already holds, the target with the higher IoU
+// keeps it, and the other one moves on to its next best
+// anchor.
+// Anchors held through the threshold are never lost
+// this way, since their holders already have the highest
+// IoU with them.
+// A target stays unassigned only if it overlaps no
+// anchor, or loses every anchor it overlaps.
+func MatchAnchors(anchors, targets []Box, iouThreshold float64) []int {
+	res := make([]int, len(anchors))
+	for i, anchor := range anchors {
+		res[i] = -1
+		bestIoU := iouThreshold
+		for j, target := range targets {
+			if iou := anchor.IoU(target); iou >= bestIoU {
+				bestIoU = iou
+				res[i] = j
+			}
+		}
+	}
+
+	anchorCounts := make([]int, len(targets))
+	for _, j := range res {
+		if j >= 0 {
+			anchorCounts[j]++
+		}
+	}
+	var queue []int
+	for j, count := range anchorCounts {
+		if count == 0 {
+			queue = append(queue, j)
+		}
+	}
+	tried := make([][]bool, len(targets))
+	for len(queue) > 0 {
+		j := queue[0]
+		queue = queue[1:]
+		if tried[j] == nil {
+			tried[j] = make([]bool, len(anchors))
+		}
+		for {
+			bestAnchor := -1
+			var bestIoU float64
+			for i, anchor := range anchors {
+				if iou := anchor.IoU(targets[j]); !tried[j][i] && iou > bestIoU {
+					bestIoU = iou
+					bestAnchor = i
+				}
+			}
+			if bestAnchor < 0 {
+				break
+			}
+			tried[j][bestAnchor] = true
+			holder := res[bestAnchor]
+			if holder >= 0 && anchors[bestAnchor].IoU(targets[holder]) >= bestIoU {
+				continue
+			}
+			res[bestAnchor] = j
+			if holder >= 0 {
+				anchorCounts[holder]--
+				if anchorCounts[holder] == 0 {
+					queue = append(queue, holder)
+				}
+			}
+			anchorCounts[j]++
+			break
+		}
+	}
+	return res
+}
+
+// SetPredictionCost implements the set prediction loss
+// used to train DETR (Carion et al., 2020).
+//
+// The actual vector contains a fixed number of
+// predictions, and the expected vector contains a
+// (possibly smaller) number of targets.
+// Each prediction and target consists of NumClasses+1
+// class entries followed by 4 box coordinates, where
+// the extra class is the "no object" class.
+// Target class entries are one-hot.
+//
+// Targets are matched to predictions with the Hungarian
+// algorithm, using ClassCost plus BoxCost as the cost of
+// each pairing.
+// Matched predictions then incur both costs, and every
+// unmatched prediction incurs ClassCost against the
+// "no object" class, scaled by NoObjectWeight.
+// The matching is treated as a constant when computing
+// gradients.
+type SetPredictionCost struct {
+	ClassCost      CostFunc
+	BoxCost        CostFunc
+	NoObjectWeight float64
+
+	NumClasses int
+}
+
+func (s SetPredictionCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	matches := s.match(x, a.Output())
+	slot := s.slotSize()
+	noObject := s.noObjectTarget()
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		var costs []autofunc.Result
+		for i, target := range matches {
+			pred := autofunc.Slice(a, i*slot, (i+1)*slot)
+			classPred := autofunc.Slice(pred, 0, s.NumClasses+1)
+			if target < 0 {
+				costs = append(costs, autofunc.Scale(s.ClassCost.Cost(noObject, classPred),
+					s.NoObjectWeight))
+				continue
+			}
+			t := x[target*slot : (target+1)*slot]
+			costs = append(costs, s.ClassCost.Cost(t[:s.NumClasses+1], classPred))
+			costs = append(costs, s.BoxCost.Cost(t[s.NumClasses+1:],
+				autofunc.Slice(pred, s.NumClasses+1, slot)))
+		}
+		return autofunc.SumAll(autofunc.Concat(costs...))
+	})
+}
+
+func (s SetPredictionCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	matches := s.match(x, a.Output())
+	slot := s.slotSize()
+	noObject := s.noObjectTarget()
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		var costs []autofunc.RResult
+		for i, target := range matches {
+			pred := autofunc.SliceR(a, i*slot, (i+1)*slot)
+			classPred := autofunc.SliceR(pred, 0, s.NumClasses+1)
+			if target < 0 {
+				costs = append(costs, autofunc.ScaleR(s.ClassCost.CostR(v, noObject, classPred),
+					s.NoObjectWeight))
+				continue
+			}
+			t := x[target*slot : (target+1)*slot]
+			costs = append(costs, s.ClassCost.CostR(v, t[:s.NumClasses+1], classPred))
+			costs = append(costs, s.BoxCost.CostR(v, t[s.NumClasses+1:],
+				autofunc.SliceR(pred, s.NumClasses+1, slot)))
+		}
+		return autofunc.SumAllR(autofunc.ConcatR(costs...))
+	})
+}
+
+// match returns, for each prediction, the index of the
+// matched target or -1 if the prediction is unmatched.
+func (s SetPredictionCost) match(x, a linalg.Vector) []int {
+	slot := s.slotSize()
+	if len(x)%slot != 0 || len(a)%slot != 0 || len(x) > len(a) {
+		panic("invalid prediction or target sizes")
+	}
+	numTargets, numPreds := len(x)/slot, len(a)/slot
+	costs := make([][]float64, numTargets)
+	for i := range costs {
+		t := x[i*slot : (i+1)*slot]
+		costs[i] = make([]float64, numPreds)
+		for j := range costs[i] {
+			pred := a[j*slot : (j+1)*slot]
+			classCost := s.ClassCost.Cost(t[:s.NumClasses+1],
+				&autofunc.Variable{Vector: pred[:s.NumClasses+1]})
+			boxCost := s.BoxCost.Cost(t[s.NumClasses+1:],
+				&autofunc.Variable{Vector: pred[s.NumClasses+1:]})
+			costs[i][j] = classCost.Output()[0] + boxCost.Output()[0]
+		}
+	}
+	res := make([]int, numPreds)
+	for i := range res {
+		res[i] = -1
+	}
+	for target, pred := range hungarianMatch(costs) {
+		res[pred] = target
+	}
+	return res
+}
+
+func (s SetPredictionCost) slotSize() int {
+	return s.NumClasses + 5
+}
+
+func (s SetPredictionCost) noObjectTarget() linalg.Vector {
+	res := make(linalg.Vector, s.NumClasses+1)
+	res[s.NumClasses] = 1
+	return res
+}
+
+// hungarianMatch solves the assignment problem for a
+// cost matrix with no more rows than columns.
+// It returns the column assigned to each row, such that
+// the total cost is minimized.
+//
+// Non-finite costs (e.g. from a cross-entropy on a zero
+// probability) are treated as a cost larger than that of
+// any assignment made of finite costs.
+func hungarianMatch(costs [][]float64) []int {
+	n := len(costs)
+	if n == 0 {
+		return nil
+	}
+	m := len(costs[0])
+	costs = finiteCosts(costs)
+
+	// This is the classic O(n^2*m) algorithm with row and
+	// column potentials, using 1-based indices so that
+	// column 0 can act as a sentinel.
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		used := make([]bool, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for {
+			used[j0] = true
+			i0 := p[j0]
+			delta := math.Inf(1)
+			j1 := 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				cur := costs[i0-1][j-1] - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	res := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			res[p[j]-1] = j - 1
+		}
+	}
+	return res
+}
+
+// finiteCosts replaces the non-finite entries of a cost
+// matrix with a value that exceeds the total of any n
+// finite entries, where n is the number of rows.
+func finiteCosts(costs [][]float64) [][]float64 {
+	var maxAbs float64
+	for _, row := range costs {
+		for _, x := range row {
+			if !math.IsInf(x, 0) && !math.IsNaN(x) {
+				maxAbs = math.Max(maxAbs, math.Abs(x))
+			}
+		}
+	}
+	replacement := (maxAbs + 1) * float64(2*len(costs)+1)
+	res := make([][]float64, len(costs))
+	for i, row := range costs {
+		res[i] = make([]float64, len(row))
+		for j, x := range row {
+			if math.IsInf(x, 0) || math.IsNaN(x) {
+				res[i][j] = replacement
+			} else {
+				res[i][j] = x
+			}
+		}
+	}
+	return res
+}
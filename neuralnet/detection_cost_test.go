@@ -0,0 +1,184 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestYOLOLossSingleObject(t *testing.T) {
+	loss := YOLOLoss{
+		BoxCost:    MeanSquaredCost{},
+		ObjCost:    SigmoidCECost{},
+		ClassCost:  SigmoidCECost{},
+		GridSize:   2,
+		NumAnchors: 1,
+		NumClasses: 2,
+	}
+
+	// The object lives in the third cell and is of class 1.
+	expected := make(linalg.Vector, 4*7)
+	copy(expected[14:], []float64{0.5, 0.5, 0.2, 0.3, 1, 0, 1})
+	actual := linalg.RandVector(len(expected))
+
+	var exp float64
+	for cell := 0; cell < 4; cell++ {
+		base := cell * 7
+		z := actual[base+4]
+		if cell == 2 {
+			exp -= math.Log(1 / (1 + math.Exp(-z)))
+			for i := 0; i < 4; i++ {
+				diff := actual[base+i] - expected[base+i]
+				exp += diff * diff
+			}
+			exp -= math.Log(1 / (1 + math.Exp(actual[base+5])))
+			exp -= math.Log(1 / (1 + math.Exp(-actual[base+6])))
+		} else {
+			exp -= math.Log(1 / (1 + math.Exp(z)))
+		}
+	}
+	cost := loss.Cost(expected, &autofunc.Variable{Vector: actual}).Output()[0]
+	if math.Abs(cost-exp) > 1e-8 {
+		t.Errorf("expected %f but got %f", exp, cost)
+	}
+
+	// Box and class outputs of empty cells are ignored.
+	actual[0] += 10
+	actual[6] -= 10
+	newCost := loss.Cost(expected, &autofunc.Variable{Vector: actual}).Output()[0]
+	if math.Abs(newCost-cost) > 1e-8 {
+		t.Errorf("empty-cell outputs changed the cost from %f to %f", cost, newCost)
+	}
+
+	checkCostFuncGradients(t, loss, expected, actual)
+}
+
+func TestMatchAnchors(t *testing.T) {
+	anchors := []Box{
+		{0, 0, 2, 2},
+		{1, 1, 3, 3},
+		{5, 5, 6, 6},
+		{10, 10, 11, 11},
+	}
+	targets := []Box{
+		{0, 0, 2, 1.8},
+		{1.2, 1.2, 3, 3},
+		{4.5, 4.5, 7, 7},
+	}
+	actual := MatchAnchors(anchors, targets, 0.5)
+
+	// Anchor 0 overlaps both of the first two targets, but
+	// matches the first one best.
+	// The third target has an IoU of 0.16 with anchor 2,
+	// which is below the threshold, so it gets forced.
+	expected := []int{0, 1, 2, -1}
+	for i, x := range expected {
+		if actual[i] != x {
+			t.Errorf("anchor %d: expected %d but got %d", i, x, actual[i])
+		}
+	}
+}
+
+func TestMatchAnchorsForcedConflicts(t *testing.T) {
+	// The second target touches no anchor, so it must not
+	// steal the first target's anchor.
+	anchors := []Box{{0, 0, 1, 1}, {5, 5, 6, 6}}
+	targets := []Box{{0, 0, 1, 1}, {20, 20, 21, 21}}
+	actual := MatchAnchors(anchors, targets, 0.5)
+	if actual[0] != 0 || actual[1] != -1 {
+		t.Errorf("non-overlapping target: unexpected matching %v", actual)
+	}
+
+	// The second target matches anchor 0 best, but anchor
+	// 0 is held by the first target, so it gets anchor 1.
+	anchors = []Box{{0, 0, 1, 1}, {1, 0, 2, 1}}
+	targets = []Box{{0, 0, 1, 1}, {0.4, 0, 1.4, 1}}
+	actual = MatchAnchors(anchors, targets, 0.5)
+	if actual[0] != 0 || actual[1] != 1 {
+		t.Errorf("low-IoU target: unexpected matching %v", actual)
+	}
+
+	// Neither target reaches the threshold, and both have
+	// anchor 0 as their best anchor.
+	// The second target overlaps it more, so it wins, and
+	// the first target falls back to anchor 1.
+	anchors = []Box{{0, 0, 2, 2}, {0, 0, 1.6, 1}}
+	targets = []Box{{0, 0, 1.6, 1.6}, {0, 0, 2, 1.5}}
+	actual = MatchAnchors(anchors, targets, 0.8)
+	if actual[0] != 1 || actual[1] != 0 {
+		t.Errorf("shared best anchor: unexpected matching %v", actual)
+	}
+}
+
+func TestHungarianMatch(t *testing.T) {
+	costs := [][]float64{
+		{4, 1, 3, 9},
+		{2, 0, 5, 9},
+		{3, 2, 2, 9},
+	}
+	actual := hungarianMatch(costs)
+	expected := []int{1, 0, 2}
+	for i, x := range expected {
+		if actual[i] != x {
+			t.Errorf("row %d: expected %d but got %d", i, x, actual[i])
+		}
+	}
+}
+
+func TestHungarianMatchNonFinite(t *testing.T) {
+	inf := math.Inf(1)
+	if actual := hungarianMatch([][]float64{{inf, inf}}); len(actual) != 1 {
+		t.Errorf("unexpected result for all-infinite row: %v", actual)
+	}
+	costs := [][]float64{
+		{inf, math.NaN(), 3},
+		{1, inf, 2},
+	}
+	actual := hungarianMatch(costs)
+	expected := []int{2, 0}
+	for i, x := range expected {
+		if actual[i] != x {
+			t.Errorf("row %d: expected %d but got %d", i, x, actual[i])
+		}
+	}
+}
+
+func TestSetPredictionCost(t *testing.T) {
+	cost := SetPredictionCost{
+		ClassCost:      softmaxCETestCost{},
+		BoxCost:        MeanSquaredCost{},
+		NoObjectWeight: 0.1,
+		NumClasses:     2,
+	}
+
+	// A single target of class 1, and three predictions.
+	// The second prediction is closest to the target.
+	expected := linalg.Vector{0, 1, 0, 0.5, 0.5, 0.2, 0.2}
+	actual := &autofunc.Variable{Vector: linalg.Vector{
+		1, 0, 0, 0.1, 0.1, 0.3, 0.3,
+		0, 1, 0, 0.5, 0.4, 0.2, 0.2,
+		0, 0, 1, 0.9, 0.9, 0.1, 0.1,
+	}}
+	if matches := cost.match(expected, actual.Vector); matches[1] != 0 ||
+		matches[0] != -1 || matches[2] != -1 {
+		t.Fatalf("unexpected matching: %v", matches)
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	for _, pred := range []int{0, 2} {
+		g := grad[actual][pred*7 : pred*7+3]
+		if g[2] >= 0 || g[0] <= 0 || g[1] <= 0 {
+			t.Errorf("prediction %d is not pushed toward no-object: %v", pred, g)
+		}
+		for _, boxGrad := range grad[actual][pred*7+3 : pred*7+7] {
+			if boxGrad != 0 {
+				t.Errorf("unmatched prediction %d got a box gradient", pred)
+			}
+		}
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}
@@ -0,0 +1,59 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// SoftMSECost is used to distill a regression model
+// into a student by blending the cost against the true
+// target with the cost against a teacher's prediction.
+//
+// For n outputs, the expected vector has length 2n and
+// contains the n true targets followed by the n teacher
+// outputs.
+// The cost is (1-TeacherWeight) times the target term
+// plus TeacherWeight times the teacher term, where each
+// term is computed with CostFunc.
+// If CostFunc is nil, MeanSquaredCost is used.
+type SoftMSECost struct {
+	TeacherWeight float64
+	CostFunc      CostFunc
+}
+
+func (s SoftMSECost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	target, teacher := splitTeacherTargets(x, a.Output())
+	c := s.costFunc()
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		return autofunc.Add(
+			autofunc.Scale(c.Cost(target, a), 1-s.TeacherWeight),
+			autofunc.Scale(c.Cost(teacher, a), s.TeacherWeight),
+		)
+	})
+}
+
+func (s SoftMSECost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	target, teacher := splitTeacherTargets(x, a.Output())
+	c := s.costFunc()
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		return autofunc.AddR(
+			autofunc.ScaleR(c.CostR(v, target, a), 1-s.TeacherWeight),
+			autofunc.ScaleR(c.CostR(v, teacher, a), s.TeacherWeight),
+		)
+	})
+}
+
+func (s SoftMSECost) costFunc() CostFunc {
+	if s.CostFunc == nil {
+		return MeanSquaredCost{}
+	}
+	return s.CostFunc
+}
+
+func splitTeacherTargets(x, a linalg.Vector) (target, teacher linalg.Vector) {
+	if len(x) != len(a)*2 {
+		panic("expected vector must be twice the actual size")
+	}
+	return x[:len(a)], x[len(a):]
+}
@@ -0,0 +1,45 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestSoftMSECostNoTeacher(t *testing.T) {
+	expected := linalg.Vector{1, 2, 5, 5}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, 3}}
+	cost := SoftMSECost{}.Cost(expected, actual).Output()[0]
+	if math.Abs(cost-1.25) > 1e-8 {
+		t.Errorf("expected 1.25 but got %f", cost)
+	}
+}
+
+func TestSoftMSECostTerms(t *testing.T) {
+	expected := linalg.Vector{1, 1, -1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0, 0}}
+	gradient := func(w float64) linalg.Vector {
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		SoftMSECost{TeacherWeight: w}.Cost(expected, actual).PropagateGradient(
+			linalg.Vector{1}, grad)
+		return grad[actual]
+	}
+
+	// The target pulls the output up and the teacher pulls
+	// it down, so the sign of the gradient depends on
+	// which term dominates.
+	if g := gradient(0); g[0] >= 0 {
+		t.Errorf("target term should dominate: %v", g)
+	}
+	if g := gradient(1); g[0] <= 0 {
+		t.Errorf("teacher term should dominate: %v", g)
+	}
+	if g := gradient(0.5); math.Abs(g[0]) > 1e-8 {
+		t.Errorf("terms should cancel: %v", g)
+	}
+
+	checkCostFuncGradients(t, SoftMSECost{TeacherWeight: 0.3, CostFunc: AbsCost{}},
+		linalg.Vector{1, 2, 0.5, -1}, linalg.Vector{0.1, 0.4})
+}
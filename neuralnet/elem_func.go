@@ -0,0 +1,239 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// elemFunc is an autofunc.RFunc which applies a scalar
+// function to each component of its input.
+//
+// Deriv and SecondDeriv are the first and second
+// derivatives of F, respectively.
+type elemFunc struct {
+	F           func(x float64) float64
+	Deriv       func(x float64) float64
+	SecondDeriv func(x float64) float64
+}
+
+func (e *elemFunc) Apply(in autofunc.Result) autofunc.Result {
+	inVec := in.Output()
+	outVec := make(linalg.Vector, len(inVec))
+	for i, x := range inVec {
+		outVec[i] = e.F(x)
+	}
+	return &elemFuncResult{
+		OutputVec: outVec,
+		Input:     in,
+		Func:      e,
+	}
+}
+
+func (e *elemFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	inVec := in.Output()
+	inVecR := in.ROutput()
+	outVec := make(linalg.Vector, len(inVec))
+	outVecR := make(linalg.Vector, len(inVec))
+	for i, x := range inVec {
+		outVec[i] = e.F(x)
+		outVecR[i] = e.Deriv(x) * inVecR[i]
+	}
+	return &elemFuncRResult{
+		OutputVec:  outVec,
+		ROutputVec: outVecR,
+		Input:      in,
+		Func:       e,
+	}
+}
+
+type elemFuncResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	Func      *elemFunc
+}
+
+func (e *elemFuncResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elemFuncResult) Constant(g autofunc.Gradient) bool {
+	return e.Input.Constant(g)
+}
+
+func (e *elemFuncResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	if e.Input.Constant(grad) {
+		return
+	}
+	for i, x := range e.Input.Output() {
+		upstream[i] *= e.Func.Deriv(x)
+	}
+	e.Input.PropagateGradient(upstream, grad)
+}
+
+type elemFuncRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	Func       *elemFunc
+}
+
+func (e *elemFuncRResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elemFuncRResult) ROutput() linalg.Vector {
+	return e.ROutputVec
+}
+
+func (e *elemFuncRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return e.Input.Constant(rg, g)
+}
+
+func (e *elemFuncRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if e.Input.Constant(rgrad, grad) {
+		return
+	}
+	inR := e.Input.ROutput()
+	for i, x := range e.Input.Output() {
+		deriv := e.Func.Deriv(x)
+		upstreamR[i] = upstreamR[i]*deriv + upstream[i]*e.Func.SecondDeriv(x)*inR[i]
+		upstream[i] *= deriv
+	}
+	e.Input.PropagateRGradient(upstream, upstreamR, rgrad, grad)
+}
+
+// lgammaFunc computes the natural log of the absolute
+// value of the gamma function.
+var lgammaFunc = &elemFunc{
+	F: func(x float64) float64 {
+		res, _ := math.Lgamma(x)
+		return res
+	},
+	Deriv:       digamma,
+	SecondDeriv: trigamma,
+}
+
+// digammaFunc computes the digamma function, i.e. the
+// derivative of lgammaFunc.
+var digammaFunc = &elemFunc{
+	F:           digamma,
+	Deriv:       trigamma,
+	SecondDeriv: tetragamma,
+}
+
+// digamma approximates the digamma function for x > 0
+// using a recurrence followed by an asymptotic series.
+func digamma(x float64) float64 {
+	var res float64
+	for x < 6 {
+		res -= 1 / x
+		x++
+	}
+	x2 := 1 / (x * x)
+	res += math.Log(x) - 0.5/x -
+		x2*(1.0/12-x2*(1.0/120-x2*(1.0/252-x2*(1.0/240-x2*(1.0/132)))))
+	return res
+}
+
+// trigamma approximates the first derivative of the
+// digamma function for x > 0.
+func trigamma(x float64) float64 {
+	var res float64
+	for x < 6 {
+		res += 1 / (x * x)
+		x++
+	}
+	x2 := 1 / (x * x)
+	res += 1/x + x2/2 +
+		x2/x*(1.0/6-x2*(1.0/30-x2*(1.0/42-x2*(1.0/30))))
+	return res
+}
+
+// tetragamma approximates the second derivative of the
+// digamma function for x > 0.
+func tetragamma(x float64) float64 {
+	var res float64
+	for x < 6 {
+		res -= 2 / (x * x * x)
+		x++
+	}
+	x2 := 1 / (x * x)
+	res += -x2 - x2/x - x2*x2*(0.5-x2*(1.0/6-x2*(1.0/6-x2*(3.0/10))))
+	return res
+}
+
+// softplus computes log(1+exp(x)) in a numerically
+// stable way.
+func softplus(r autofunc.Result) autofunc.Result {
+	return autofunc.Scale(autofunc.LogSigmoid{}.Apply(autofunc.Scale(r, -1)), -1)
+}
+
+func softplusR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return autofunc.ScaleR(autofunc.LogSigmoid{}.ApplyR(v, autofunc.ScaleR(r, -1)), -1)
+}
+
+// signMask returns a vector with -1 in place of every
+// negative entry of v and 1 everywhere else.
+//
+// Multiplying a Result by its sign mask computes the
+// absolute value with a deterministic sub-gradient.
+func signMask(v linalg.Vector) linalg.Vector {
+	mask := make(linalg.Vector, len(v))
+	for i, x := range v {
+		if x < 0 {
+			mask[i] = -1
+		} else {
+			mask[i] = 1
+		}
+	}
+	return mask
+}
+
+// positiveMask returns a vector with 1 in place of every
+// strictly positive entry of v and 0 everywhere else.
+//
+// Multiplying a Result by its positive mask computes
+// max(0, x) with a sub-gradient of 0 at x=0.
+func positiveMask(v linalg.Vector) linalg.Vector {
+	mask := make(linalg.Vector, len(v))
+	for i, x := range v {
+		if x > 0 {
+			mask[i] = 1
+		}
+	}
+	return mask
+}
+
+// clamp restricts every component of r to the range
+// [min, max].
+// Clamped components receive no gradient.
+func clamp(r autofunc.Result, min, max float64) autofunc.Result {
+	mask, offset := clampMask(r.Output(), min, max)
+	return autofunc.Add(autofunc.Mul(&autofunc.Variable{Vector: mask}, r),
+		&autofunc.Variable{Vector: offset})
+}
+
+func clampR(v autofunc.RVector, r autofunc.RResult, min, max float64) autofunc.RResult {
+	mask, offset := clampMask(r.Output(), min, max)
+	maskVar := autofunc.NewRVariable(&autofunc.Variable{Vector: mask}, v)
+	offsetVar := autofunc.NewRVariable(&autofunc.Variable{Vector: offset}, v)
+	return autofunc.AddR(autofunc.MulR(maskVar, r), offsetVar)
+}
+
+func clampMask(vec linalg.Vector, min, max float64) (mask, offset linalg.Vector) {
+	mask = make(linalg.Vector, len(vec))
+	offset = make(linalg.Vector, len(vec))
+	for i, x := range vec {
+		if x < min {
+			offset[i] = min
+		} else if x > max {
+			offset[i] = max
+		} else {
+			mask[i] = 1
+		}
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolygammaValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        func(float64) float64
+		x        float64
+		expected float64
+	}{
+		{"digamma", digamma, 1, -0.5772156649015329},
+		{"digamma", digamma, 0.5, -1.9635100260214235},
+		{"digamma", digamma, 10, 2.251752589066721},
+		{"trigamma", trigamma, 1, math.Pi * math.Pi / 6},
+		{"trigamma", trigamma, 0.5, math.Pi * math.Pi / 2},
+		{"tetragamma", tetragamma, 1, -2.4041138063191885},
+	}
+	for _, test := range tests {
+		if actual := test.f(test.x); math.Abs(actual-test.expected) > 1e-8 {
+			t.Errorf("%s(%f): expected %f but got %f", test.name, test.x,
+				test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// EnsembleDiversityCost trains the members of an
+// ensemble jointly while encouraging them to disagree.
+//
+// The actual vector is the concatenation of NumMembers
+// predictions, each the size of the expected vector.
+// The cost is the sum of CostFunc's cost for each member,
+// minus Lambda times the variance of the predictions.
+// The variance is computed across members for each
+// output component, and then summed over components.
+//
+// Since the variance term is unbounded, a Lambda which
+// is too large can make the total cost negative and
+// cause the members to diverge rather than fit the
+// targets.
+type EnsembleDiversityCost struct {
+	NumMembers int
+	Lambda     float64
+	CostFunc   CostFunc
+}
+
+func (e EnsembleDiversityCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	e.checkSizes(x, a.Output())
+	n := len(x)
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		members := make([]autofunc.Result, e.NumMembers)
+		var cost, sum autofunc.Result
+		for i := range members {
+			members[i] = autofunc.Slice(a, i*n, (i+1)*n)
+			memberCost := e.CostFunc.Cost(x, members[i])
+			if i == 0 {
+				cost, sum = memberCost, members[i]
+			} else {
+				cost = autofunc.Add(cost, memberCost)
+				sum = autofunc.Add(sum, members[i])
+			}
+		}
+		mean := autofunc.Scale(sum, -1/float64(e.NumMembers))
+		return autofunc.Pool(mean, func(mean autofunc.Result) autofunc.Result {
+			var variance autofunc.Result
+			for i, member := range members {
+				dev := autofunc.SumAll(autofunc.Square(autofunc.Add(member, mean)))
+				if i == 0 {
+					variance = dev
+				} else {
+					variance = autofunc.Add(variance, dev)
+				}
+			}
+			scale := -e.Lambda / float64(e.NumMembers)
+			return autofunc.Add(cost, autofunc.Scale(variance, scale))
+		})
+	})
+}
+
+func (e EnsembleDiversityCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	e.checkSizes(x, a.Output())
+	n := len(x)
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		members := make([]autofunc.RResult, e.NumMembers)
+		var cost, sum autofunc.RResult
+		for i := range members {
+			members[i] = autofunc.SliceR(a, i*n, (i+1)*n)
+			memberCost := e.CostFunc.CostR(v, x, members[i])
+			if i == 0 {
+				cost, sum = memberCost, members[i]
+			} else {
+				cost = autofunc.AddR(cost, memberCost)
+				sum = autofunc.AddR(sum, members[i])
+			}
+		}
+		mean := autofunc.ScaleR(sum, -1/float64(e.NumMembers))
+		return autofunc.PoolR(mean, func(mean autofunc.RResult) autofunc.RResult {
+			var variance autofunc.RResult
+			for i, member := range members {
+				dev := autofunc.SumAllR(autofunc.SquareR(autofunc.AddR(member, mean)))
+				if i == 0 {
+					variance = dev
+				} else {
+					variance = autofunc.AddR(variance, dev)
+				}
+			}
+			scale := -e.Lambda / float64(e.NumMembers)
+			return autofunc.AddR(cost, autofunc.ScaleR(variance, scale))
+		})
+	})
+}
+
+func (e EnsembleDiversityCost) checkSizes(x, a linalg.Vector) {
+	if e.NumMembers <= 0 {
+		panic("ensemble must have at least one member")
+	}
+	if len(a) != len(x)*e.NumMembers {
+		panic("actual vector must contain one prediction per member")
+	}
+}
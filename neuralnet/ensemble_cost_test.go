@@ -0,0 +1,46 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestEnsembleDiversityCost(t *testing.T) {
+	cost := EnsembleDiversityCost{NumMembers: 3, Lambda: 0.5, CostFunc: MeanSquaredCost{}}
+	expected := linalg.Vector{1, -1}
+	actual := linalg.Vector{0.5, -0.5, 1.5, -1, 2, 0}
+
+	var exp float64
+	for i := 0; i < 3; i++ {
+		member := &autofunc.Variable{Vector: actual[i*2 : (i+1)*2]}
+		exp += MeanSquaredCost{}.Cost(expected, member).Output()[0]
+	}
+	// Variances of {0.5, 1.5, 2} and {-0.5, -1, 0}.
+	exp -= 0.5 * (7.0/18 + 1.0/6)
+	actualVar := &autofunc.Variable{Vector: actual}
+	if c := cost.Cost(expected, actualVar).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual)
+}
+
+func TestEnsembleDiversityCostSpread(t *testing.T) {
+	expected := linalg.Vector{0}
+	spread := func(lambda float64) float64 {
+		cost := EnsembleDiversityCost{NumMembers: 2, Lambda: lambda,
+			CostFunc: MeanSquaredCost{}}
+		actual := &autofunc.Variable{Vector: linalg.Vector{0.1, -0.1}}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+		actual.Vector.Add(grad[actual].Scale(-0.1))
+		return actual.Vector[0] - actual.Vector[1]
+	}
+	if plain, diverse := spread(0), spread(4); diverse <= 0.2 || diverse <= plain {
+		t.Errorf("diversity term should push members apart (spread %f vs %f)",
+			diverse, plain)
+	}
+}
@@ -0,0 +1,206 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// DirichletEvidenceCost implements the evidential deep
+// learning loss from Sensoy et al. (2018).
+//
+// The actual vector contains non-negative evidence for
+// each of the NumClasses classes (e.g. from a ReLU or an
+// exponential), which is turned into Dirichlet parameters
+// by adding 1 to each entry.
+// The expected vector is a one-hot class vector.
+//
+// The cost is the Bayes risk of the squared error,
+// plus the KL divergence between a uniform Dirichlet and
+// the Dirichlet obtained by removing the evidence for the
+// correct class.
+// The KL term only penalizes misleading evidence.
+type DirichletEvidenceCost struct {
+	NumClasses int
+}
+
+func (d DirichletEvidenceCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	d.checkSizes(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		alpha := autofunc.AddScaler(a, 1)
+		strength := autofunc.SumAll(alpha)
+		probs := autofunc.ScaleFirst(alpha, autofunc.Inverse(strength))
+
+		negX := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+		errTerm := autofunc.SquaredNorm{}.Apply(autofunc.Add(probs, negX))
+		variance := autofunc.SumAll(autofunc.Mul(probs,
+			autofunc.AddScaler(autofunc.Scale(probs, -1), 1)))
+		varTerm := autofunc.Mul(variance, autofunc.Inverse(autofunc.AddScaler(strength, 1)))
+
+		xVar := &autofunc.Variable{Vector: x}
+		oneMinusX := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+		for i := range oneMinusX.Vector {
+			oneMinusX.Vector[i]++
+		}
+		misleading := autofunc.Add(xVar, autofunc.Mul(oneMinusX, alpha))
+		kl := d.uniformKL(misleading)
+
+		return autofunc.Add(autofunc.Add(errTerm, varTerm), kl)
+	})
+}
+
+func (d DirichletEvidenceCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	d.checkSizes(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		alpha := autofunc.AddScalerR(a, 1)
+		strength := autofunc.SumAllR(alpha)
+		probs := autofunc.ScaleFirstR(alpha, autofunc.InverseR(strength))
+
+		negX := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+		errTerm := autofunc.SquaredNorm{}.ApplyR(v, autofunc.AddR(probs, negX))
+		variance := autofunc.SumAllR(autofunc.MulR(probs,
+			autofunc.AddScalerR(autofunc.ScaleR(probs, -1), 1)))
+		varTerm := autofunc.MulR(variance, autofunc.InverseR(autofunc.AddScalerR(strength, 1)))
+
+		xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x}, v)
+		oneMinusX := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+		for i := range oneMinusX.Vector {
+			oneMinusX.Vector[i]++
+		}
+		misleading := autofunc.AddR(xVar,
+			autofunc.MulR(autofunc.NewRVariable(oneMinusX, v), alpha))
+		kl := d.uniformKLR(v, misleading)
+
+		return autofunc.AddR(autofunc.AddR(errTerm, varTerm), kl)
+	})
+}
+
+// uniformKL computes KL(Dir(alpha) || Dir(1, ..., 1)).
+func (d DirichletEvidenceCost) uniformKL(alpha autofunc.Result) autofunc.Result {
+	return autofunc.Pool(alpha, func(alpha autofunc.Result) autofunc.Result {
+		lgK, _ := math.Lgamma(float64(d.NumClasses))
+		sum := autofunc.SumAll(alpha)
+		norm := autofunc.Add(lgammaFunc.Apply(sum),
+			autofunc.Scale(autofunc.SumAll(lgammaFunc.Apply(alpha)), -1))
+		digammas := autofunc.AddFirst(digammaFunc.Apply(alpha),
+			autofunc.Scale(digammaFunc.Apply(sum), -1))
+		expTerm := autofunc.SumAll(autofunc.Mul(autofunc.AddScaler(alpha, -1), digammas))
+		return autofunc.AddScaler(autofunc.Add(norm, expTerm), -lgK)
+	})
+}
+
+func (d DirichletEvidenceCost) uniformKLR(v autofunc.RVector,
+	alpha autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(alpha, func(alpha autofunc.RResult) autofunc.RResult {
+		lgK, _ := math.Lgamma(float64(d.NumClasses))
+		sum := autofunc.SumAllR(alpha)
+		norm := autofunc.AddR(lgammaFunc.ApplyR(v, sum),
+			autofunc.ScaleR(autofunc.SumAllR(lgammaFunc.ApplyR(v, alpha)), -1))
+		digammas := autofunc.AddFirstR(digammaFunc.ApplyR(v, alpha),
+			autofunc.ScaleR(digammaFunc.ApplyR(v, sum), -1))
+		expTerm := autofunc.SumAllR(autofunc.MulR(autofunc.AddScalerR(alpha, -1), digammas))
+		return autofunc.AddScalerR(autofunc.AddR(norm, expTerm), -lgK)
+	})
+}
+
+func (d DirichletEvidenceCost) checkSizes(x, a linalg.Vector) {
+	if len(x) != d.NumClasses || len(a) != d.NumClasses {
+		panic("vector sizes must match NumClasses")
+	}
+}
+
+// DeepEvidentialRegressionCost implements the deep
+// evidential regression loss from Amini et al. (2020).
+//
+// For an expected vector of length n, the actual vector
+// must have length 4n and contain, in order, n means
+// (gamma), n raw values for nu, n raw values for alpha,
+// and n raw values for beta.
+// These raw values are made positive with a softplus,
+// and alpha is further shifted by 1 so that alpha > 1.
+//
+// The cost is the negative log-likelihood of the
+// Normal-Inverse-Gamma evidential distribution plus
+// Lambda times the evidence regularizer
+// |y-gamma|*(2*nu+alpha).
+type DeepEvidentialRegressionCost struct {
+	Lambda float64
+}
+
+func (d DeepEvidentialRegressionCost) Cost(x linalg.Vector,
+	a autofunc.Result) autofunc.Result {
+	n := len(x)
+	if len(a.Output()) != n*4 {
+		panic("actual vector must be four times the expected size")
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		gamma := autofunc.Slice(a, 0, n)
+		nu := softplus(autofunc.Slice(a, n, n*2))
+		alpha := autofunc.AddScaler(softplus(autofunc.Slice(a, n*2, n*3)), 1)
+		beta := softplus(autofunc.Slice(a, n*3, n*4))
+
+		negX := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+		diff := autofunc.Add(gamma, negX)
+		omega := autofunc.Scale(autofunc.Mul(beta, autofunc.AddScaler(nu, 1)), 2)
+
+		logOmega := autofunc.Log{}.Apply(omega)
+		logDev := autofunc.Log{}.Apply(autofunc.Add(autofunc.Mul(autofunc.Square(diff), nu),
+			omega))
+		nll := autofunc.Add(
+			autofunc.Scale(autofunc.Log{}.Apply(nu), -0.5),
+			autofunc.Add(
+				autofunc.Scale(autofunc.Mul(alpha, logOmega), -1),
+				autofunc.Mul(autofunc.AddScaler(alpha, 0.5), logDev),
+			),
+		)
+		nll = autofunc.Add(nll, autofunc.Add(lgammaFunc.Apply(alpha),
+			autofunc.Scale(lgammaFunc.Apply(autofunc.AddScaler(alpha, 0.5)), -1)))
+
+		absDiff := autofunc.Mul(&autofunc.Variable{Vector: signMask(diff.Output())}, diff)
+		reg := autofunc.Mul(absDiff, autofunc.Add(autofunc.Scale(nu, 2), alpha))
+
+		sum := autofunc.Add(autofunc.SumAll(nll), autofunc.Scale(autofunc.SumAll(reg), d.Lambda))
+		return autofunc.AddScaler(sum, 0.5*math.Log(math.Pi)*float64(n))
+	})
+}
+
+func (d DeepEvidentialRegressionCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n := len(x)
+	if len(a.Output()) != n*4 {
+		panic("actual vector must be four times the expected size")
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		gamma := autofunc.SliceR(a, 0, n)
+		nu := softplusR(v, autofunc.SliceR(a, n, n*2))
+		alpha := autofunc.AddScalerR(softplusR(v, autofunc.SliceR(a, n*2, n*3)), 1)
+		beta := softplusR(v, autofunc.SliceR(a, n*3, n*4))
+
+		negX := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+		diff := autofunc.AddR(gamma, negX)
+		omega := autofunc.ScaleR(autofunc.MulR(beta, autofunc.AddScalerR(nu, 1)), 2)
+
+		logOmega := autofunc.Log{}.ApplyR(v, omega)
+		logDev := autofunc.Log{}.ApplyR(v, autofunc.AddR(autofunc.MulR(autofunc.SquareR(diff),
+			nu), omega))
+		nll := autofunc.AddR(
+			autofunc.ScaleR(autofunc.Log{}.ApplyR(v, nu), -0.5),
+			autofunc.AddR(
+				autofunc.ScaleR(autofunc.MulR(alpha, logOmega), -1),
+				autofunc.MulR(autofunc.AddScalerR(alpha, 0.5), logDev),
+			),
+		)
+		nll = autofunc.AddR(nll, autofunc.AddR(lgammaFunc.ApplyR(v, alpha),
+			autofunc.ScaleR(lgammaFunc.ApplyR(v, autofunc.AddScalerR(alpha, 0.5)), -1)))
+
+		mask := &autofunc.Variable{Vector: signMask(diff.Output())}
+		absDiff := autofunc.MulR(autofunc.NewRVariable(mask, v), diff)
+		reg := autofunc.MulR(absDiff, autofunc.AddR(autofunc.ScaleR(nu, 2), alpha))
+
+		sum := autofunc.AddR(autofunc.SumAllR(nll),
+			autofunc.ScaleR(autofunc.SumAllR(reg), d.Lambda))
+		return autofunc.AddScalerR(sum, 0.5*math.Log(math.Pi)*float64(n))
+	})
+}
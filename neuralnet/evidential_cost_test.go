@@ -0,0 +1,71 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestDirichletEvidenceCostGradient(t *testing.T) {
+	cost := DirichletEvidenceCost{NumClasses: 3}
+	checkCostFuncGradients(t, cost, linalg.Vector{0, 1, 0}, linalg.Vector{0.5, 2, 1.5})
+}
+
+func TestDirichletEvidenceCostEvidence(t *testing.T) {
+	cost := DirichletEvidenceCost{NumClasses: 3}
+	target := linalg.Vector{1, 0, 0}
+	costFor := func(evidence linalg.Vector) float64 {
+		return cost.Cost(target, &autofunc.Variable{Vector: evidence}).Output()[0]
+	}
+
+	if costFor(linalg.Vector{5, 0, 0}) >= costFor(linalg.Vector{1, 0, 0}) {
+		t.Error("more correct evidence should lower the cost")
+	}
+
+	// With no misleading evidence, the KL term vanishes
+	// and only the Bayes risk remains.
+	s := 8.0
+	p := []float64{6 / s, 1 / s, 1 / s}
+	var risk float64
+	for i, x := range p {
+		risk += (target[i]-x)*(target[i]-x) + x*(1-x)/(s+1)
+	}
+	if actual := costFor(linalg.Vector{5, 0, 0}); math.Abs(actual-risk) > 1e-8 {
+		t.Errorf("expected cost %f but got %f", risk, actual)
+	}
+
+	// Misleading evidence on the wrong class is penalized
+	// by more than the Bayes risk alone.
+	p = []float64{1 / s, 6 / s, 1 / s}
+	risk = 0
+	for i, x := range p {
+		risk += (target[i]-x)*(target[i]-x) + x*(1-x)/(s+1)
+	}
+	if actual := costFor(linalg.Vector{0, 5, 0}); actual <= risk+1e-3 {
+		t.Errorf("expected KL penalty on top of risk %f, got %f", risk, actual)
+	}
+}
+
+func TestDeepEvidentialRegressionCostGradient(t *testing.T) {
+	cost := DeepEvidentialRegressionCost{Lambda: 0.1}
+	checkCostFuncGradients(t, cost, linalg.RandVector(2), linalg.RandVector(8))
+}
+
+func TestDeepEvidentialRegressionCostMean(t *testing.T) {
+	cost := DeepEvidentialRegressionCost{Lambda: 0.01}
+	target := linalg.Vector{1.5}
+	costFor := func(mean float64) float64 {
+		actual := &autofunc.Variable{Vector: []float64{mean, 1, 1, 0.5}}
+		return cost.Cost(target, actual).Output()[0]
+	}
+	last := costFor(-1)
+	for _, mean := range []float64{0, 0.5, 1, 1.5} {
+		c := costFor(mean)
+		if c >= last {
+			t.Errorf("cost at mean %f (%f) should be below %f", mean, c, last)
+		}
+		last = c
+	}
+}
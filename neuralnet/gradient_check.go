@@ -0,0 +1,90 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// CheckCostGradient compares the gradient of a CostFunc
+// with respect to its actual vector against a central
+// difference approximation with step size epsilon.
+//
+// It returns the largest absolute difference between any
+// component of the analytic and numerical gradients, so
+// that tests for new CostFuncs can assert that it is
+// small.
+// The actual vector is not modified.
+func CheckCostGradient(c CostFunc, expected, actual linalg.Vector, epsilon float64) float64 {
+	actualVar := &autofunc.Variable{Vector: actual.Copy()}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actualVar})
+	c.Cost(expected, actualVar).PropagateGradient(linalg.Vector{1}, grad)
+
+	var maxError float64
+	for i, analytic := range grad[actualVar] {
+		numerical := centralDifference(actualVar.Vector, i, epsilon, func() float64 {
+			return c.Cost(expected, actualVar).Output()[0]
+		})
+		maxError = math.Max(maxError, math.Abs(analytic-numerical))
+	}
+	return maxError
+}
+
+// CheckCostRGradient checks the CostR method of a
+// CostFunc against central differences with step size
+// epsilon along the direction v[actual].
+//
+// The RVector v must have an entry for the actual
+// variable, and that entry must match its size.
+// Both the R output of the cost (i.e. the directional
+// derivative of the cost) and the r-gradient (i.e. the
+// directional derivative of the gradient) are checked.
+//
+// It returns the largest absolute difference between any
+// analytic and numerical value.
+// The actual variable is not modified.
+func CheckCostRGradient(c CostFunc, v autofunc.RVector, expected linalg.Vector,
+	actual *autofunc.Variable, epsilon float64) float64 {
+	rv, ok := v[actual]
+	if !ok || len(rv) != len(actual.Vector) {
+		panic("R vector must match actual size")
+	}
+	vars := []*autofunc.Variable{actual}
+	cost := c.CostR(v, expected, autofunc.NewRVariable(actual, v))
+	grad := autofunc.NewGradient(vars)
+	rgrad := autofunc.NewRGradient(vars)
+	cost.PropagateRGradient(linalg.Vector{1}, linalg.Vector{0}, rgrad, grad)
+
+	costAt := func(scale float64) float64 {
+		point := &autofunc.Variable{Vector: actual.Vector.Copy().Add(rv.Copy().Scale(scale))}
+		return c.Cost(expected, point).Output()[0]
+	}
+	gradAt := func(scale float64) linalg.Vector {
+		point := &autofunc.Variable{Vector: actual.Vector.Copy().Add(rv.Copy().Scale(scale))}
+		g := autofunc.NewGradient([]*autofunc.Variable{point})
+		c.Cost(expected, point).PropagateGradient(linalg.Vector{1}, g)
+		return g[point]
+	}
+
+	numROutput := (costAt(epsilon) - costAt(-epsilon)) / (2 * epsilon)
+	maxError := math.Abs(cost.ROutput()[0] - numROutput)
+
+	numRGrad := gradAt(epsilon).Add(gradAt(-epsilon).Scale(-1)).Scale(1 / (2 * epsilon))
+	for i, x := range rgrad[actual] {
+		maxError = math.Max(maxError, math.Abs(x-numRGrad[i]))
+	}
+	return maxError
+}
+
+// centralDifference approximates the derivative of f
+// with respect to vec[idx], restoring vec[idx] after.
+func centralDifference(vec linalg.Vector, idx int, epsilon float64, f func() float64) float64 {
+	old := vec[idx]
+	vec[idx] = old + epsilon
+	plus := f()
+	vec[idx] = old - epsilon
+	minus := f()
+	vec[idx] = old
+	return (plus - minus) / (2 * epsilon)
+}
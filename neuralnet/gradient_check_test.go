@@ -0,0 +1,72 @@
+package neuralnet
+
+import (
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// wrongGradientCost has the value of MeanSquaredCost,
+// but a gradient which is off by a factor of 2.
+type wrongGradientCost struct{}
+
+func (_ wrongGradientCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	value := MeanSquaredCost{}.Cost(x, a).Output()
+	scaled := autofunc.Scale(MeanSquaredCost{}.Cost(x, a), 2)
+	return autofunc.Add(scaled, &autofunc.Variable{Vector: linalg.Vector{-value[0]}})
+}
+
+func (_ wrongGradientCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	value := MeanSquaredCost{}.CostR(v, x, a).Output()
+	scaled := autofunc.ScaleR(MeanSquaredCost{}.CostR(v, x, a), 2)
+	return autofunc.AddR(scaled,
+		autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{-value[0]}}, v))
+}
+
+func TestCheckCostGradient(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5}
+	actual := linalg.Vector{0.3, -1, 2}
+	for _, c := range []CostFunc{MeanSquaredCost{}, LogCoshCost{}, softmaxCETestCost{}} {
+		if err := CheckCostGradient(c, expected, actual, 1e-5); err > 1e-6 {
+			t.Errorf("%T: unexpected error %e", c, err)
+		}
+	}
+	if err := CheckCostGradient(wrongGradientCost{}, expected, actual, 1e-5); err < 0.1 {
+		t.Errorf("expected a large error for an incorrect gradient, got %e", err)
+	}
+	if actual[0] != 0.3 || actual[1] != -1 || actual[2] != 2 {
+		t.Errorf("actual vector was modified: %v", actual)
+	}
+}
+
+// wrongRGradientCost has the correct gradient, but its
+// CostR method ignores the second derivative.
+type wrongRGradientCost struct{}
+
+func (_ wrongRGradientCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return LogCoshCost{}.Cost(x, a)
+}
+
+func (_ wrongRGradientCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return AbsCost{}.CostR(v, x, a)
+}
+
+func TestCheckCostRGradient(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.3, -1, 2}}
+	rv := autofunc.RVector{actual: linalg.Vector{0.5, -0.2, 1}}
+	for _, c := range []CostFunc{MeanSquaredCost{}, LogCoshCost{}, softmaxCETestCost{}} {
+		if err := CheckCostRGradient(c, rv, expected, actual, 1e-5); err > 1e-6 {
+			t.Errorf("%T: unexpected error %e", c, err)
+		}
+	}
+	if err := CheckCostRGradient(wrongRGradientCost{}, rv, expected, actual, 1e-5); err < 0.1 {
+		t.Errorf("expected a large error for an incorrect r-gradient, got %e", err)
+	}
+	if actual.Vector[0] != 0.3 || actual.Vector[1] != -1 || actual.Vector[2] != 2 {
+		t.Errorf("actual vector was modified: %v", actual.Vector)
+	}
+}
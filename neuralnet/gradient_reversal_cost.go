@@ -0,0 +1,84 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// GradientReversalCost implements a gradient reversal
+// layer at the level of a cost function, as used for
+// domain-adversarial training (Ganin et al., 2015).
+//
+// The cost is computed by CostFunc as usual, but the
+// gradient which flows back into the actual output is
+// multiplied by -Lambda.
+// This makes the upstream network maximize CostFunc
+// (e.g. a domain classifier's loss) while its own
+// parameters still minimize it.
+type GradientReversalCost struct {
+	Lambda   float64
+	CostFunc CostFunc
+}
+
+// SetLambda updates the reversal coefficient, making it
+// possible to schedule Lambda during training.
+func (g *GradientReversalCost) SetLambda(lambda float64) {
+	g.Lambda = lambda
+}
+
+func (g *GradientReversalCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return g.CostFunc.Cost(x, &reversalResult{Input: a, Scale: -g.Lambda})
+}
+
+func (g *GradientReversalCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return g.CostFunc.CostR(v, x, &reversalRResult{Input: a, Scale: -g.Lambda})
+}
+
+type reversalResult struct {
+	Input autofunc.Result
+	Scale float64
+}
+
+func (r *reversalResult) Output() linalg.Vector {
+	return r.Input.Output()
+}
+
+func (r *reversalResult) Constant(g autofunc.Gradient) bool {
+	return r.Input.Constant(g)
+}
+
+func (r *reversalResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	if r.Input.Constant(grad) {
+		return
+	}
+	upstream.Scale(r.Scale)
+	r.Input.PropagateGradient(upstream, grad)
+}
+
+type reversalRResult struct {
+	Input autofunc.RResult
+	Scale float64
+}
+
+func (r *reversalRResult) Output() linalg.Vector {
+	return r.Input.Output()
+}
+
+func (r *reversalRResult) ROutput() linalg.Vector {
+	return r.Input.ROutput()
+}
+
+func (r *reversalRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return r.Input.Constant(rg, g)
+}
+
+func (r *reversalRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if r.Input.Constant(rgrad, grad) {
+		return
+	}
+	upstream.Scale(r.Scale)
+	upstreamR.Scale(r.Scale)
+	r.Input.PropagateRGradient(upstream, upstreamR, rgrad, grad)
+}
@@ -0,0 +1,47 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestGradientReversalCost(t *testing.T) {
+	cost := &GradientReversalCost{Lambda: 0.5, CostFunc: MeanSquaredCost{}}
+	expected := linalg.Vector{1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, 2}}
+	vars := []*autofunc.Variable{actual}
+
+	plainGrad := autofunc.NewGradient(vars)
+	plain := MeanSquaredCost{}.Cost(expected, actual)
+	plain.PropagateGradient(linalg.Vector{1}, plainGrad)
+
+	for _, lambda := range []float64{0.5, 2} {
+		cost.SetLambda(lambda)
+		out := cost.Cost(expected, actual)
+		if out.Output()[0] != plain.Output()[0] {
+			t.Errorf("cost should be unchanged: %f vs %f", out.Output()[0], plain.Output()[0])
+		}
+		grad := autofunc.NewGradient(vars)
+		out.PropagateGradient(linalg.Vector{1}, grad)
+
+		rv := autofunc.RVector{actual: linalg.RandVector(2)}
+		rgrad := autofunc.NewRGradient(vars)
+		gradR := autofunc.NewGradient(vars)
+		cost.CostR(rv, expected, autofunc.NewRVariable(actual, rv)).PropagateRGradient(
+			linalg.Vector{1}, linalg.Vector{0}, rgrad, gradR)
+
+		for i, x := range plainGrad[actual] {
+			if math.Abs(grad[actual][i]+lambda*x) > 1e-10 {
+				t.Errorf("lambda %f: expected gradient %f but got %f", lambda, -lambda*x,
+					grad[actual][i])
+			}
+			if math.Abs(gradR[actual][i]-grad[actual][i]) > 1e-10 {
+				t.Errorf("lambda %f: R gradient %f differs from %f", lambda, gradR[actual][i],
+					grad[actual][i])
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// softLabelTolerance is the largest deviation from 1
+// allowed in the sum of a soft label distribution.
+const softLabelTolerance = 1e-6
+
+// AnnotatorSoftLabelCost trains a classifier on labels
+// collected from several annotators.
+//
+// Rather than reducing the annotations to a single hard
+// label (e.g. by majority vote), the expected vector is
+// the distribution of the annotators' labels, so that
+// the model learns how ambiguous each sample is.
+// For example, if two of three annotators chose class 0
+// and one chose class 2, the expected vector would be
+// [2/3, 0, 1/3].
+// The distribution must be non-negative and sum to 1, or
+// Cost and CostR will panic.
+//
+// The cost is CostFunc's cost of the actual vector
+// against the distribution.
+// If CostFunc is nil, the actual vector is treated as
+// logits and the cost is the soft-target cross entropy
+// of their softmax.
+type AnnotatorSoftLabelCost struct {
+	CostFunc CostFunc
+}
+
+func (s AnnotatorSoftLabelCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	checkSoftLabel(x)
+	if s.CostFunc != nil {
+		return s.CostFunc.Cost(x, a)
+	}
+	return DotCost{}.Cost(x, (&LogSoftmaxLayer{}).Apply(a))
+}
+
+func (s AnnotatorSoftLabelCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	checkSoftLabel(x)
+	if s.CostFunc != nil {
+		return s.CostFunc.CostR(v, x, a)
+	}
+	return DotCost{}.CostR(v, x, (&LogSoftmaxLayer{}).ApplyR(v, a))
+}
+
+func checkSoftLabel(x linalg.Vector) {
+	var sum float64
+	for _, p := range x {
+		if p < 0 {
+			panic("label probabilities must be non-negative")
+		}
+		sum += p
+	}
+	if math.Abs(sum-1) > softLabelTolerance {
+		panic("label probabilities must sum to 1")
+	}
+}
+
+// StructuredLabelCost trains a classifier on labels
+// which are related to one another, such as the leaves
+// of a class hierarchy.
+//
+// The expected vector is a one-hot (or soft) label.
+// Before computing the cost, each class's probability
+// mass is spread over related classes according to
+// Similarity, where Similarity[i][j] is the fraction of
+// class i's mass assigned to class j.
+// Each row of Similarity must be a distribution, so that
+// the resulting target is a distribution as well.
+// Thus, confusing two similar classes costs less than
+// confusing two unrelated ones.
+//
+// The cost of the actual vector against the spread
+// target is computed like in AnnotatorSoftLabelCost.
+type StructuredLabelCost struct {
+	Similarity [][]float64
+	CostFunc   CostFunc
+}
+
+func (s StructuredLabelCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return AnnotatorSoftLabelCost{s.CostFunc}.Cost(s.target(x), a)
+}
+
+func (s StructuredLabelCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return AnnotatorSoftLabelCost{s.CostFunc}.CostR(v, s.target(x), a)
+}
+
+func (s StructuredLabelCost) target(x linalg.Vector) linalg.Vector {
+	if len(s.Similarity) != len(x) {
+		panic("similarity matrix must match label size")
+	}
+	res := make(linalg.Vector, len(x))
+	for i, row := range s.Similarity {
+		if len(row) != len(x) {
+			panic("similarity matrix must be square")
+		}
+		checkSoftLabel(row)
+		res.Add(linalg.Vector(row).Copy().Scale(x[i]))
+	}
+	return res
+}
+
+// LabelSmoothingCost applies label smoothing to the
+// expected vector before passing it to CostFunc.
+//
+// The expected vector x is replaced with
+//
+//	(1-Smoothing)*x + Smoothing/numClasses
+//
+// where numClasses is inferred from len(x).
+// This works with any CostFunc which accepts soft
+// targets, such as CrossEntropyCost, or DotCost applied
+// to the output of a LogSoftmaxLayer.
+type LabelSmoothingCost struct {
+	CostFunc  CostFunc
+	Smoothing float64
+}
+
+func (l LabelSmoothingCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return l.CostFunc.Cost(l.target(x), a)
+}
+
+func (l LabelSmoothingCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return l.CostFunc.CostR(v, l.target(x), a)
+}
+
+func (l LabelSmoothingCost) target(x linalg.Vector) linalg.Vector {
+	res := x.Copy().Scale(1 - l.Smoothing)
+	for i := range res {
+		res[i] += l.Smoothing / float64(len(x))
+	}
+	return res
+}
+
+// PerClassLabelSmoothingCost applies label smoothing
+// with a separate amount of smoothing for each class,
+// which is useful when some classes are noisier than
+// others.
+//
+// The expected vector is a one-hot vector for the true
+// class c.
+// Epsilons[c] of the label's probability mass is taken
+// from class c and spread uniformly over all classes
+// (including c), and the cost of the actual vector
+// against the smoothed label is computed like in
+// AnnotatorSoftLabelCost.
+//
+// Every epsilon must be in [0, 1).
+type PerClassLabelSmoothingCost struct {
+	Epsilons linalg.Vector
+	CostFunc CostFunc
+}
+
+func (p PerClassLabelSmoothingCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return AnnotatorSoftLabelCost{p.CostFunc}.Cost(p.target(x), a)
+}
+
+func (p PerClassLabelSmoothingCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return AnnotatorSoftLabelCost{p.CostFunc}.CostR(v, p.target(x), a)
+}
+
+func (p PerClassLabelSmoothingCost) target(x linalg.Vector) linalg.Vector {
+	if len(p.Epsilons) != len(x) {
+		panic("need one epsilon per class")
+	}
+	for _, eps := range p.Epsilons {
+		if eps < 0 || eps >= 1 {
+			panic("epsilons must be in [0, 1)")
+		}
+	}
+	return LabelSmoothingCost{Smoothing: p.Epsilons[maxIndex(x)]}.target(x)
+}
@@ -0,0 +1,121 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestAnnotatorSoftLabelCostOneHot(t *testing.T) {
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, -1, 2}}
+	hard := CategoricalNLLCost{}.Cost(linalg.Vector{2}, actual).Output()[0]
+	soft := AnnotatorSoftLabelCost{}.Cost(linalg.Vector{0, 0, 1}, actual).Output()[0]
+	if math.Abs(hard-soft) > 1e-10 {
+		t.Errorf("expected %f but got %f", hard, soft)
+	}
+}
+
+func TestAnnotatorSoftLabelCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, AnnotatorSoftLabelCost{}, linalg.Vector{2.0 / 3, 0, 1.0 / 3},
+		linalg.Vector{0.5, -1, 2})
+}
+
+func TestAnnotatorSoftLabelCostValidation(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for unnormalized distribution")
+		}
+	}()
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, -1, 2}}
+	AnnotatorSoftLabelCost{}.Cost(linalg.Vector{0.5, 0.2, 0.5}, actual)
+}
+
+func TestStructuredLabelCost(t *testing.T) {
+	// Classes 0 and 1 are similar, class 2 is unrelated.
+	cost := StructuredLabelCost{
+		Similarity: [][]float64{
+			{0.8, 0.2, 0},
+			{0.2, 0.8, 0},
+			{0, 0, 1},
+		},
+	}
+	label := linalg.Vector{1, 0, 0}
+	similar := &autofunc.Variable{Vector: linalg.Vector{0, 3, 0}}
+	dissimilar := &autofunc.Variable{Vector: linalg.Vector{0, 0, 3}}
+	simCost := cost.Cost(label, similar).Output()[0]
+	dissimCost := cost.Cost(label, dissimilar).Output()[0]
+	if simCost >= dissimCost {
+		t.Errorf("similar mistake cost %f should be less than dissimilar %f",
+			simCost, dissimCost)
+	}
+
+	target := linalg.Vector{0.8, 0.2, 0}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, -1, 2}}
+	exp := AnnotatorSoftLabelCost{}.Cost(target, actual).Output()[0]
+	if c := cost.Cost(label, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+	checkCostFuncGradients(t, cost, label, linalg.Vector{0.5, -1, 2})
+}
+
+func TestStructuredLabelCostValidation(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for unnormalized similarity row")
+		}
+	}()
+	cost := StructuredLabelCost{Similarity: [][]float64{{1, 0.5}, {0, 1}}}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, -1}}
+	cost.Cost(linalg.Vector{1, 0}, actual)
+}
+
+func TestPerClassLabelSmoothingCost(t *testing.T) {
+	cost := PerClassLabelSmoothingCost{Epsilons: linalg.Vector{0.3, 0, 0.1}}
+
+	noisy := cost.target(linalg.Vector{1, 0, 0})
+	clean := cost.target(linalg.Vector{0, 0, 1})
+	if math.Abs(noisy[0]-0.8) > 1e-10 || math.Abs(noisy[1]-0.1) > 1e-10 {
+		t.Errorf("unexpected smoothed target %v", noisy)
+	}
+	if noisy[0] >= clean[2] {
+		t.Errorf("noisy class target %v should be softer than %v", noisy, clean)
+	}
+	if exact := cost.target(linalg.Vector{0, 1, 0}); exact[1] != 1 {
+		t.Errorf("expected an unsmoothed target but got %v", exact)
+	}
+
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, -1, 2}}
+	exp := AnnotatorSoftLabelCost{}.Cost(noisy, actual).Output()[0]
+	if c := cost.Cost(linalg.Vector{1, 0, 0}, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+	checkCostFuncGradients(t, cost, linalg.Vector{1, 0, 0}, actual.Vector)
+}
+
+func TestLabelSmoothingCost(t *testing.T) {
+	label := linalg.Vector{0, 1, 0, 0}
+	smoothed := linalg.Vector{0.025, 0.925, 0.025, 0.025}
+
+	probs := &autofunc.Variable{Vector: linalg.Vector{0.1, 0.6, 0.2, 0.1}}
+	ce := LabelSmoothingCost{CostFunc: CrossEntropyCost{}, Smoothing: 0.1}
+	exp := CrossEntropyCost{}.Cost(smoothed, probs).Output()[0]
+	if c := ce.Cost(label, probs).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("CrossEntropyCost: expected %f but got %f", exp, c)
+	}
+	checkCostFuncGradients(t, ce, label, probs.Vector)
+
+	logProbs := (&LogSoftmaxLayer{}).Apply(&autofunc.Variable{Vector: linalg.Vector{1, 2, 0, -1}})
+	dot := LabelSmoothingCost{CostFunc: DotCost{}, Smoothing: 0.1}
+	exp = DotCost{}.Cost(smoothed, logProbs).Output()[0]
+	if c := dot.Cost(label, logProbs).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("DotCost: expected %f but got %f", exp, c)
+	}
+
+	plain := LabelSmoothingCost{CostFunc: DotCost{}}
+	exp = DotCost{}.Cost(label, logProbs).Output()[0]
+	if c := plain.Cost(label, logProbs).Output()[0]; c != exp {
+		t.Errorf("no smoothing: expected %f but got %f", exp, c)
+	}
+}
@@ -0,0 +1,286 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// HingeCost implements the SVM hinge loss.
+//
+// The expected vector contains labels of 1 or -1, and
+// the actual vector contains the corresponding scores.
+// The cost is the sum of max(0, Margin - y*a) over all
+// components.
+// If Margin is 0, a margin of 1 is used.
+//
+// Components which are beyond the margin (including
+// those exactly on it) have a sub-gradient of 0.
+type HingeCost struct {
+	Margin float64
+}
+
+func (h HingeCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	yVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	u := autofunc.AddScaler(autofunc.Mul(yVar, a), h.margin())
+	mask := &autofunc.Variable{Vector: positiveMask(u.Output())}
+	return autofunc.SumAll(autofunc.Mul(mask, u))
+}
+
+func (h HingeCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	yVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	u := autofunc.AddScalerR(autofunc.MulR(yVar, a), h.margin())
+	mask := &autofunc.Variable{Vector: positiveMask(u.Output())}
+	return autofunc.SumAllR(autofunc.MulR(autofunc.NewRVariable(mask, v), u))
+}
+
+func (h HingeCost) margin() float64 {
+	if h.Margin == 0 {
+		return 1
+	}
+	return h.Margin
+}
+
+// HuberizedHingeCost implements a smooth version of the
+// hinge loss.
+//
+// The expected vector contains labels of 1 or -1, and
+// the actual vector contains the corresponding scores.
+// For each label y and score a, let u = Margin - y*a.
+// The cost is 0 when u <= 0, u^2/(2*Delta) when
+// 0 < u <= Delta, and u - Delta/2 when u > Delta, summed
+// over all components.
+// Both the cost and its gradient are continuous, and the
+// cost grows linearly for badly misclassified scores.
+//
+// As with HingeCost, a Margin of 0 means a margin of 1.
+// If Delta is 0 or negative, there is no quadratic
+// region, and the cost is equivalent to HingeCost.
+type HuberizedHingeCost struct {
+	Margin float64
+	Delta  float64
+}
+
+func (h HuberizedHingeCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if h.Delta <= 0 {
+		return HingeCost{Margin: h.Margin}.Cost(x, a)
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		yVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+		u := autofunc.AddScaler(autofunc.Mul(yVar, a), HingeCost{Margin: h.Margin}.margin())
+		return h.smoothHinge(u)
+	})
+}
+
+func (h HuberizedHingeCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if h.Delta <= 0 {
+		return HingeCost{Margin: h.Margin}.CostR(v, x, a)
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		yVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+		u := autofunc.AddScalerR(autofunc.MulR(yVar, a), HingeCost{Margin: h.Margin}.margin())
+		return h.smoothHingeR(v, u)
+	})
+}
+
+// smoothHinge sums the Huberized hinge of each
+// component of u, i.e. of each margin violation.
+// Delta must be positive.
+func (h HuberizedHingeCost) smoothHinge(u autofunc.Result) autofunc.Result {
+	quadMask, linMask := h.masks(u.Output())
+	quad := autofunc.Scale(autofunc.Square(autofunc.Mul(&autofunc.Variable{Vector: quadMask},
+		u)), 1/(2*h.Delta))
+	lin := autofunc.Mul(&autofunc.Variable{Vector: linMask},
+		autofunc.AddScaler(u, -h.Delta/2))
+	return autofunc.SumAll(autofunc.Add(quad, lin))
+}
+
+func (h HuberizedHingeCost) smoothHingeR(v autofunc.RVector, u autofunc.RResult) autofunc.RResult {
+	quadMask, linMask := h.masks(u.Output())
+	quadVar := autofunc.NewRVariable(&autofunc.Variable{Vector: quadMask}, v)
+	linVar := autofunc.NewRVariable(&autofunc.Variable{Vector: linMask}, v)
+	quad := autofunc.ScaleR(autofunc.SquareR(autofunc.MulR(quadVar, u)), 1/(2*h.Delta))
+	lin := autofunc.MulR(linVar, autofunc.AddScalerR(u, -h.Delta/2))
+	return autofunc.SumAllR(autofunc.AddR(quad, lin))
+}
+
+func (h HuberizedHingeCost) masks(u linalg.Vector) (quadMask, linMask linalg.Vector) {
+	quadMask = make(linalg.Vector, len(u))
+	linMask = make(linalg.Vector, len(u))
+	for i, x := range u {
+		if x > h.Delta {
+			linMask[i] = 1
+		} else if x > 0 {
+			quadMask[i] = 1
+		}
+	}
+	return
+}
+
+// TopKCost is a smooth surrogate loss for top-k
+// accuracy, following Berrada et al. (2018).
+//
+// The expected vector is a one-hot vector for the true
+// class, and the actual vector contains a score for
+// every class.
+// The cost is a Huberized hinge (see HuberizedHingeCost)
+// of s_k - s_t, where s_t is the score of the true class
+// and s_k is a smooth approximation of the K-th largest
+// score of the other classes.
+// Thus, the cost is 0 whenever the true class is
+// comfortably among the top K scores, and otherwise it
+// grows with the gap which the true score must close.
+//
+// The approximation of the K-th largest score is the
+// difference between smoothed sums of the top K and top
+// K-1 scores, where the smoothed top-j sum is
+//
+//	T*log(sum over j-subsets S of exp(sum(S)/T))
+//
+// and T is Temperature.
+// As T approaches 0, this approaches the exact K-th
+// largest score; larger temperatures spread the
+// gradient over more of the competing scores.
+// For K=1, it is a log-sum-exp of the other scores.
+//
+// If Temperature is 0, a temperature of 1 is used.
+// If Delta is 0, a Delta of 1 is used.
+type TopKCost struct {
+	K           int
+	Temperature float64
+	Delta       float64
+}
+
+func (t TopKCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	trueClass, ok := t.trueClass(x, a.Output())
+	if !ok {
+		return &autofunc.Variable{Vector: linalg.Vector{0}}
+	}
+	temp := t.temperature()
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		scaled := autofunc.Scale(a, 1/temp)
+		return autofunc.Pool(scaled, func(scaled autofunc.Result) autofunc.Result {
+			// logSums[j] is the log of the j-th elementary
+			// symmetric polynomial of the other classes'
+			// exp(score/T), accumulated in the log domain so
+			// that large score spreads cannot underflow.
+			logSums := []autofunc.Result{&autofunc.Variable{Vector: linalg.Vector{0}}}
+			for i := range x {
+				if i == trueClass {
+					continue
+				}
+				score := autofunc.Slice(scaled, i, i+1)
+				if len(logSums) <= t.K {
+					logSums = append(logSums, nil)
+				}
+				for j := len(logSums) - 1; j > 0; j-- {
+					term := autofunc.Add(score, logSums[j-1])
+					if logSums[j] == nil {
+						logSums[j] = term
+					} else {
+						logSums[j] = logAddExp(logSums[j], term)
+					}
+				}
+			}
+			logRatio := autofunc.Add(logSums[t.K], autofunc.Scale(logSums[t.K-1], -1))
+			kth := autofunc.Scale(logRatio, temp)
+			gap := autofunc.Add(kth, autofunc.Scale(autofunc.Slice(a, trueClass, trueClass+1), -1))
+			return HuberizedHingeCost{Delta: t.delta()}.smoothHinge(gap)
+		})
+	})
+}
+
+func (t TopKCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	trueClass, ok := t.trueClass(x, a.Output())
+	if !ok {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+	}
+	temp := t.temperature()
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		scaled := autofunc.ScaleR(a, 1/temp)
+		return autofunc.PoolR(scaled, func(scaled autofunc.RResult) autofunc.RResult {
+			zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+			logSums := []autofunc.RResult{autofunc.NewRVariable(zero, v)}
+			for i := range x {
+				if i == trueClass {
+					continue
+				}
+				score := autofunc.SliceR(scaled, i, i+1)
+				if len(logSums) <= t.K {
+					logSums = append(logSums, nil)
+				}
+				for j := len(logSums) - 1; j > 0; j-- {
+					term := autofunc.AddR(score, logSums[j-1])
+					if logSums[j] == nil {
+						logSums[j] = term
+					} else {
+						logSums[j] = logAddExpR(v, logSums[j], term)
+					}
+				}
+			}
+			logRatio := autofunc.AddR(logSums[t.K], autofunc.ScaleR(logSums[t.K-1], -1))
+			kth := autofunc.ScaleR(logRatio, temp)
+			gap := autofunc.AddR(kth,
+				autofunc.ScaleR(autofunc.SliceR(a, trueClass, trueClass+1), -1))
+			return HuberizedHingeCost{Delta: t.delta()}.smoothHingeR(v, gap)
+		})
+	})
+}
+
+// trueClass returns the index of the true class.
+// It returns false if there are at most K-1 other
+// classes, in which case the true class is always in
+// the top K.
+func (t TopKCost) trueClass(x, a linalg.Vector) (int, bool) {
+	if t.K <= 0 {
+		panic("K must be positive")
+	}
+	if t.Temperature < 0 || t.Delta < 0 {
+		panic("Temperature and Delta must not be negative")
+	}
+	if len(x) != len(a) {
+		panic("expected and actual sizes must match")
+	}
+	return maxIndex(x), len(a)-1 >= t.K
+}
+
+func (t TopKCost) temperature() float64 {
+	if t.Temperature == 0 {
+		return 1
+	}
+	return t.Temperature
+}
+
+func (t TopKCost) delta() float64 {
+	if t.Delta == 0 {
+		return 1
+	}
+	return t.Delta
+}
+
+// logAddExp computes log(exp(p)+exp(q)) for scalars p
+// and q, factoring out the larger one so that the
+// exponential cannot overflow or lose the result.
+func logAddExp(p, q autofunc.Result) autofunc.Result {
+	if p.Output()[0] < q.Output()[0] {
+		p, q = q, p
+	}
+	return autofunc.Pool(p, func(p autofunc.Result) autofunc.Result {
+		diff := autofunc.Add(q, autofunc.Scale(p, -1))
+		return autofunc.Add(p, autofunc.Log{}.Apply(
+			autofunc.AddScaler(autofunc.Exp{}.Apply(diff), 1)))
+	})
+}
+
+func logAddExpR(v autofunc.RVector, p, q autofunc.RResult) autofunc.RResult {
+	if p.Output()[0] < q.Output()[0] {
+		p, q = q, p
+	}
+	return autofunc.PoolR(p, func(p autofunc.RResult) autofunc.RResult {
+		diff := autofunc.AddR(q, autofunc.ScaleR(p, -1))
+		return autofunc.AddR(p, autofunc.Log{}.ApplyR(v,
+			autofunc.AddScalerR(autofunc.Exp{}.ApplyR(v, diff), 1)))
+	})
+}
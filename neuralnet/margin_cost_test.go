@@ -0,0 +1,149 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestHingeCost(t *testing.T) {
+	expected := linalg.Vector{1, -1, 1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, -0.8, -1, -3}}
+	cost := HingeCost{}.Cost(expected, actual)
+
+	// The margin violations are 0, 0.2, 2, and 0.
+	if c := cost.Output()[0]; math.Abs(c-2.2) > 1e-8 {
+		t.Errorf("expected 2.2 but got %f", c)
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.PropagateGradient(linalg.Vector{1}, grad)
+	expGrad := linalg.Vector{0, 1, -1, 0}
+	if grad[actual].Copy().Scale(-1).Add(expGrad).MaxAbs() > 1e-8 {
+		t.Errorf("expected gradient %v but got %v", expGrad, grad[actual])
+	}
+
+	checkCostFuncGradients(t, HingeCost{Margin: 0.5}, expected, linalg.Vector{1.3, -0.3, -2, 1})
+}
+
+func TestHuberizedHingeCostValues(t *testing.T) {
+	cost := HuberizedHingeCost{Margin: 1, Delta: 0.5}
+	expected := linalg.Vector{1, -1, 1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, -0.8, -1}}
+
+	// The margin violations are 0, 0.2, and 2.
+	exp := 0.2*0.2/1 + (2 - 0.25)
+	if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-8 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	checkCostFuncGradients(t, cost, expected, linalg.Vector{1.3, -0.7, -2})
+}
+
+func TestHuberizedHingeCostContinuity(t *testing.T) {
+	cost := HuberizedHingeCost{Margin: 1, Delta: 0.5}
+	gradAt := func(score float64) float64 {
+		actual := &autofunc.Variable{Vector: linalg.Vector{score}}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		cost.Cost(linalg.Vector{1}, actual).PropagateGradient(linalg.Vector{1}, grad)
+		return grad[actual][0]
+	}
+	for _, point := range []float64{1, 0.5} {
+		below, above := gradAt(point-1e-6), gradAt(point+1e-6)
+		if math.Abs(below-above) > 1e-4 {
+			t.Errorf("gradient jumps at %f: %f vs %f", point, below, above)
+		}
+	}
+	if g := gradAt(-3); g != -1 {
+		t.Errorf("linear region should have gradient -1 but got %f", g)
+	}
+}
+
+func TestHuberizedHingeCostDefaults(t *testing.T) {
+	expected := linalg.Vector{1, -1, 1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, -0.8, -1}}
+	for _, margin := range []float64{0, 1} {
+		c := HuberizedHingeCost{Margin: margin}.Cost(expected, actual).Output()[0]
+		exp := HingeCost{}.Cost(expected, actual).Output()[0]
+		if math.Abs(c-exp) > 1e-10 {
+			t.Errorf("margin %f: expected %f but got %f", margin, exp, c)
+		}
+	}
+	c := HuberizedHingeCost{Delta: 0.5}.Cost(expected, actual).Output()[0]
+	exp := HuberizedHingeCost{Margin: 1, Delta: 0.5}.Cost(expected, actual).Output()[0]
+	if c != exp {
+		t.Errorf("zero margin: expected %f but got %f", exp, c)
+	}
+}
+
+func TestTopKCost(t *testing.T) {
+	scores := &autofunc.Variable{Vector: linalg.Vector{3, 1, 2, 0.5, 4}}
+	label := linalg.Vector{0, 0, 1, 0, 0}
+
+	for k := 3; k <= 6; k++ {
+		cost := TopKCost{K: k, Temperature: 0.1, Delta: 0.5}
+		if c := cost.Cost(label, scores).Output()[0]; c != 0 {
+			t.Errorf("K=%d: true class is in the top K, but the cost is %f", k, c)
+		}
+	}
+
+	// At a low temperature, the K-th largest other score is
+	// nearly exact, so the gaps are 1 and 2.
+	for k, gap := range map[int]float64{1: 2, 2: 1} {
+		cost := TopKCost{K: k, Temperature: 0.01, Delta: 0.5}
+		if c := cost.Cost(label, scores).Output()[0]; math.Abs(c-(gap-0.25)) > 1e-2 {
+			t.Errorf("K=%d: expected about %f but got %f", k, gap-0.25, c)
+		}
+	}
+
+	// At a higher temperature, every other score competes
+	// for the K-th place and receives some gradient.
+	cost := TopKCost{K: 2, Temperature: 1, Delta: 0.5}
+	grad := autofunc.NewGradient([]*autofunc.Variable{scores})
+	cost.Cost(label, scores).PropagateGradient(linalg.Vector{1}, grad)
+	for i, x := range grad[scores] {
+		if i == 2 && x >= 0 {
+			t.Errorf("true class should have a negative gradient, got %v", grad[scores])
+		} else if i != 2 && x <= 0 {
+			t.Errorf("class %d should have a positive gradient, got %v", i, grad[scores])
+		}
+	}
+	checkCostFuncGradients(t, cost, label, scores.Vector)
+	checkCostFuncGradients(t, TopKCost{K: 1, Temperature: 0.5}, label, scores.Vector)
+}
+
+func TestTopKCostLargeSpread(t *testing.T) {
+	label := linalg.Vector{1, 0, 0}
+	for _, c := range []struct {
+		Cost   TopKCost
+		Scores linalg.Vector
+	}{
+		{TopKCost{K: 2, Temperature: 0.01}, linalg.Vector{5, 0, -8}},
+		{TopKCost{K: 2}, linalg.Vector{5, 0, -1000}},
+	} {
+		scores := &autofunc.Variable{Vector: c.Scores}
+		out := c.Cost.Cost(label, scores)
+		grad := autofunc.NewGradient([]*autofunc.Variable{scores})
+		out.PropagateGradient(linalg.Vector{1}, grad)
+		if out.Output()[0] != 0 {
+			t.Errorf("%v: expected cost 0 but got %v", c.Scores, out.Output())
+		}
+		for _, x := range grad[scores] {
+			if x != 0 {
+				t.Errorf("%v: expected zero gradient but got %v", c.Scores, grad[scores])
+				break
+			}
+		}
+	}
+
+	// A wide spread outside of the top K must still give
+	// a finite, accurate cost.
+	scores := &autofunc.Variable{Vector: linalg.Vector{-5, 0, 3, -1000}}
+	cost := TopKCost{K: 2, Temperature: 0.01, Delta: 0.5}
+	if c := cost.Cost(linalg.Vector{1, 0, 0, 0}, scores).Output()[0]; math.Abs(c-4.75) > 1e-2 {
+		t.Errorf("expected about 4.75 but got %f", c)
+	}
+	checkCostFuncGradients(t, cost, linalg.Vector{1, 0, 0, 0}, scores.Vector)
+}
@@ -0,0 +1,110 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// A MatrixCost is a CostFunc which can evaluate a batch
+// whose expected outputs are the rows of a matrix.
+//
+// The actual Result contains the concatenated outputs of
+// the given number of rows, as produced by an
+// autofunc.Batcher.
+// The result is the sum of the per-row costs, where each
+// row is normalized on its own (e.g. by a softmax).
+//
+// MeanSquaredCost, AbsCost, CrossEntropyCost, and
+// SoftmaxCECost are sums of independent per-component
+// terms (CrossEntropyCost being a binary cross entropy on
+// each component, and SoftmaxCECost expecting rows which
+// were already normalized by a softmax), so they need no
+// further per-row normalization and evaluate the whole
+// matrix in a single Result.
+// Other costs are evaluated one row at a time by
+// CostMatrix, so they need not implement MatrixCost to
+// be normalized correctly.
+type MatrixCost interface {
+	CostFunc
+
+	CostMatrix(expected linalg.Matrix, actual autofunc.Result, rows int) autofunc.Result
+	CostMatrixR(v autofunc.RVector, expected linalg.Matrix, actual autofunc.RResult,
+		rows int) autofunc.RResult
+}
+
+// CostMatrix computes the total cost of a batch whose
+// expected outputs are the rows of a matrix.
+//
+// If c is a MatrixCost, its CostMatrix method is used.
+// Otherwise, the batch is evaluated with BatchCost, which
+// applies c to each row separately unless c is a
+// BatchCostFunc.
+// Either way, costs which normalize over their input see
+// one row at a time.
+func CostMatrix(c CostFunc, expected linalg.Matrix, actual autofunc.Result) autofunc.Result {
+	if mc, ok := c.(MatrixCost); ok {
+		return mc.CostMatrix(expected, actual, expected.Rows)
+	}
+	return BatchCost(c, expected.Data, actual, expected.Rows)
+}
+
+// CostMatrixR is like CostMatrix, but for RResults.
+func CostMatrixR(v autofunc.RVector, c CostFunc, expected linalg.Matrix,
+	actual autofunc.RResult) autofunc.RResult {
+	if mc, ok := c.(MatrixCost); ok {
+		return mc.CostMatrixR(v, expected, actual, expected.Rows)
+	}
+	return BatchCostR(v, c, expected.Data, actual, expected.Rows)
+}
+
+func (_ MeanSquaredCost) CostMatrix(x linalg.Matrix, a autofunc.Result,
+	rows int) autofunc.Result {
+	checkMatrixRows(x, rows)
+	return MeanSquaredCost{}.BatchCost(x.Data, a, rows)
+}
+
+func (_ MeanSquaredCost) CostMatrixR(v autofunc.RVector, x linalg.Matrix,
+	a autofunc.RResult, rows int) autofunc.RResult {
+	checkMatrixRows(x, rows)
+	return MeanSquaredCost{}.BatchCostR(v, x.Data, a, rows)
+}
+
+func (_ AbsCost) CostMatrix(x linalg.Matrix, a autofunc.Result, rows int) autofunc.Result {
+	checkMatrixRows(x, rows)
+	return AbsCost{}.BatchCost(x.Data, a, rows)
+}
+
+func (_ AbsCost) CostMatrixR(v autofunc.RVector, x linalg.Matrix,
+	a autofunc.RResult, rows int) autofunc.RResult {
+	checkMatrixRows(x, rows)
+	return AbsCost{}.BatchCostR(v, x.Data, a, rows)
+}
+
+func (c CrossEntropyCost) CostMatrix(x linalg.Matrix, a autofunc.Result,
+	rows int) autofunc.Result {
+	checkMatrixRows(x, rows)
+	return c.BatchCost(x.Data, a, rows)
+}
+
+func (c CrossEntropyCost) CostMatrixR(v autofunc.RVector, x linalg.Matrix,
+	a autofunc.RResult, rows int) autofunc.RResult {
+	checkMatrixRows(x, rows)
+	return c.BatchCostR(v, x.Data, a, rows)
+}
+
+func (_ SoftmaxCECost) CostMatrix(x linalg.Matrix, a autofunc.Result, rows int) autofunc.Result {
+	checkMatrixRows(x, rows)
+	return SoftmaxCECost{}.Cost(x.Data, a)
+}
+
+func (_ SoftmaxCECost) CostMatrixR(v autofunc.RVector, x linalg.Matrix,
+	a autofunc.RResult, rows int) autofunc.RResult {
+	checkMatrixRows(x, rows)
+	return SoftmaxCECost{}.CostR(v, x.Data, a)
+}
+
+func checkMatrixRows(x linalg.Matrix, rows int) {
+	if x.Rows != rows || len(x.Data) != x.Rows*x.Cols {
+		panic("expected matrix does not match row count")
+	}
+}
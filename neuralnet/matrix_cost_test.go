@@ -0,0 +1,50 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestCostMatrix(t *testing.T) {
+	expected := linalg.Matrix{
+		Rows: 3,
+		Cols: 2,
+		Data: []float64{1, 0, 0, 1, 0.3, 0.7},
+	}
+	actual := linalg.Vector{0.2, 0.6, 0.9, 0.4, 0.5, 0.1}
+	costs := []CostFunc{MeanSquaredCost{}, AbsCost{}, CrossEntropyCost{}, SoftmaxCECost{},
+		softmaxCETestCost{}}
+	for _, c := range costs {
+		actualVar := &autofunc.Variable{Vector: actual}
+		out := CostMatrix(c, expected, actualVar)
+		grad := autofunc.NewGradient([]*autofunc.Variable{actualVar})
+		out.PropagateGradient(linalg.Vector{1}, grad)
+
+		var expCost float64
+		expGrad := make(linalg.Vector, len(actual))
+		for i := 0; i < expected.Rows; i++ {
+			row := &autofunc.Variable{Vector: actual[i*2 : (i+1)*2].Copy()}
+			rowOut := c.Cost(expected.Data[i*2:(i+1)*2], row)
+			expCost += rowOut.Output()[0]
+			rowGrad := autofunc.NewGradient([]*autofunc.Variable{row})
+			rowOut.PropagateGradient(linalg.Vector{1}, rowGrad)
+			copy(expGrad[i*2:], rowGrad[row])
+		}
+
+		if math.Abs(out.Output()[0]-expCost) > 1e-10 {
+			t.Errorf("%T: expected cost %f but got %f", c, expCost, out.Output()[0])
+		}
+		if grad[actualVar].Copy().Scale(-1).Add(expGrad).MaxAbs() > 1e-10 {
+			t.Errorf("%T: expected gradient %v but got %v", c, expGrad, grad[actualVar])
+		}
+
+		rv := autofunc.RVector{actualVar: linalg.Vector{1, -1, 0.5, 0.2, 0, 0.3}}
+		outR := CostMatrixR(rv, c, expected, autofunc.NewRVariable(actualVar, rv))
+		if math.Abs(outR.Output()[0]-expCost) > 1e-10 {
+			t.Errorf("%T: expected R cost %f but got %f", c, expCost, outR.Output()[0])
+		}
+	}
+}
@@ -0,0 +1,734 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// CosFaceCost implements the large margin cosine loss
+// from Wang et al. (2018).
+//
+// The actual vector contains the cosine similarity
+// between an embedding and each class's weight vector,
+// and the expected vector is a one-hot class vector.
+// The cosines are clamped to [-1, 1], Margin is
+// subtracted from the cosine of the correct class, and
+// the result is multiplied by Scale and fed through a
+// softmax cross entropy loss.
+type CosFaceCost struct {
+	Margin float64
+	Scale  float64
+}
+
+func (c CosFaceCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	margins := &autofunc.Variable{Vector: x.Copy().Scale(-c.Margin)}
+	logits := autofunc.Scale(autofunc.Add(clamp(a, -1, 1), margins), c.Scale)
+	return DotCost{}.Cost(x, (&LogSoftmaxLayer{}).Apply(logits))
+}
+
+func (c CosFaceCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	margins := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-c.Margin)}, v)
+	logits := autofunc.ScaleR(autofunc.AddR(clampR(v, a, -1, 1), margins), c.Scale)
+	return DotCost{}.CostR(v, x, (&LogSoftmaxLayer{}).ApplyR(v, logits))
+}
+
+// AngularCost implements the angular loss from Wang et
+// al. (2017) for a single triplet.
+//
+// The actual vector is the concatenation of an anchor,
+// a positive, and a negative embedding of equal sizes.
+// The cost is
+//
+//	max(0, ||a-p||^2 - 4*tan(Alpha)^2*||n-c||^2)
+//
+// where c is the midpoint between the anchor and the
+// positive, and Alpha is an angle in radians.
+// This bounds the angle at the negative point of the
+// triangle formed by the triplet, making the cost
+// invariant to the scale of the embeddings.
+// The expected vector is ignored.
+type AngularCost struct {
+	Alpha float64
+}
+
+func (c AngularCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	checkTripletSize(a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		parts := autofunc.Split(3, a)
+		anchor, positive, negative := parts[0], parts[1], parts[2]
+		posDist := autofunc.SquaredNorm{}.Apply(autofunc.Add(anchor, autofunc.Scale(positive, -1)))
+		center := autofunc.Scale(autofunc.Add(anchor, positive), -0.5)
+		negDist := autofunc.SquaredNorm{}.Apply(autofunc.Add(negative, center))
+		tan := math.Tan(c.Alpha)
+		diff := autofunc.Add(posDist, autofunc.Scale(negDist, -4*tan*tan))
+		mask := &autofunc.Variable{Vector: positiveMask(diff.Output())}
+		return autofunc.Mul(mask, diff)
+	})
+}
+
+func (c AngularCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	checkTripletSize(a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		parts := autofunc.SplitR(3, a)
+		anchor, positive, negative := parts[0], parts[1], parts[2]
+		posDist := autofunc.SquaredNorm{}.ApplyR(v, autofunc.AddR(anchor,
+			autofunc.ScaleR(positive, -1)))
+		center := autofunc.ScaleR(autofunc.AddR(anchor, positive), -0.5)
+		negDist := autofunc.SquaredNorm{}.ApplyR(v, autofunc.AddR(negative, center))
+		tan := math.Tan(c.Alpha)
+		diff := autofunc.AddR(posDist, autofunc.ScaleR(negDist, -4*tan*tan))
+		mask := &autofunc.Variable{Vector: positiveMask(diff.Output())}
+		return autofunc.MulR(autofunc.NewRVariable(mask, v), diff)
+	})
+}
+
+// TripletCost implements the triplet margin loss for a
+// single triplet.
+//
+// The actual vector is the concatenation of an anchor,
+// a positive, and a negative embedding of equal sizes.
+// The cost is
+//
+//	max(0, ||a-p||^2 - ||a-n||^2 + Margin)
+//
+// so triplets whose negative is farther from the anchor
+// than the positive by at least Margin have a cost and a
+// gradient of 0.
+// The expected vector is ignored.
+type TripletCost struct {
+	Margin float64
+}
+
+func (c TripletCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	checkTripletSize(a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		parts := autofunc.Split(3, a)
+		anchor, positive, negative := parts[0], parts[1], parts[2]
+		negAnchor := autofunc.Scale(anchor, -1)
+		posDist := autofunc.SquaredNorm{}.Apply(autofunc.Add(positive, negAnchor))
+		negDist := autofunc.SquaredNorm{}.Apply(autofunc.Add(negative, negAnchor))
+		diff := autofunc.AddScaler(autofunc.Add(posDist, autofunc.Scale(negDist, -1)),
+			c.Margin)
+		mask := &autofunc.Variable{Vector: positiveMask(diff.Output())}
+		return autofunc.Mul(mask, diff)
+	})
+}
+
+func (c TripletCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	checkTripletSize(a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		parts := autofunc.SplitR(3, a)
+		anchor, positive, negative := parts[0], parts[1], parts[2]
+		negAnchor := autofunc.ScaleR(anchor, -1)
+		posDist := autofunc.SquaredNorm{}.ApplyR(v, autofunc.AddR(positive, negAnchor))
+		negDist := autofunc.SquaredNorm{}.ApplyR(v, autofunc.AddR(negative, negAnchor))
+		diff := autofunc.AddScalerR(autofunc.AddR(posDist, autofunc.ScaleR(negDist, -1)),
+			c.Margin)
+		mask := &autofunc.Variable{Vector: positiveMask(diff.Output())}
+		return autofunc.MulR(autofunc.NewRVariable(mask, v), diff)
+	})
+}
+
+func checkTripletSize(a linalg.Vector) {
+	if len(a)%3 != 0 {
+		panic("actual vector must contain three equally-sized embeddings")
+	}
+}
+
+// NPairCost implements the multi-class N-pair loss from
+// Sohn (2016).
+//
+// The actual vector is the concatenation of an anchor,
+// a positive, and one or more negative embeddings, each
+// with Dim components.
+// The cost is log(1 + sum_j exp(a*n_j - a*p)), where a is
+// the anchor, p is the positive, and n_j are negatives.
+// With a single negative, this is a smooth version of
+// the triplet loss on dot products.
+// The expected vector is ignored.
+type NPairCost struct {
+	Dim int
+}
+
+func (n NPairCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	count := n.embeddingCount(a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		embs := autofunc.Split(count, a)
+		posDot := dotProduct(embs[0], embs[1])
+		var negDots []autofunc.Result
+		for _, neg := range embs[2:] {
+			negDots = append(negDots, dotProduct(embs[0], neg))
+		}
+		diffs := autofunc.AddFirst(autofunc.Concat(negDots...), autofunc.Scale(posDot, -1))
+		zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+		return autofunc.SumAllLogDomain(autofunc.Concat(zero, diffs))
+	})
+}
+
+func (n NPairCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	count := n.embeddingCount(a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		embs := autofunc.SplitR(count, a)
+		posDot := dotProductR(embs[0], embs[1])
+		var negDots []autofunc.RResult
+		for _, neg := range embs[2:] {
+			negDots = append(negDots, dotProductR(embs[0], neg))
+		}
+		diffs := autofunc.AddFirstR(autofunc.ConcatR(negDots...), autofunc.ScaleR(posDot, -1))
+		zero := autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+		return autofunc.SumAllLogDomainR(autofunc.ConcatR(zero, diffs))
+	})
+}
+
+func (n NPairCost) embeddingCount(a linalg.Vector) int {
+	if n.Dim <= 0 || len(a)%n.Dim != 0 || len(a) < n.Dim*3 {
+		panic("actual vector must contain an anchor, a positive, and negatives")
+	}
+	return len(a) / n.Dim
+}
+
+// LiftedStructuredCost implements the lifted structured
+// embedding loss from Song et al. (2016).
+//
+// The actual vector contains a batch of concatenated
+// embeddings, and the expected vector contains an
+// integer class label for each embedding.
+// The embedding size is inferred from the two lengths.
+//
+// For every pair of embeddings i, j with the same label,
+// the cost includes max(0, J_ij)^2, where J_ij is the
+// distance between i and j plus the log-sum-exp of
+// Margin minus the distance from i or j to every
+// embedding with a different label.
+// The sum is divided by twice the number of positive
+// pairs.
+type LiftedStructuredCost struct {
+	Margin float64
+}
+
+func (l LiftedStructuredCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	checkLabeledBatch(x, a.Output())
+	pairs := positivePairs(x)
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		embs := autofunc.Split(len(x), a)
+		dists := make([][]autofunc.Result, len(embs))
+		for i := range dists {
+			dists[i] = make([]autofunc.Result, len(embs))
+			for j := 0; j < i; j++ {
+				dists[i][j] = euclideanDistance(embs[i], embs[j])
+				dists[j][i] = dists[i][j]
+			}
+		}
+		var terms []autofunc.Result
+		for _, pair := range pairs {
+			var negTerms []autofunc.Result
+			for _, i := range pair {
+				for k, label := range x {
+					if label != x[i] {
+						negTerms = append(negTerms,
+							autofunc.AddScaler(autofunc.Scale(dists[i][k], -1), l.Margin))
+					}
+				}
+			}
+			if len(negTerms) == 0 {
+				continue
+			}
+			negSum := autofunc.SumAllLogDomain(autofunc.Concat(negTerms...))
+			terms = append(terms, autofunc.Add(negSum, dists[pair[0]][pair[1]]))
+		}
+		if len(terms) == 0 {
+			return &autofunc.Variable{Vector: linalg.Vector{0}}
+		}
+		joined := autofunc.Concat(terms...)
+		mask := &autofunc.Variable{Vector: positiveMask(joined.Output())}
+		hinged := autofunc.SquaredNorm{}.Apply(autofunc.Mul(mask, joined))
+		return autofunc.Scale(hinged, 1/float64(2*len(pairs)))
+	})
+}
+
+func (l LiftedStructuredCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	checkLabeledBatch(x, a.Output())
+	pairs := positivePairs(x)
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		embs := autofunc.SplitR(len(x), a)
+		dists := make([][]autofunc.RResult, len(embs))
+		for i := range dists {
+			dists[i] = make([]autofunc.RResult, len(embs))
+			for j := 0; j < i; j++ {
+				dists[i][j] = euclideanDistanceR(v, embs[i], embs[j])
+				dists[j][i] = dists[i][j]
+			}
+		}
+		var terms []autofunc.RResult
+		for _, pair := range pairs {
+			var negTerms []autofunc.RResult
+			for _, i := range pair {
+				for k, label := range x {
+					if label != x[i] {
+						negTerms = append(negTerms,
+							autofunc.AddScalerR(autofunc.ScaleR(dists[i][k], -1), l.Margin))
+					}
+				}
+			}
+			if len(negTerms) == 0 {
+				continue
+			}
+			negSum := autofunc.SumAllLogDomainR(autofunc.ConcatR(negTerms...))
+			terms = append(terms, autofunc.AddR(negSum, dists[pair[0]][pair[1]]))
+		}
+		if len(terms) == 0 {
+			return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+		}
+		joined := autofunc.ConcatR(terms...)
+		mask := &autofunc.Variable{Vector: positiveMask(joined.Output())}
+		hinged := autofunc.SquaredNorm{}.ApplyR(v,
+			autofunc.MulR(autofunc.NewRVariable(mask, v), joined))
+		return autofunc.ScaleR(hinged, 1/float64(2*len(pairs)))
+	})
+}
+
+// checkLabeledBatch ensures that an actual vector can be
+// split into one embedding per label.
+func checkLabeledBatch(labels, a linalg.Vector) {
+	if len(labels) == 0 || len(a)%len(labels) != 0 {
+		panic("actual vector must contain one embedding per label")
+	}
+}
+
+// positivePairs returns every pair of indices i < j for
+// which the labels are equal.
+func positivePairs(labels linalg.Vector) [][2]int {
+	var res [][2]int
+	for i, label1 := range labels {
+		for j := i + 1; j < len(labels); j++ {
+			if labels[j] == label1 {
+				res = append(res, [2]int{i, j})
+			}
+		}
+	}
+	return res
+}
+
+// distanceEpsilon is added to squared distances before
+// taking their square roots, keeping the gradient finite
+// for coincident embeddings.
+const distanceEpsilon = 1e-12
+
+func euclideanDistance(a, b autofunc.Result) autofunc.Result {
+	sq := autofunc.SquaredNorm{}.Apply(autofunc.Add(a, autofunc.Scale(b, -1)))
+	logSq := autofunc.Log{}.Apply(autofunc.AddScaler(sq, distanceEpsilon))
+	return autofunc.Exp{}.Apply(autofunc.Scale(logSq, 0.5))
+}
+
+func euclideanDistanceR(v autofunc.RVector, a, b autofunc.RResult) autofunc.RResult {
+	sq := autofunc.SquaredNorm{}.ApplyR(v, autofunc.AddR(a, autofunc.ScaleR(b, -1)))
+	logSq := autofunc.Log{}.ApplyR(v, autofunc.AddScalerR(sq, distanceEpsilon))
+	return autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(logSq, 0.5))
+}
+
+// CircleCost implements the circle loss from Sun et al.
+// (2020).
+//
+// The actual vector contains similarity scores (e.g.
+// cosine similarities), and the expected vector has a 1
+// for every within-class similarity and a 0 for every
+// between-class similarity.
+// For class-level labels, the scores are similarities to
+// each class's proxy and the expected vector is one-hot.
+// For pair-level labels, the scores are similarities
+// between an anchor and other embeddings in a batch, as
+// computed by CosineSimilarities.
+//
+// Each similarity is re-weighted by its distance from an
+// optimum (1+Margin for within-class similarities and
+// -Margin for between-class ones), so that similarities
+// far from their optimum receive larger gradients.
+// These weights are treated as constants, as in the
+// original paper.
+type CircleCost struct {
+	Margin float64
+	Scale  float64
+}
+
+func (c CircleCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	posIdx, negIdx := c.splitIndices(x, a.Output())
+	if len(posIdx) == 0 || len(negIdx) == 0 {
+		return &autofunc.Variable{Vector: linalg.Vector{0}}
+	}
+	coeffs, offsets := c.logitParams(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logits := autofunc.Mul(&autofunc.Variable{Vector: coeffs},
+			autofunc.Add(a, &autofunc.Variable{Vector: offsets}))
+		var posLogits, negLogits []autofunc.Result
+		for _, i := range posIdx {
+			posLogits = append(posLogits, autofunc.Slice(logits, i, i+1))
+		}
+		for _, i := range negIdx {
+			negLogits = append(negLogits, autofunc.Slice(logits, i, i+1))
+		}
+		return softplus(autofunc.Add(
+			autofunc.SumAllLogDomain(autofunc.Concat(posLogits...)),
+			autofunc.SumAllLogDomain(autofunc.Concat(negLogits...)),
+		))
+	})
+}
+
+func (c CircleCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	posIdx, negIdx := c.splitIndices(x, a.Output())
+	if len(posIdx) == 0 || len(negIdx) == 0 {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+	}
+	coeffs, offsets := c.logitParams(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		coeffVar := autofunc.NewRVariable(&autofunc.Variable{Vector: coeffs}, v)
+		offsetVar := autofunc.NewRVariable(&autofunc.Variable{Vector: offsets}, v)
+		logits := autofunc.MulR(coeffVar, autofunc.AddR(a, offsetVar))
+		var posLogits, negLogits []autofunc.RResult
+		for _, i := range posIdx {
+			posLogits = append(posLogits, autofunc.SliceR(logits, i, i+1))
+		}
+		for _, i := range negIdx {
+			negLogits = append(negLogits, autofunc.SliceR(logits, i, i+1))
+		}
+		return softplusR(v, autofunc.AddR(
+			autofunc.SumAllLogDomainR(autofunc.ConcatR(posLogits...)),
+			autofunc.SumAllLogDomainR(autofunc.ConcatR(negLogits...)),
+		))
+	})
+}
+
+func (c CircleCost) splitIndices(x, a linalg.Vector) (posIdx, negIdx []int) {
+	if len(x) != len(a) {
+		panic("expected and actual sizes must match")
+	}
+	for i, label := range x {
+		if label != 0 {
+			posIdx = append(posIdx, i)
+		} else {
+			negIdx = append(negIdx, i)
+		}
+	}
+	return
+}
+
+// logitParams computes the constant coefficients and
+// offsets which turn similarities into circle loss
+// logits via coeff*(sim+offset).
+func (c CircleCost) logitParams(x, a linalg.Vector) (coeffs, offsets linalg.Vector) {
+	coeffs = make(linalg.Vector, len(x))
+	offsets = make(linalg.Vector, len(x))
+	for i, label := range x {
+		if label != 0 {
+			weight := math.Max(0, 1+c.Margin-a[i])
+			coeffs[i] = -c.Scale * weight
+			offsets[i] = c.Margin - 1
+		} else {
+			weight := math.Max(0, a[i]+c.Margin)
+			coeffs[i] = c.Scale * weight
+			offsets[i] = -c.Margin
+		}
+	}
+	return
+}
+
+// multiSimilarityEpsilon is the margin used by
+// MultiSimilarityCost to mine informative pairs.
+const multiSimilarityEpsilon = 0.1
+
+// MultiSimilarityCost implements the multi-similarity
+// loss from Wang et al. (2019).
+//
+// The actual vector contains a batch of concatenated
+// embeddings, and the expected vector contains an
+// integer class label for each embedding.
+// Embeddings are compared by cosine similarity.
+//
+// For each anchor, a negative is mined if its similarity
+// exceeds the lowest positive similarity minus a small
+// margin, and a positive is mined if its similarity is
+// below the highest negative similarity plus the margin.
+// The mined pairs are weighted through a soft log-sum-exp
+// around the similarity threshold Lambda, where Alpha
+// scales positive similarities and Beta scales negative
+// ones.
+// The cost is averaged over anchors.
+type MultiSimilarityCost struct {
+	Alpha  float64
+	Beta   float64
+	Lambda float64
+}
+
+func (m MultiSimilarityCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	checkLabeledBatch(x, a.Output())
+	dim := len(a.Output()) / len(x)
+	return autofunc.Pool(CosineSimilarities(a, dim), func(sims autofunc.Result) autofunc.Result {
+		var terms []autofunc.Result
+		for i := range x {
+			posIdx, negIdx := m.minePairs(x, sims.Output(), i)
+			if len(posIdx) > 0 {
+				var logits []autofunc.Result
+				for _, j := range posIdx {
+					logits = append(logits, autofunc.Slice(sims, j, j+1))
+				}
+				scaled := autofunc.AddScaler(autofunc.Scale(autofunc.Concat(logits...),
+					-m.Alpha), m.Alpha*m.Lambda)
+				zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+				terms = append(terms, autofunc.Scale(autofunc.SumAllLogDomain(
+					autofunc.Concat(zero, scaled)), 1/m.Alpha))
+			}
+			if len(negIdx) > 0 {
+				var logits []autofunc.Result
+				for _, j := range negIdx {
+					logits = append(logits, autofunc.Slice(sims, j, j+1))
+				}
+				scaled := autofunc.AddScaler(autofunc.Scale(autofunc.Concat(logits...),
+					m.Beta), -m.Beta*m.Lambda)
+				zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+				terms = append(terms, autofunc.Scale(autofunc.SumAllLogDomain(
+					autofunc.Concat(zero, scaled)), 1/m.Beta))
+			}
+		}
+		if len(terms) == 0 {
+			return &autofunc.Variable{Vector: linalg.Vector{0}}
+		}
+		return autofunc.Scale(autofunc.SumAll(autofunc.Concat(terms...)), 1/float64(len(x)))
+	})
+}
+
+func (m MultiSimilarityCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	checkLabeledBatch(x, a.Output())
+	dim := len(a.Output()) / len(x)
+	sims := CosineSimilaritiesR(v, a, dim)
+	return autofunc.PoolR(sims, func(sims autofunc.RResult) autofunc.RResult {
+		var terms []autofunc.RResult
+		for i := range x {
+			posIdx, negIdx := m.minePairs(x, sims.Output(), i)
+			if len(posIdx) > 0 {
+				var logits []autofunc.RResult
+				for _, j := range posIdx {
+					logits = append(logits, autofunc.SliceR(sims, j, j+1))
+				}
+				scaled := autofunc.AddScalerR(autofunc.ScaleR(autofunc.ConcatR(logits...),
+					-m.Alpha), m.Alpha*m.Lambda)
+				zero := autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+				terms = append(terms, autofunc.ScaleR(autofunc.SumAllLogDomainR(
+					autofunc.ConcatR(zero, scaled)), 1/m.Alpha))
+			}
+			if len(negIdx) > 0 {
+				var logits []autofunc.RResult
+				for _, j := range negIdx {
+					logits = append(logits, autofunc.SliceR(sims, j, j+1))
+				}
+				scaled := autofunc.AddScalerR(autofunc.ScaleR(autofunc.ConcatR(logits...),
+					m.Beta), -m.Beta*m.Lambda)
+				zero := autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+				terms = append(terms, autofunc.ScaleR(autofunc.SumAllLogDomainR(
+					autofunc.ConcatR(zero, scaled)), 1/m.Beta))
+			}
+		}
+		if len(terms) == 0 {
+			return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+		}
+		return autofunc.ScaleR(autofunc.SumAllR(autofunc.ConcatR(terms...)), 1/float64(len(x)))
+	})
+}
+
+// minePairs returns the indices (into the row-major
+// similarity matrix) of the mined positive and negative
+// pairs for the given anchor.
+func (m MultiSimilarityCost) minePairs(labels, sims linalg.Vector,
+	anchor int) (posIdx, negIdx []int) {
+	row := sims[anchor*len(labels) : (anchor+1)*len(labels)]
+	minPos, maxNeg := math.Inf(1), math.Inf(-1)
+	for j, label := range labels {
+		if j == anchor {
+			continue
+		} else if label == labels[anchor] {
+			minPos = math.Min(minPos, row[j])
+		} else {
+			maxNeg = math.Max(maxNeg, row[j])
+		}
+	}
+	for j, label := range labels {
+		if j == anchor {
+			continue
+		} else if label == labels[anchor] {
+			if row[j]-multiSimilarityEpsilon < maxNeg {
+				posIdx = append(posIdx, anchor*len(labels)+j)
+			}
+		} else if row[j]+multiSimilarityEpsilon > minPos {
+			negIdx = append(negIdx, anchor*len(labels)+j)
+		}
+	}
+	return
+}
+
+// ProxyAnchorCost implements the proxy anchor loss from
+// Kim et al. (2020).
+//
+// The actual vector contains a batch of concatenated
+// embeddings, and the expected vector contains an
+// integer class label for each embedding.
+// Each class has a trainable proxy in Proxies, which
+// receives gradients through the cost.
+// Embeddings are compared to proxies by cosine
+// similarity.
+//
+// Each proxy with at least one positive in the batch
+// acts as an anchor, pulling its positives closer with a
+// soft log-sum-exp of Alpha*(Margin-s) over their
+// similarities s.
+// Every proxy likewise pushes away its negatives through
+// a log-sum-exp of Alpha*(s+Margin).
+// The pull terms are averaged over proxies with
+// positives, and the push terms are averaged over all
+// proxies.
+type ProxyAnchorCost struct {
+	Margin  float64
+	Alpha   float64
+	Proxies []*autofunc.Variable
+}
+
+func (p *ProxyAnchorCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	labels := p.labels(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		vecs := autofunc.Split(len(x), a)
+		for _, proxy := range p.Proxies {
+			vecs = append(vecs, proxy)
+		}
+		for i, vec := range vecs {
+			vecs[i] = normalizeEmbedding(vec)
+		}
+		return autofunc.PoolAll(vecs, func(vecs []autofunc.Result) autofunc.Result {
+			embs, proxies := vecs[:len(x)], vecs[len(x):]
+			var posTerms, negTerms []autofunc.Result
+			for class, proxy := range proxies {
+				var pos, neg []autofunc.Result
+				for i, emb := range embs {
+					if labels[i] == class {
+						pos = append(pos, dotProduct(emb, proxy))
+					} else {
+						neg = append(neg, dotProduct(emb, proxy))
+					}
+				}
+				zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+				if len(pos) > 0 {
+					logits := autofunc.AddScaler(autofunc.Scale(autofunc.Concat(pos...),
+						-p.Alpha), p.Alpha*p.Margin)
+					posTerms = append(posTerms,
+						autofunc.SumAllLogDomain(autofunc.Concat(zero, logits)))
+				}
+				if len(neg) > 0 {
+					logits := autofunc.AddScaler(autofunc.Scale(autofunc.Concat(neg...),
+						p.Alpha), p.Alpha*p.Margin)
+					negTerms = append(negTerms,
+						autofunc.SumAllLogDomain(autofunc.Concat(zero, logits)))
+				}
+			}
+			cost := autofunc.Scale(autofunc.SumAll(autofunc.Concat(posTerms...)),
+				1/float64(len(posTerms)))
+			if len(negTerms) > 0 {
+				cost = autofunc.Add(cost, autofunc.Scale(
+					autofunc.SumAll(autofunc.Concat(negTerms...)), 1/float64(len(proxies))))
+			}
+			return cost
+		})
+	})
+}
+
+func (p *ProxyAnchorCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	labels := p.labels(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		vecs := autofunc.SplitR(len(x), a)
+		for _, proxy := range p.Proxies {
+			vecs = append(vecs, autofunc.NewRVariable(proxy, v))
+		}
+		for i, vec := range vecs {
+			vecs[i] = normalizeEmbeddingR(v, vec)
+		}
+		return autofunc.PoolAllR(vecs, func(vecs []autofunc.RResult) autofunc.RResult {
+			embs, proxies := vecs[:len(x)], vecs[len(x):]
+			var posTerms, negTerms []autofunc.RResult
+			for class, proxy := range proxies {
+				var pos, neg []autofunc.RResult
+				for i, emb := range embs {
+					if labels[i] == class {
+						pos = append(pos, dotProductR(emb, proxy))
+					} else {
+						neg = append(neg, dotProductR(emb, proxy))
+					}
+				}
+				zero := autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+				if len(pos) > 0 {
+					logits := autofunc.AddScalerR(autofunc.ScaleR(autofunc.ConcatR(pos...),
+						-p.Alpha), p.Alpha*p.Margin)
+					posTerms = append(posTerms,
+						autofunc.SumAllLogDomainR(autofunc.ConcatR(zero, logits)))
+				}
+				if len(neg) > 0 {
+					logits := autofunc.AddScalerR(autofunc.ScaleR(autofunc.ConcatR(neg...),
+						p.Alpha), p.Alpha*p.Margin)
+					negTerms = append(negTerms,
+						autofunc.SumAllLogDomainR(autofunc.ConcatR(zero, logits)))
+				}
+			}
+			cost := autofunc.ScaleR(autofunc.SumAllR(autofunc.ConcatR(posTerms...)),
+				1/float64(len(posTerms)))
+			if len(negTerms) > 0 {
+				cost = autofunc.AddR(cost, autofunc.ScaleR(
+					autofunc.SumAllR(autofunc.ConcatR(negTerms...)), 1/float64(len(proxies))))
+			}
+			return cost
+		})
+	})
+}
+
+func (p *ProxyAnchorCost) labels(x, a linalg.Vector) []int {
+	checkLabeledBatch(x, a)
+	res := make([]int, len(x))
+	for i := range x {
+		res[i] = categoricalLabel(x[i:i+1], len(p.Proxies))
+	}
+	return res
+}
+
+// CosineCost computes 1 minus the cosine similarity
+// between the actual and expected vectors, so it ignores
+// their magnitudes.
+//
+// To avoid dividing by zero, a tiny constant is added to
+// the squared magnitude of the actual vector.
+// An expected vector with a magnitude of zero has a
+// similarity of zero with every actual vector.
+type CosineCost struct{}
+
+func (_ CosineCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{Vector: cosineCostTarget(x)}
+	sim := dotProduct(normalizeEmbedding(a), xVar)
+	return autofunc.AddScaler(autofunc.Scale(sim, -1), 1)
+}
+
+func (_ CosineCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: cosineCostTarget(x)}, v)
+	sim := dotProductR(normalizeEmbeddingR(v, a), xVar)
+	return autofunc.AddScalerR(autofunc.ScaleR(sim, -1), 1)
+}
+
+func cosineCostTarget(x linalg.Vector) linalg.Vector {
+	res := x.Copy()
+	if mag := x.Mag(); mag != 0 {
+		res.Scale(1 / mag)
+	}
+	return res
+}
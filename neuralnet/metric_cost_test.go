@@ -0,0 +1,280 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestCosFaceCostGradient(t *testing.T) {
+	cost := CosFaceCost{Margin: 0.35, Scale: 4}
+	checkCostFuncGradients(t, cost, linalg.Vector{0, 1, 0}, linalg.Vector{0.3, 0.6, -0.2})
+}
+
+func TestCosFaceCostMargin(t *testing.T) {
+	target := linalg.Vector{0, 0, 1, 0}
+	cosines := &autofunc.Variable{Vector: []float64{0.1, -0.4, 0.7, 1.3}}
+	plain := CosFaceCost{Scale: 8}.Cost(target, cosines).Output()[0]
+	margin := CosFaceCost{Margin: 0.2, Scale: 8}.Cost(target, cosines).Output()[0]
+	if margin <= plain {
+		t.Errorf("margin should increase the cost: %f vs %f", margin, plain)
+	}
+}
+
+func TestAngularCostGradient(t *testing.T) {
+	cost := AngularCost{Alpha: math.Pi / 4}
+	checkCostFuncGradients(t, cost, nil, linalg.Vector{0, 0, 1, 0, 0.5, 0.4})
+}
+
+func TestAngularCostAngle(t *testing.T) {
+	cost := AngularCost{Alpha: math.Pi / 4}
+
+	// Anchor and positive are 2 apart, so the angle at
+	// the negative is atan(1/d), where d is the distance
+	// from the negative to their midpoint.
+	costFor := func(d float64) (float64, linalg.Vector) {
+		actual := &autofunc.Variable{Vector: []float64{-1, 0, 1, 0, 0, d}}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		res := cost.Cost(nil, actual)
+		res.PropagateGradient(linalg.Vector{1}, grad)
+		return res.Output()[0], grad[actual]
+	}
+
+	wide, wideGrad := costFor(0.5)
+	if wide <= 0 {
+		t.Errorf("angle above Alpha should be penalized, got %f", wide)
+	}
+	if wideGrad[5] >= 0 {
+		t.Errorf("gradient should push the negative away, got %f", wideGrad[5])
+	}
+
+	narrow, narrowGrad := costFor(2)
+	if narrow != 0 || narrowGrad.MaxAbs() != 0 {
+		t.Errorf("angle below Alpha should not be penalized, got %f (%v)", narrow, narrowGrad)
+	}
+
+	// The cost only depends on the angle, not the scale.
+	actual := &autofunc.Variable{Vector: []float64{-3, 0, 3, 0, 0, 1.5}}
+	if scaled := cost.Cost(nil, actual).Output()[0]; math.Abs(scaled-9*wide) > 1e-8 {
+		t.Errorf("expected scaled cost %f but got %f", 9*wide, scaled)
+	}
+}
+
+func TestTripletCost(t *testing.T) {
+	cost := TripletCost{Margin: 0.5}
+	costFor := func(vec linalg.Vector) (float64, linalg.Vector) {
+		actual := &autofunc.Variable{Vector: vec}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		res := cost.Cost(nil, actual)
+		res.PropagateGradient(linalg.Vector{1}, grad)
+		return res.Output()[0], grad[actual]
+	}
+
+	violated := linalg.Vector{0, 0, 1, 0, 0, 1}
+	c, grad := costFor(violated)
+	if math.Abs(c-0.5) > 1e-10 {
+		t.Errorf("violated triplet: expected 0.5 but got %f", c)
+	}
+	expGrad := linalg.Vector{-2, 2, 2, 0, 0, -2}
+	for i, x := range expGrad {
+		if math.Abs(grad[i]-x) > 1e-10 {
+			t.Errorf("violated triplet: expected gradient %v but got %v", expGrad, grad)
+			break
+		}
+	}
+	checkCostFuncGradients(t, cost, nil, violated)
+
+	satisfied := linalg.Vector{0, 0, 1, 0, 0, 2}
+	if c, grad := costFor(satisfied); c != 0 || grad.MaxAbs() != 0 {
+		t.Errorf("satisfied triplet: expected no cost or gradient, got %f (%v)", c, grad)
+	}
+}
+
+func TestNPairCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, NPairCost{Dim: 2}, nil, linalg.RandVector(10))
+}
+
+func TestNPairCostSingleNegative(t *testing.T) {
+	anchor := linalg.Vector{0.5, -0.3, 0.2}
+	positive := linalg.Vector{0.4, -0.1, 0.3}
+	negative := linalg.Vector{-0.2, 0.6, 0.1}
+	var joined linalg.Vector
+	joined = append(append(append(joined, anchor...), positive...), negative...)
+	actual := NPairCost{Dim: 3}.Cost(nil, &autofunc.Variable{Vector: joined}).Output()[0]
+	expected := math.Log1p(math.Exp(anchor.Dot(negative) - anchor.Dot(positive)))
+	if math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+}
+
+func TestLiftedStructuredCostGradient(t *testing.T) {
+	cost := LiftedStructuredCost{Margin: 1}
+	checkCostFuncGradients(t, cost, linalg.Vector{0, 1, 0, 1, 2}, linalg.RandVector(10))
+}
+
+func TestLiftedStructuredCostClustering(t *testing.T) {
+	cost := LiftedStructuredCost{Margin: 1}
+	labels := linalg.Vector{0, 0, 1, 1}
+	spread := &autofunc.Variable{Vector: []float64{0, 0, 0.5, 0.5, 1, 0, 1.5, 0.5}}
+	clustered := &autofunc.Variable{Vector: []float64{0, 0, 0.1, 0, 2, 0, 2.1, 0}}
+	if c1, c2 := cost.Cost(labels, spread).Output()[0],
+		cost.Cost(labels, clustered).Output()[0]; c2 >= c1 {
+		t.Errorf("clustered cost %f should be below spread cost %f", c2, c1)
+	}
+}
+
+func TestCircleCostOutput(t *testing.T) {
+	cost := CircleCost{Margin: 0.25, Scale: 4}
+	sims := []float64{0.7, 0.1, -0.2, 0.5}
+	labels := linalg.Vector{1, 0, 1, 0}
+
+	var posSum, negSum float64
+	for i, s := range sims {
+		if labels[i] != 0 {
+			posSum += math.Exp(-4 * (1.25 - s) * (s - 0.75))
+		} else {
+			negSum += math.Exp(4 * (s + 0.25) * (s - 0.25))
+		}
+	}
+	expected := math.Log(1 + posSum*negSum)
+
+	actual := cost.Cost(labels, &autofunc.Variable{Vector: sims}).Output()[0]
+	if math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+
+	simsVar := &autofunc.Variable{Vector: sims}
+	rv := autofunc.RVector{simsVar: linalg.RandVector(len(sims))}
+	grad := autofunc.NewGradient([]*autofunc.Variable{simsVar})
+	cost.Cost(labels, simsVar).PropagateGradient(linalg.Vector{1}, grad)
+	rGrad := autofunc.NewGradient([]*autofunc.Variable{simsVar})
+	rRes := cost.CostR(rv, labels, autofunc.NewRVariable(simsVar, rv))
+	if math.Abs(rRes.Output()[0]-expected) > 1e-8 {
+		t.Errorf("expected R output %f but got %f", expected, rRes.Output()[0])
+	}
+	rRes.PropagateRGradient(linalg.Vector{1}, linalg.Vector{0},
+		autofunc.NewRGradient([]*autofunc.Variable{simsVar}), rGrad)
+	for i, x := range grad[simsVar] {
+		if math.Abs(x-rGrad[simsVar][i]) > 1e-8 {
+			t.Errorf("gradient %d: Cost gave %f but CostR gave %f", i, x, rGrad[simsVar][i])
+		}
+	}
+}
+
+func TestCircleCostWeighting(t *testing.T) {
+	cost := CircleCost{Margin: 0.25, Scale: 4}
+	sims := &autofunc.Variable{Vector: []float64{0.95, -0.5, 0.3}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{sims})
+	cost.Cost(linalg.Vector{1, 1, 0}, sims).PropagateGradient(linalg.Vector{1}, grad)
+	near, far := math.Abs(grad[sims][0]), math.Abs(grad[sims][1])
+	if near*10 > far {
+		t.Errorf("near gradient %f should be much smaller than far gradient %f", near, far)
+	}
+}
+
+func TestMultiSimilarityCostGradient(t *testing.T) {
+	cost := MultiSimilarityCost{Alpha: 2, Beta: 10, Lambda: 0.5}
+	checkCostFuncGradients(t, cost, linalg.Vector{0, 1, 0, 1, 2},
+		linalg.Vector{1, 0.1, 0.9, 0.3, 0.6, 0.8, 0.1, 1, -0.2, 0.7})
+}
+
+func TestMultiSimilarityCostHyperparameters(t *testing.T) {
+	labels := linalg.Vector{0, 0, 1}
+	embeddings := linalg.Vector{1, 0, 0.6, 0.8, 0.8, 0.6}
+
+	// Anchor 0 has a hard positive (cos=0.6) and a hard
+	// negative (cos=0.8), so all three knobs matter.
+	base := MultiSimilarityCost{Alpha: 2, Beta: 10, Lambda: 0.5}
+	baseCost := base.Cost(labels, &autofunc.Variable{Vector: embeddings}).Output()[0]
+	variants := []MultiSimilarityCost{
+		{Alpha: 4, Beta: 10, Lambda: 0.5},
+		{Alpha: 2, Beta: 20, Lambda: 0.5},
+		{Alpha: 2, Beta: 10, Lambda: 0.7},
+	}
+	for i, variant := range variants {
+		cost := variant.Cost(labels, &autofunc.Variable{Vector: embeddings}).Output()[0]
+		if math.Abs(cost-baseCost) < 1e-3 {
+			t.Errorf("variant %d: cost %f did not change from %f", i, cost, baseCost)
+		}
+	}
+
+	// Raising Lambda penalizes positives more and negatives
+	// less, and the negative term dominates here.
+	highLambda := variants[2].Cost(labels, &autofunc.Variable{Vector: embeddings}).Output()[0]
+	if highLambda >= baseCost {
+		t.Errorf("higher Lambda should lower cost: got %f vs %f", highLambda, baseCost)
+	}
+}
+
+func TestProxyAnchorCostGradient(t *testing.T) {
+	proxies := []*autofunc.Variable{
+		{Vector: linalg.RandVector(3)},
+		{Vector: linalg.RandVector(3)},
+		{Vector: linalg.RandVector(3)},
+	}
+	cost := &ProxyAnchorCost{Margin: 0.1, Alpha: 8, Proxies: proxies}
+	actual := &autofunc.Variable{Vector: linalg.RandVector(12)}
+	funcTest := &functest.RFuncChecker{
+		F:     costFuncTestFunc{Cost: cost, Expected: linalg.Vector{0, 1, 0, 2}},
+		Vars:  append([]*autofunc.Variable{actual}, proxies...),
+		Input: actual,
+		RV: autofunc.RVector{
+			actual:     linalg.RandVector(12),
+			proxies[0]: linalg.RandVector(3),
+			proxies[1]: linalg.RandVector(3),
+			proxies[2]: linalg.RandVector(3),
+		},
+	}
+	funcTest.FullCheck(t)
+}
+
+func TestProxyAnchorCostPull(t *testing.T) {
+	proxies := []*autofunc.Variable{
+		{Vector: linalg.Vector{1, 0}},
+		{Vector: linalg.Vector{0, 1}},
+	}
+	cost := &ProxyAnchorCost{Margin: 0.1, Alpha: 4, Proxies: proxies}
+	embedding := &autofunc.Variable{Vector: linalg.Vector{0.6, 0.8}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{embedding, proxies[0]})
+	cost.Cost(linalg.Vector{0}, embedding).PropagateGradient(linalg.Vector{1}, grad)
+
+	// A descent step should rotate the embedding toward
+	// its proxy, and the proxy toward the embedding.
+	if g := grad[embedding]; g[0] >= 0 || g[1] <= 0 {
+		t.Errorf("embedding is not pulled toward its proxy: %v", g)
+	}
+	if g := grad[proxies[0]]; g[1] >= 0 {
+		t.Errorf("proxy is not pulled toward the embedding: %v", g)
+	}
+}
+
+func TestCosineCost(t *testing.T) {
+	expected := linalg.Vector{1, 2, -2}
+	actual := &autofunc.Variable{Vector: linalg.Vector{2, 4, -4}}
+	if c := (CosineCost{}).Cost(expected, actual).Output()[0]; math.Abs(c) > 1e-10 {
+		t.Errorf("parallel vectors: expected 0 but got %f", c)
+	}
+	actual.Vector = linalg.Vector{2, -1, 0}
+	if c := (CosineCost{}).Cost(expected, actual).Output()[0]; math.Abs(c-1) > 1e-10 {
+		t.Errorf("orthogonal vectors: expected 1 but got %f", c)
+	}
+	zero := &autofunc.Variable{Vector: linalg.Vector{0, 0, 0}}
+	if c := (CosineCost{}).Cost(expected, zero).Output()[0]; math.IsNaN(c) {
+		t.Error("zero actual vector gave NaN")
+	}
+}
+
+func TestCosineCostGradient(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		expected := linalg.RandVector(5)
+		actual := linalg.RandVector(5).Scale(3)
+		checkCostFuncGradients(t, CosineCost{}, expected, actual)
+
+		unitExpected := expected.Copy().Scale(1 / expected.Mag())
+		unitActual := actual.Copy().Scale(1 / actual.Mag())
+		checkCostFuncGradients(t, CosineCost{}, unitExpected, unitActual)
+	}
+}
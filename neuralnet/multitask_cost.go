@@ -0,0 +1,82 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// A CompositeCostEntry is one term of a CompositeCost.
+type CompositeCostEntry struct {
+	CostFunc CostFunc
+	Weight   float64
+
+	// OutputRange is the [start, end) range of the
+	// expected and actual vectors which CostFunc is
+	// applied to.
+	OutputRange [2]int
+}
+
+// CompositeCost is a weighted sum of CostFuncs, each
+// of which operates on a slice of the output.
+//
+// This is useful for multi-task networks whose output
+// vector is the concatenation of the outputs of several
+// heads, each of which has its own cost.
+type CompositeCost []CompositeCostEntry
+
+func (c CompositeCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	c.checkRanges(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		var sum autofunc.Result = &autofunc.Variable{Vector: linalg.Vector{0}}
+		for _, entry := range c {
+			start, end := entry.OutputRange[0], entry.OutputRange[1]
+			cost := entry.CostFunc.Cost(x[start:end], autofunc.Slice(a, start, end))
+			sum = autofunc.Add(sum, autofunc.Scale(cost, entry.Weight))
+		}
+		return sum
+	})
+}
+
+func (c CompositeCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	c.checkRanges(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+		var sum autofunc.RResult = autofunc.NewRVariable(zero, v)
+		for _, entry := range c {
+			start, end := entry.OutputRange[0], entry.OutputRange[1]
+			cost := entry.CostFunc.CostR(v, x[start:end], autofunc.SliceR(a, start, end))
+			sum = autofunc.AddR(sum, autofunc.ScaleR(cost, entry.Weight))
+		}
+		return sum
+	})
+}
+
+// CostContributions places the weighted contributions
+// of each entry at the entry's OutputRange.
+// If any entry does not decompose, the result is a
+// single element containing the total cost.
+func (c CompositeCost) CostContributions(x linalg.Vector, a autofunc.Result) linalg.Vector {
+	c.checkRanges(x, a.Output())
+	res := make(linalg.Vector, len(x))
+	for _, entry := range c {
+		start, end := entry.OutputRange[0], entry.OutputRange[1]
+		if !addContributions(res, start, entry.CostFunc, entry.Weight, x[start:end],
+			autofunc.Slice(a, start, end)) {
+			return c.Cost(x, a).Output()
+		}
+	}
+	return res
+}
+
+func (c CompositeCost) checkRanges(x, a linalg.Vector) {
+	if len(x) != len(a) {
+		panic("expected and actual vectors must have the same size")
+	}
+	for _, entry := range c {
+		start, end := entry.OutputRange[0], entry.OutputRange[1]
+		if start < 0 || end < start || end > len(x) {
+			panic("output range out of bounds")
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestCompositeCost(t *testing.T) {
+	cost := CompositeCost{
+		{CostFunc: MeanSquaredCost{}, Weight: 0.5, OutputRange: [2]int{0, 2}},
+		{CostFunc: softmaxCETestCost{}, Weight: 2, OutputRange: [2]int{2, 5}},
+	}
+	expected := linalg.Vector{1, -1, 0, 1, 0}
+	actual := linalg.Vector{0.5, 0.3, 0.2, 1.5, -1}
+	actualVar := &autofunc.Variable{Vector: actual}
+
+	mse := MeanSquaredCost{}.Cost(expected[:2],
+		&autofunc.Variable{Vector: actual[:2]}).Output()[0]
+	ce := softmaxCETestCost{}.Cost(expected[2:],
+		&autofunc.Variable{Vector: actual[2:]}).Output()[0]
+	exp := 0.5*mse + 2*ce
+	if c := cost.Cost(expected, actualVar).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual)
+}
@@ -0,0 +1,245 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// StudentTNLLCost computes the negative log-likelihood
+// of the expected vector under a Student-t distribution
+// with Nu degrees of freedom.
+//
+// The actual vector must be twice the length of the
+// expected vector.
+// The first half contains the predicted locations, and
+// the second half contains the natural logarithms of the
+// predicted scales.
+//
+// Compared to a Gaussian likelihood, large residuals are
+// penalized logarithmically rather than quadratically,
+// making this cost robust to outliers.
+type StudentTNLLCost struct {
+	Nu float64
+}
+
+func (s StudentTNLLCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		n := len(x)
+		loc := autofunc.Slice(a, 0, n)
+		logScale := autofunc.Slice(a, n, n*2)
+		xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+		invScale := autofunc.Exp{}.Apply(autofunc.Scale(logScale, -1))
+		z := autofunc.Mul(autofunc.Add(loc, xVar), invScale)
+		zTerm := autofunc.Log{}.Apply(autofunc.AddScaler(autofunc.Scale(autofunc.Square(z),
+			1/s.Nu), 1))
+		perElem := autofunc.Add(logScale, autofunc.Scale(zTerm, (s.Nu+1)/2))
+		return autofunc.AddScaler(autofunc.SumAll(perElem), float64(n)*s.normalizer())
+	})
+}
+
+func (s StudentTNLLCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		n := len(x)
+		loc := autofunc.SliceR(a, 0, n)
+		logScale := autofunc.SliceR(a, n, n*2)
+		xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+		invScale := autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(logScale, -1))
+		z := autofunc.MulR(autofunc.AddR(loc, xVar), invScale)
+		zTerm := autofunc.Log{}.ApplyR(v, autofunc.AddScalerR(autofunc.ScaleR(autofunc.SquareR(z),
+			1/s.Nu), 1))
+		perElem := autofunc.AddR(logScale, autofunc.ScaleR(zTerm, (s.Nu+1)/2))
+		return autofunc.AddScalerR(autofunc.SumAllR(perElem), float64(n)*s.normalizer())
+	})
+}
+
+// normalizer returns the negative log of the Student-t
+// normalization constant, which does not depend on the
+// location or scale.
+func (s StudentTNLLCost) normalizer() float64 {
+	lgNum, _ := math.Lgamma((s.Nu + 1) / 2)
+	lgDenom, _ := math.Lgamma(s.Nu / 2)
+	return lgDenom - lgNum + 0.5*math.Log(s.Nu*math.Pi)
+}
+
+// CategoricalNLLCost computes the negative log-likelihood
+// of an integer class label under a categorical
+// distribution parameterized by logits.
+//
+// The actual vector contains the unnormalized logits.
+// The expected vector contains a single entry: the index
+// of the correct class.
+//
+// This is equivalent to using a LogSoftmaxLayer followed
+// by a DotCost with a one-hot expected vector, but it
+// does not require one-hot targets.
+type CategoricalNLLCost struct{}
+
+func (_ CategoricalNLLCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	label := categoricalLabel(x, len(a.Output()))
+	logProbs := (&LogSoftmaxLayer{}).Apply(a)
+	return autofunc.Scale(autofunc.Slice(logProbs, label, label+1), -1)
+}
+
+func (_ CategoricalNLLCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	label := categoricalLabel(x, len(a.Output()))
+	logProbs := (&LogSoftmaxLayer{}).ApplyR(v, a)
+	return autofunc.ScaleR(autofunc.SliceR(logProbs, label, label+1), -1)
+}
+
+func categoricalLabel(x linalg.Vector, numClasses int) int {
+	if len(x) != 1 {
+		panic("expected vector must contain exactly one label")
+	}
+	label := int(x[0])
+	if float64(label) != x[0] || label < 0 || label >= numClasses {
+		panic("label out of range")
+	}
+	return label
+}
+
+// PoissonOffsetCost computes the negative log-likelihood
+// of observed counts under a Poisson distribution whose
+// log-rate is the actual output plus a per-sample offset.
+//
+// The offset is typically the log of the exposure (e.g.
+// the length of the observation window), so that the
+// network predicts a rate per unit of exposure, as in a
+// Poisson GLM with an offset term.
+//
+// For n outputs, the expected vector has length 2n and
+// contains n observed counts followed by n offsets.
+// Use NewPoissonOffsetSample to construct such samples.
+//
+// The log(x!) term of the likelihood does not depend on
+// the network's output, so it is omitted.
+type PoissonOffsetCost struct{}
+
+// NewPoissonOffsetSample creates a VectorSample whose
+// output packs counts and log-exposures in the layout
+// expected by PoissonOffsetCost.
+func NewPoissonOffsetSample(input, counts, logExposure linalg.Vector) VectorSample {
+	if len(counts) != len(logExposure) {
+		panic("counts and offsets must have the same length")
+	}
+	output := make(linalg.Vector, 0, len(counts)*2)
+	output = append(output, counts...)
+	output = append(output, logExposure...)
+	return VectorSample{Input: input, Output: output}
+}
+
+func (_ PoissonOffsetCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	counts, offsets := splitPoissonOffset(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logRate := autofunc.Add(a, &autofunc.Variable{Vector: offsets})
+		rate := autofunc.Exp{}.Apply(logRate)
+		countVar := &autofunc.Variable{Vector: counts}
+		return autofunc.SumAll(autofunc.Add(rate,
+			autofunc.Scale(autofunc.Mul(countVar, logRate), -1)))
+	})
+}
+
+func (_ PoissonOffsetCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	counts, offsets := splitPoissonOffset(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		offsetVar := autofunc.NewRVariable(&autofunc.Variable{Vector: offsets}, v)
+		logRate := autofunc.AddR(a, offsetVar)
+		rate := autofunc.Exp{}.ApplyR(v, logRate)
+		countVar := autofunc.NewRVariable(&autofunc.Variable{Vector: counts}, v)
+		return autofunc.SumAllR(autofunc.AddR(rate,
+			autofunc.ScaleR(autofunc.MulR(countVar, logRate), -1)))
+	})
+}
+
+func splitPoissonOffset(x, a linalg.Vector) (counts, offsets linalg.Vector) {
+	if len(x) != len(a)*2 {
+		panic("expected vector must be twice the actual size")
+	}
+	return x[:len(a)], x[len(a):]
+}
+
+// ZeroInflatedPoissonCost computes the negative
+// log-likelihood of observed counts under a zero-inflated
+// Poisson distribution.
+//
+// For n outputs, the actual vector has length 2n and
+// contains n logits for the zero-inflation probability
+// (which is obtained with a sigmoid) followed by n
+// log-rates for the Poisson component.
+// The expected vector contains the n observed counts.
+//
+// The log(x!) term of the likelihood does not depend on
+// the network's output, so it is omitted.
+type ZeroInflatedPoissonCost struct{}
+
+func (_ ZeroInflatedPoissonCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	n := len(x)
+	if len(a.Output()) != n*2 {
+		panic("actual vector must be twice the expected size")
+	}
+	zeroMask, posMask := zeroInflationMasks(x)
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logits := autofunc.Slice(a, 0, n)
+		logRates := autofunc.Slice(a, n, n*2)
+		rates := autofunc.Exp{}.Apply(logRates)
+
+		// For zero counts, -log(pi + (1-pi)*exp(-rate)) is
+		// softplus(z) - z - softplus(-rate-z).
+		zeroTerm := autofunc.Add(logits,
+			softplus(autofunc.Scale(autofunc.Add(rates, logits), -1)))
+
+		// For positive counts, -log((1-pi)*Poisson(x)) is
+		// softplus(z) + rate - x*log(rate).
+		xVar := &autofunc.Variable{Vector: x}
+		posTerm := autofunc.Add(rates, autofunc.Scale(autofunc.Mul(xVar, logRates), -1))
+
+		return autofunc.SumAll(autofunc.Add(softplus(logits), autofunc.Add(
+			autofunc.Scale(autofunc.Mul(&autofunc.Variable{Vector: zeroMask}, zeroTerm), -1),
+			autofunc.Mul(&autofunc.Variable{Vector: posMask}, posTerm),
+		)))
+	})
+}
+
+func (_ ZeroInflatedPoissonCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n := len(x)
+	if len(a.Output()) != n*2 {
+		panic("actual vector must be twice the expected size")
+	}
+	zeroMask, posMask := zeroInflationMasks(x)
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		logits := autofunc.SliceR(a, 0, n)
+		logRates := autofunc.SliceR(a, n, n*2)
+		rates := autofunc.Exp{}.ApplyR(v, logRates)
+
+		zeroTerm := autofunc.AddR(logits,
+			softplusR(v, autofunc.ScaleR(autofunc.AddR(rates, logits), -1)))
+
+		xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x}, v)
+		posTerm := autofunc.AddR(rates, autofunc.ScaleR(autofunc.MulR(xVar, logRates), -1))
+
+		zeroVar := autofunc.NewRVariable(&autofunc.Variable{Vector: zeroMask}, v)
+		posVar := autofunc.NewRVariable(&autofunc.Variable{Vector: posMask}, v)
+		return autofunc.SumAllR(autofunc.AddR(softplusR(v, logits), autofunc.AddR(
+			autofunc.ScaleR(autofunc.MulR(zeroVar, zeroTerm), -1),
+			autofunc.MulR(posVar, posTerm),
+		)))
+	})
+}
+
+func zeroInflationMasks(x linalg.Vector) (zeroMask, posMask linalg.Vector) {
+	zeroMask = make(linalg.Vector, len(x))
+	posMask = make(linalg.Vector, len(x))
+	for i, count := range x {
+		if count == 0 {
+			zeroMask[i] = 1
+		} else {
+			posMask[i] = 1
+		}
+	}
+	return
+}
@@ -0,0 +1,126 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestStudentTNLLCostGradient(t *testing.T) {
+	expected := linalg.RandVector(5)
+	actual := linalg.RandVector(10)
+	checkCostFuncGradients(t, StudentTNLLCost{Nu: 3}, expected, actual)
+}
+
+func TestStudentTNLLCostOutliers(t *testing.T) {
+	cost := StudentTNLLCost{Nu: 2}
+	costAt := func(residual float64) float64 {
+		actual := &autofunc.Variable{Vector: []float64{residual, 0}}
+		return cost.Cost(linalg.Vector{0}, actual).Output()[0]
+	}
+	gaussianAt := func(residual float64) float64 {
+		return 0.5*residual*residual + 0.5*math.Log(2*math.Pi)
+	}
+	studentGrowth := costAt(10) - costAt(1)
+	gaussianGrowth := gaussianAt(10) - gaussianAt(1)
+	if studentGrowth <= 0 {
+		t.Errorf("cost should grow with residual (growth %f)", studentGrowth)
+	}
+	if studentGrowth >= gaussianGrowth {
+		t.Errorf("student-t growth %f should be below gaussian growth %f",
+			studentGrowth, gaussianGrowth)
+	}
+
+	// With Nu=1 (Cauchy) and unit scale, the NLL is
+	// log(pi) + log(1+z^2).
+	cauchy := StudentTNLLCost{Nu: 1}
+	actual := &autofunc.Variable{Vector: []float64{2, 0}}
+	expected := math.Log(math.Pi) + math.Log(5)
+	if val := cauchy.Cost(linalg.Vector{0}, actual).Output()[0]; math.Abs(val-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, val)
+	}
+}
+
+func TestCategoricalNLLCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, CategoricalNLLCost{}, linalg.Vector{2}, linalg.RandVector(4))
+}
+
+func TestCategoricalNLLCostOneHot(t *testing.T) {
+	logits := linalg.Vector{0.5, -1, 2, 0.3}
+	for label := range logits {
+		oneHot := make(linalg.Vector, len(logits))
+		oneHot[label] = 1
+
+		actual := &autofunc.Variable{Vector: logits.Copy()}
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		cost := CategoricalNLLCost{}.Cost(linalg.Vector{float64(label)}, actual)
+		cost.PropagateGradient(linalg.Vector{1}, grad)
+
+		expGrad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		expCost := DotCost{}.Cost(oneHot, (&LogSoftmaxLayer{}).Apply(actual))
+		expCost.PropagateGradient(linalg.Vector{1}, expGrad)
+
+		if math.Abs(cost.Output()[0]-expCost.Output()[0]) > 1e-8 {
+			t.Errorf("label %d: expected cost %f got %f", label, expCost.Output()[0],
+				cost.Output()[0])
+		}
+		diff := grad[actual].Copy().Scale(-1).Add(expGrad[actual])
+		if diff.MaxAbs() > 1e-8 {
+			t.Errorf("label %d: expected gradient %v got %v", label, expGrad[actual],
+				grad[actual])
+		}
+	}
+}
+
+func TestPoissonOffsetCostGradient(t *testing.T) {
+	expected := NewPoissonOffsetSample(nil, linalg.Vector{0, 3, 1},
+		linalg.Vector{0.5, -0.3, 1}).Output
+	checkCostFuncGradients(t, PoissonOffsetCost{}, expected, linalg.RandVector(3))
+}
+
+func TestPoissonOffsetCostExposure(t *testing.T) {
+	logRate := &autofunc.Variable{Vector: []float64{0.7}}
+	rateTerm := func(exposure float64) float64 {
+		sample := NewPoissonOffsetSample(nil, linalg.Vector{0}, linalg.Vector{math.Log(exposure)})
+		return PoissonOffsetCost{}.Cost(sample.Output, logRate).Output()[0]
+	}
+	single := rateTerm(3)
+	double := rateTerm(6)
+	if math.Abs(double-2*single) > 1e-8 {
+		t.Errorf("doubling exposure gave %f (expected %f)", double, 2*single)
+	}
+}
+
+func TestZeroInflatedPoissonCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, ZeroInflatedPoissonCost{}, linalg.Vector{0, 2, 0, 5},
+		linalg.RandVector(8))
+}
+
+func TestZeroInflatedPoissonCostOutput(t *testing.T) {
+	actual := &autofunc.Variable{Vector: []float64{0.3, -0.2, 0.5, 1.1}}
+	pi := []float64{1 / (1 + math.Exp(-0.3)), 1 / (1 + math.Exp(0.2))}
+	rate := []float64{math.Exp(0.5), math.Exp(1.1)}
+	expected := -math.Log(pi[0]+(1-pi[0])*math.Exp(-rate[0])) -
+		math.Log(1-pi[1]) + rate[1] - 3*math.Log(rate[1])
+	cost := ZeroInflatedPoissonCost{}.Cost(linalg.Vector{0, 3}, actual).Output()[0]
+	if math.Abs(cost-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, cost)
+	}
+}
+
+func TestZeroInflatedPoissonCostExcessZeros(t *testing.T) {
+	counts := linalg.Vector{0, 0, 0, 0, 0, 0, 4, 3}
+	costFor := func(logit float64) float64 {
+		actual := make(linalg.Vector, len(counts)*2)
+		for i := range counts {
+			actual[i] = logit
+			actual[i+len(counts)] = math.Log(3.5)
+		}
+		return ZeroInflatedPoissonCost{}.Cost(counts, &autofunc.Variable{Vector: actual}).Output()[0]
+	}
+	if inflated, plain := costFor(0.5), costFor(-20); inflated >= plain {
+		t.Errorf("zero inflation should lower cost: got %f (plain %f)", inflated, plain)
+	}
+}
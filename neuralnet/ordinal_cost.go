@@ -0,0 +1,51 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// OrdinalDepthCost implements the ordinal regression
+// loss from DORN (Fu et al., 2018) for depth maps which
+// have been discretized into NumBins bins.
+//
+// The expected vector contains the index of the correct
+// depth bin for each pixel.
+// The actual vector contains NumBins-1 logits for each
+// pixel (pixel-major), where logit k predicts whether
+// the pixel's depth bin is greater than k.
+//
+// The cost is the sum of the sigmoid cross entropies of
+// all the logits.
+// Since every threshold between the predicted and true
+// bins is violated, distant bins cost more than adjacent
+// ones.
+type OrdinalDepthCost struct {
+	NumBins int
+}
+
+func (o OrdinalDepthCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return SigmoidCECost{}.Cost(o.cumulativeTargets(x, a.Output()), a)
+}
+
+func (o OrdinalDepthCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return SigmoidCECost{}.CostR(v, o.cumulativeTargets(x, a.Output()), a)
+}
+
+// cumulativeTargets converts bin labels into binary
+// targets for each threshold.
+func (o OrdinalDepthCost) cumulativeTargets(x, a linalg.Vector) linalg.Vector {
+	numThresh := o.NumBins - 1
+	if numThresh < 1 || len(a) != len(x)*numThresh {
+		panic("actual vector must have NumBins-1 logits per pixel")
+	}
+	res := make(linalg.Vector, len(a))
+	for i := range x {
+		bin := categoricalLabel(x[i:i+1], o.NumBins)
+		for k := 0; k < bin; k++ {
+			res[i*numThresh+k] = 1
+		}
+	}
+	return res
+}
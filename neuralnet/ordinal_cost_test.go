@@ -0,0 +1,35 @@
+package neuralnet
+
+import (
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestOrdinalDepthCostOrdering(t *testing.T) {
+	cost := OrdinalDepthCost{NumBins: 5}
+
+	// predictBin returns confident logits for a bin.
+	predictBin := func(bin int) *autofunc.Variable {
+		logits := make(linalg.Vector, 4)
+		for k := range logits {
+			if k < bin {
+				logits[k] = 4
+			} else {
+				logits[k] = -4
+			}
+		}
+		return &autofunc.Variable{Vector: logits}
+	}
+
+	expected := linalg.Vector{3}
+	exact := cost.Cost(expected, predictBin(3)).Output()[0]
+	adjacent := cost.Cost(expected, predictBin(2)).Output()[0]
+	distant := cost.Cost(expected, predictBin(0)).Output()[0]
+	if !(exact < adjacent && adjacent < distant) {
+		t.Errorf("costs should grow with bin distance: %f, %f, %f", exact, adjacent, distant)
+	}
+
+	checkCostFuncGradients(t, cost, linalg.Vector{1, 4}, linalg.RandVector(8))
+}
@@ -0,0 +1,97 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// A PreActivationCostFunc is a CostFunc which can be
+// computed more stably from the input of a network's
+// final activation (e.g. the logits fed into a softmax)
+// than from the activation's output.
+//
+// TotalCost, SampleCosts, and TotalCostBatcher check for
+// this interface.
+// If the network's last layer is the activation the cost
+// expects, they skip that layer and pass the logits to
+// CostLogits instead of passing the output to Cost.
+type PreActivationCostFunc interface {
+	CostFunc
+
+	// IsActivation returns true if f is the final
+	// activation whose input CostLogits expects.
+	IsActivation(f autofunc.Func) bool
+
+	// CostLogits computes the same cost as Cost, but
+	// from the input of the final activation.
+	CostLogits(x linalg.Vector, logits autofunc.Result) autofunc.Result
+	CostLogitsR(v autofunc.RVector, x linalg.Vector, logits autofunc.RResult) autofunc.RResult
+}
+
+// SoftmaxCECost computes the cross entropy between an
+// expected probability distribution and the output of a
+// softmax.
+//
+// Cost and CostR expect the actual vector to be the
+// output of a SoftmaxLayer.
+// When the softmax is available, the cost is computed
+// directly from its logits using a log-softmax, which
+// is more numerically stable than taking the logarithm
+// of the probabilities.
+type SoftmaxCECost struct{}
+
+func (_ SoftmaxCECost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return DotCost{}.Cost(x, autofunc.Log{}.Apply(a))
+}
+
+func (_ SoftmaxCECost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return DotCost{}.CostR(v, x, autofunc.Log{}.ApplyR(v, a))
+}
+
+// IsActivation returns true if f is a SoftmaxLayer with
+// a temperature of 1.
+func (_ SoftmaxCECost) IsActivation(f autofunc.Func) bool {
+	s, ok := f.(*SoftmaxLayer)
+	return ok && (s.Temperature == 0 || s.Temperature == 1)
+}
+
+func (_ SoftmaxCECost) CostLogits(x linalg.Vector, logits autofunc.Result) autofunc.Result {
+	return DotCost{}.Cost(x, (&LogSoftmaxLayer{}).Apply(logits))
+}
+
+func (_ SoftmaxCECost) CostLogitsR(v autofunc.RVector, x linalg.Vector,
+	logits autofunc.RResult) autofunc.RResult {
+	return DotCost{}.CostR(v, x, (&LogSoftmaxLayer{}).ApplyR(v, logits))
+}
+
+// preActivationFunc returns the part of f before its
+// final activation if c is a PreActivationCostFunc and
+// f is a Network ending with the activation c expects.
+func preActivationFunc(c CostFunc, f autofunc.Func) (PreActivationCostFunc,
+	autofunc.Func, bool) {
+	pc, ok := c.(PreActivationCostFunc)
+	if !ok {
+		return nil, nil, false
+	}
+	net, ok := f.(Network)
+	if !ok || len(net) == 0 || !pc.IsActivation(net[len(net)-1]) {
+		return nil, nil, false
+	}
+	return pc, net[:len(net)-1], true
+}
+
+// preActivationBatcher is like preActivationFunc, but
+// for the batchers made by Network.BatchLearner.
+func preActivationBatcher(c CostFunc, b autofunc.Batcher) (PreActivationCostFunc,
+	autofunc.Batcher, bool) {
+	learner, ok := b.(*networkBatchLearner)
+	if !ok {
+		return nil, nil, false
+	}
+	pc, f, ok := preActivationFunc(c, learner.Network)
+	if !ok {
+		return nil, nil, false
+	}
+	return pc, f.(Network).makeBatcher(), true
+}
@@ -0,0 +1,62 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestSoftmaxCECost(t *testing.T) {
+	expected := linalg.Vector{0.2, 0, 0.8}
+	logits := &autofunc.Variable{Vector: linalg.Vector{0.5, -1, 2}}
+	probs := (&SoftmaxLayer{}).Apply(logits)
+
+	exp := softmaxCETestCost{}.Cost(expected, logits).Output()[0]
+	if c := (SoftmaxCECost{}).Cost(expected, probs).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("Cost: expected %f but got %f", exp, c)
+	}
+	c := SoftmaxCECost{}.CostLogits(expected, logits).Output()[0]
+	if math.Abs(c-exp) > 1e-10 {
+		t.Errorf("CostLogits: expected %f but got %f", exp, c)
+	}
+	checkCostFuncGradients(t, SoftmaxCECost{}, expected, probs.Output())
+}
+
+func TestSoftmaxCECostTotalCost(t *testing.T) {
+	dense := NewDenseLayer(3, 4)
+	net := Network{dense, &SoftmaxLayer{}}
+	samples := sgd.SliceSampleSet{}
+	for i := 0; i < 5; i++ {
+		target := make(linalg.Vector, 4)
+		target[i%4] = 1
+		samples = append(samples, VectorSample{Input: linalg.RandVector(3), Output: target})
+	}
+
+	var exp float64
+	for _, s := range samples {
+		vs := s.(VectorSample)
+		logits := dense.Apply(&autofunc.Variable{Vector: vs.Input})
+		exp += softmaxCETestCost{}.Cost(vs.Output, logits).Output()[0]
+	}
+	if c := TotalCost(SoftmaxCECost{}, net, samples); math.Abs(c-exp) > 1e-8 {
+		t.Errorf("TotalCost: expected %f but got %f", exp, c)
+	}
+	for _, batchSize := range []int{0, 2} {
+		c := TotalCostBatcher(SoftmaxCECost{}, net.BatchLearner(), samples, batchSize)
+		if math.Abs(c-exp) > 1e-8 {
+			t.Errorf("batch %d: expected %f but got %f", batchSize, exp, c)
+		}
+	}
+
+	// With huge logits, the probabilities underflow to
+	// zero, but the cost computed from the logits does not.
+	for _, param := range dense.Parameters() {
+		param.Vector.Scale(1e4)
+	}
+	if c := TotalCost(SoftmaxCECost{}, net, samples); math.IsInf(c, 0) || math.IsNaN(c) {
+		t.Errorf("expected a finite cost but got %f", c)
+	}
+}
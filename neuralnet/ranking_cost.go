@@ -0,0 +1,128 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// MultiNegativeHingeCost is a ranking loss which compares
+// the score of a positive example against the scores of
+// several negative examples.
+//
+// The actual vector is of the form [pos, neg1, neg2, ...],
+// and the cost is the sum of max(0, Margin-(pos-negJ))
+// over all the negatives.
+// The expected vector is ignored.
+//
+// At a kink (i.e. when pos-negJ equals Margin exactly),
+// the sub-gradient is taken to be 0.
+type MultiNegativeHingeCost struct {
+	Margin float64
+}
+
+func (m MultiNegativeHingeCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	n := len(a.Output())
+	if n < 2 {
+		panic("need a positive score and at least one negative")
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		pos := autofunc.Slice(a, 0, 1)
+		negs := autofunc.Slice(a, 1, n)
+		violations := autofunc.AddScaler(autofunc.AddFirst(negs, autofunc.Scale(pos, -1)),
+			m.Margin)
+		mask := &autofunc.Variable{Vector: positiveMask(violations.Output())}
+		return autofunc.SumAll(autofunc.Mul(mask, violations))
+	})
+}
+
+func (m MultiNegativeHingeCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n := len(a.Output())
+	if n < 2 {
+		panic("need a positive score and at least one negative")
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		pos := autofunc.SliceR(a, 0, 1)
+		negs := autofunc.SliceR(a, 1, n)
+		violations := autofunc.AddScalerR(autofunc.AddFirstR(negs, autofunc.ScaleR(pos, -1)),
+			m.Margin)
+		mask := &autofunc.Variable{Vector: positiveMask(violations.Output())}
+		return autofunc.SumAllR(autofunc.MulR(autofunc.NewRVariable(mask, v), violations))
+	})
+}
+
+// AUCSurrogateCost is a pairwise ranking loss which
+// optimizes a smooth surrogate of the area under the ROC
+// curve rather than threshold accuracy.
+//
+// The actual vector is of the form [pos, neg], containing
+// the scores of a positive and a negative example, and
+// the cost is max(0, 1-(pos-neg))^2.
+// The expected vector is ignored.
+//
+// Pairs which are ranked correctly by a margin of at
+// least 1 have a cost and a gradient of 0.
+type AUCSurrogateCost struct{}
+
+func (_ AUCSurrogateCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(a.Output()) != 2 {
+		panic("actual vector must contain two scores")
+	}
+	diff := autofunc.Mul(&autofunc.Variable{Vector: linalg.Vector{-1, 1}}, a)
+	violation := autofunc.AddScaler(autofunc.SumAll(diff), 1)
+	mask := &autofunc.Variable{Vector: positiveMask(violation.Output())}
+	return autofunc.Square(autofunc.Mul(mask, violation))
+}
+
+func (_ AUCSurrogateCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(a.Output()) != 2 {
+		panic("actual vector must contain two scores")
+	}
+	signs := autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{-1, 1}}, v)
+	violation := autofunc.AddScalerR(autofunc.SumAllR(autofunc.MulR(signs, a)), 1)
+	mask := &autofunc.Variable{Vector: positiveMask(violation.Output())}
+	return autofunc.SquareR(autofunc.MulR(autofunc.NewRVariable(mask, v), violation))
+}
+
+// SoftRank computes a differentiable approximation of the
+// ranks of the given scores, where the smallest score has
+// rank 1 and the largest has rank len(scores).
+//
+// The rank of score i is approximated as
+//
+//	1 + sum_{j != i} sigmoid((s_i - s_j) / regularization)
+//
+// which approaches the true rank as regularization
+// approaches 0.
+// Tied scores share the average of their ranks.
+func SoftRank(scores autofunc.Result, regularization float64) autofunc.Result {
+	return autofunc.Pool(scores, func(scores autofunc.Result) autofunc.Result {
+		n := len(scores.Output())
+		negScores := autofunc.Scale(scores, -1)
+		ranks := make([]autofunc.Result, n)
+		for i := range ranks {
+			diffs := autofunc.AddFirst(negScores, autofunc.Slice(scores, i, i+1))
+			probs := autofunc.Sigmoid{}.Apply(autofunc.Scale(diffs, 1/regularization))
+			// The j=i term contributes sigmoid(0) = 0.5.
+			ranks[i] = autofunc.AddScaler(autofunc.SumAll(probs), 0.5)
+		}
+		return autofunc.Concat(ranks...)
+	})
+}
+
+// SoftRankR is like SoftRank, but for RResults.
+func SoftRankR(v autofunc.RVector, scores autofunc.RResult,
+	regularization float64) autofunc.RResult {
+	return autofunc.PoolR(scores, func(scores autofunc.RResult) autofunc.RResult {
+		n := len(scores.Output())
+		negScores := autofunc.ScaleR(scores, -1)
+		ranks := make([]autofunc.RResult, n)
+		for i := range ranks {
+			diffs := autofunc.AddFirstR(negScores, autofunc.SliceR(scores, i, i+1))
+			probs := autofunc.Sigmoid{}.ApplyR(v, autofunc.ScaleR(diffs, 1/regularization))
+			ranks[i] = autofunc.AddScalerR(autofunc.SumAllR(probs), 0.5)
+		}
+		return autofunc.ConcatR(ranks...)
+	})
+}
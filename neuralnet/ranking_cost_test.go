@@ -0,0 +1,100 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestMultiNegativeHingeCostGradient(t *testing.T) {
+	checkCostFuncGradients(t, MultiNegativeHingeCost{Margin: 0.5}, nil,
+		linalg.Vector{0.3, 0.1, -0.7, 0.5, 0.35})
+}
+
+func TestMultiNegativeHingeCostViolations(t *testing.T) {
+	actual := &autofunc.Variable{Vector: []float64{1, 0.2, -1, 0.9}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost := MultiNegativeHingeCost{Margin: 0.5}.Cost(nil, actual)
+	cost.PropagateGradient(linalg.Vector{1}, grad)
+
+	if expected := 0.5 - 0.1; math.Abs(cost.Output()[0]-expected) > 1e-8 {
+		t.Errorf("expected cost %f but got %f", expected, cost.Output()[0])
+	}
+	expGrad := linalg.Vector{-1, 0, 0, 1}
+	if grad[actual].Copy().Scale(-1).Add(expGrad).MaxAbs() > 1e-8 {
+		t.Errorf("expected gradient %v but got %v", expGrad, grad[actual])
+	}
+}
+
+func TestAUCSurrogateCost(t *testing.T) {
+	checkCostFuncGradients(t, AUCSurrogateCost{}, nil, linalg.Vector{0.3, 0.1})
+
+	actual := &autofunc.Variable{Vector: []float64{0.2, 0.5}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost := AUCSurrogateCost{}.Cost(nil, actual)
+	cost.PropagateGradient(linalg.Vector{1}, grad)
+	if expected := 1.3 * 1.3; math.Abs(cost.Output()[0]-expected) > 1e-8 {
+		t.Errorf("expected cost %f but got %f", expected, cost.Output()[0])
+	}
+
+	// Descending the gradient should raise the positive
+	// score and lower the negative score.
+	if grad[actual][0] >= 0 || grad[actual][1] <= 0 {
+		t.Errorf("unexpected gradient %v", grad[actual])
+	}
+
+	ranked := &autofunc.Variable{Vector: []float64{1.5, 0.2}}
+	grad = autofunc.NewGradient([]*autofunc.Variable{ranked})
+	cost = AUCSurrogateCost{}.Cost(nil, ranked)
+	cost.PropagateGradient(linalg.Vector{1}, grad)
+	if cost.Output()[0] != 0 || grad[ranked].MaxAbs() != 0 {
+		t.Errorf("expected no cost for a ranked pair but got %f with gradient %v",
+			cost.Output()[0], grad[ranked])
+	}
+}
+
+func TestSoftRankConvergence(t *testing.T) {
+	scores := &autofunc.Variable{Vector: linalg.Vector{0.3, -1, 2, 0.5}}
+	trueRanks := []float64{2, 1, 4, 3}
+	lastErr := math.Inf(1)
+	for _, reg := range []float64{1, 0.1, 0.01, 0.001} {
+		ranks := SoftRank(scores, reg).Output()
+		var maxErr float64
+		for i, x := range ranks {
+			maxErr = math.Max(maxErr, math.Abs(x-trueRanks[i]))
+		}
+		if maxErr >= lastErr {
+			t.Errorf("regularization %f: error %f did not shrink from %f", reg, maxErr, lastErr)
+		}
+		lastErr = maxErr
+	}
+	if lastErr > 1e-6 {
+		t.Errorf("soft ranks did not converge: error %f", lastErr)
+	}
+}
+
+func TestSoftRankGradient(t *testing.T) {
+	in := &autofunc.Variable{Vector: linalg.RandVector(5)}
+	checker := &functest.RFuncChecker{
+		F:     softRankFunc{Regularization: 0.5},
+		Vars:  []*autofunc.Variable{in},
+		Input: in,
+		RV:    autofunc.RVector{in: linalg.RandVector(5)},
+	}
+	checker.FullCheck(t)
+}
+
+type softRankFunc struct {
+	Regularization float64
+}
+
+func (s softRankFunc) Apply(in autofunc.Result) autofunc.Result {
+	return SoftRank(in, s.Regularization)
+}
+
+func (s softRankFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return SoftRankR(v, in, s.Regularization)
+}
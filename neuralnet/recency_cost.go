@@ -0,0 +1,107 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// RecencyWeightedCost weights samples from a stream so
+// that older samples contribute exponentially less than
+// recent ones, letting a model adapt to concept drift.
+//
+// A sample's weight halves every HalfLife samples that
+// arrive after it.
+// The decay depends on a sample's position in the stream,
+// so it is applied by a RecencyStream.
+// On its own, a RecencyWeightedCost treats its input as
+// the newest sample, with a weight of 1.
+type RecencyWeightedCost struct {
+	HalfLife float64
+	CostFunc CostFunc
+}
+
+// Weight returns the weight of a sample which has been
+// followed by age newer samples.
+func (r RecencyWeightedCost) Weight(age int) float64 {
+	if r.HalfLife <= 0 {
+		panic("HalfLife must be positive")
+	}
+	return math.Pow(2, -float64(age)/r.HalfLife)
+}
+
+func (r RecencyWeightedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return r.CostFunc.Cost(x, a)
+}
+
+func (r RecencyWeightedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return r.CostFunc.CostR(v, x, a)
+}
+
+// A RecencyStream accumulates the costs and gradients of
+// samples from a stream, weighting each sample according
+// to a RecencyWeightedCost.
+//
+// Rather than storing every sample, the stream decays the
+// running sums whenever a new sample arrives.
+type RecencyStream struct {
+	Cost RecencyWeightedCost
+
+	gradSum   autofunc.Gradient
+	costSum   float64
+	weightSum float64
+	index     int
+}
+
+// NewRecencyStream creates a RecencyStream which
+// accumulates gradients for the given variables.
+func NewRecencyStream(c RecencyWeightedCost, vars []*autofunc.Variable) *RecencyStream {
+	return &RecencyStream{
+		Cost:    c,
+		gradSum: autofunc.NewGradient(vars),
+	}
+}
+
+// Add evaluates the cost of the next sample in the
+// stream, given its expected and actual outputs, and
+// adds it to the running sums.
+func (r *RecencyStream) Add(x linalg.Vector, a autofunc.Result) {
+	decay := r.Cost.Weight(1)
+	r.gradSum.Scale(decay)
+	r.costSum *= decay
+	r.weightSum *= decay
+
+	cost := r.Cost.Cost(x, a)
+	r.costSum += cost.Output()[0]
+	r.weightSum++
+	cost.PropagateGradient(linalg.Vector{1}, r.gradSum)
+	r.index++
+}
+
+// Index returns the number of samples which have been
+// added to the stream.
+func (r *RecencyStream) Index() int {
+	return r.index
+}
+
+// TotalCost returns the weighted average cost of the
+// samples in the stream.
+func (r *RecencyStream) TotalCost() float64 {
+	if r.weightSum == 0 {
+		return 0
+	}
+	return r.costSum / r.weightSum
+}
+
+// Gradient returns the weighted average gradient of the
+// samples in the stream.
+// The result is a copy, so it can be modified freely.
+func (r *RecencyStream) Gradient() autofunc.Gradient {
+	res := r.gradSum.Copy()
+	if r.weightSum > 0 {
+		res.Scale(1 / r.weightSum)
+	}
+	return res
+}
@@ -0,0 +1,52 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestRecencyWeightedCostWeight(t *testing.T) {
+	cost := RecencyWeightedCost{HalfLife: 2, CostFunc: MeanSquaredCost{}}
+	for age := 0; age < 6; age++ {
+		exp := math.Pow(0.5, float64(age)/2)
+		if w := cost.Weight(age); math.Abs(w-exp) > 1e-10 {
+			t.Errorf("age %d: expected weight %f but got %f", age, exp, w)
+		}
+	}
+}
+
+func TestRecencyStream(t *testing.T) {
+	param := &autofunc.Variable{Vector: linalg.Vector{0}}
+	cost := RecencyWeightedCost{HalfLife: 1, CostFunc: MeanSquaredCost{}}
+	stream := NewRecencyStream(cost, []*autofunc.Variable{param})
+
+	targets := []float64{3, 2, 1}
+	for _, x := range targets {
+		stream.Add(linalg.Vector{x}, param)
+	}
+	if stream.Index() != 3 {
+		t.Errorf("expected index 3 but got %d", stream.Index())
+	}
+
+	// With a half-life of one sample, the weights of the
+	// three samples are 1/4, 1/2, and 1.
+	weights := []float64{0.25, 0.5, 1}
+	var expCost, expGrad, weightSum float64
+	for i, x := range targets {
+		expCost += weights[i] * x * x
+		expGrad += weights[i] * -2 * x
+		weightSum += weights[i]
+	}
+	expCost /= weightSum
+	expGrad /= weightSum
+
+	if c := stream.TotalCost(); math.Abs(c-expCost) > 1e-10 {
+		t.Errorf("expected cost %f but got %f", expCost, c)
+	}
+	if g := stream.Gradient()[param][0]; math.Abs(g-expGrad) > 1e-10 {
+		t.Errorf("expected gradient %f but got %f", expGrad, g)
+	}
+}
@@ -0,0 +1,74 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// MultiReferenceCost evaluates a cost against several
+// acceptable expected vectors (e.g. paraphrases) and
+// returns the lowest of the resulting costs.
+//
+// The expected vector contains the references packed one
+// after another, each the same length as the actual
+// vector.
+// Use NewMultiReferenceSample to construct such samples.
+//
+// Only the best-matching reference contributes to the
+// gradient.
+// If several references tie, the first one is used.
+type MultiReferenceCost struct {
+	CostFunc CostFunc
+}
+
+// NewMultiReferenceSample creates a VectorSample whose
+// output packs the given references in the layout
+// expected by MultiReferenceCost.
+// All of the references must have the same length.
+func NewMultiReferenceSample(input linalg.Vector, refs []linalg.Vector) VectorSample {
+	if len(refs) == 0 {
+		panic("need at least one reference")
+	}
+	output := make(linalg.Vector, 0, len(refs)*len(refs[0]))
+	for _, ref := range refs {
+		if len(ref) != len(refs[0]) {
+			panic("references must have the same length")
+		}
+		output = append(output, ref...)
+	}
+	return VectorSample{Input: input, Output: output}
+}
+
+func (m MultiReferenceCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	var best autofunc.Result
+	for _, ref := range splitReferences(x, len(a.Output())) {
+		cost := m.CostFunc.Cost(ref, a)
+		if best == nil || cost.Output()[0] < best.Output()[0] {
+			best = cost
+		}
+	}
+	return best
+}
+
+func (m MultiReferenceCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	var best autofunc.RResult
+	for _, ref := range splitReferences(x, len(a.Output())) {
+		cost := m.CostFunc.CostR(v, ref, a)
+		if best == nil || cost.Output()[0] < best.Output()[0] {
+			best = cost
+		}
+	}
+	return best
+}
+
+func splitReferences(x linalg.Vector, size int) []linalg.Vector {
+	if size == 0 || len(x) == 0 || len(x)%size != 0 {
+		panic("expected vector must contain whole references")
+	}
+	refs := make([]linalg.Vector, len(x)/size)
+	for i := range refs {
+		refs[i] = x[i*size : (i+1)*size]
+	}
+	return refs
+}
@@ -0,0 +1,45 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestMultiReferenceCostBest(t *testing.T) {
+	refs := []linalg.Vector{{1, 1}, {0.5, -1}, {3, 0}}
+	expected := NewMultiReferenceSample(nil, refs).Output
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.4, -0.5}}
+	cost := MultiReferenceCost{CostFunc: MeanSquaredCost{}}.Cost(expected, actual)
+
+	// The second reference is closest, with a squared
+	// error of 0.01+0.25.
+	if c := cost.Output()[0]; math.Abs(c-0.26) > 1e-10 {
+		t.Errorf("expected cost 0.26 but got %f", c)
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.PropagateGradient(linalg.Vector{1}, grad)
+	expGrad := linalg.Vector{2 * (0.4 - 0.5), 2 * (-0.5 + 1)}
+	if grad[actual].Copy().Scale(-1).Add(expGrad).MaxAbs() > 1e-10 {
+		t.Errorf("expected gradient %v but got %v", expGrad, grad[actual])
+	}
+
+	checkCostFuncGradients(t, MultiReferenceCost{CostFunc: MeanSquaredCost{}}, expected,
+		actual.Vector)
+}
+
+func TestMultiReferenceCostTie(t *testing.T) {
+	refs := []linalg.Vector{{1, 0}, {-1, 0}}
+	expected := NewMultiReferenceSample(nil, refs).Output
+	actual := &autofunc.Variable{Vector: linalg.Vector{0, 0}}
+	cost := MultiReferenceCost{CostFunc: MeanSquaredCost{}}.Cost(expected, actual)
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.PropagateGradient(linalg.Vector{1}, grad)
+	if grad[actual][0] != -2 {
+		t.Errorf("expected gradient toward the first reference but got %v", grad[actual])
+	}
+}
@@ -0,0 +1,152 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// spectralNormIterations is the number of power
+// iteration steps used to estimate spectral norms.
+const spectralNormIterations = 20
+
+// SpectralNormCost adds onto another cost function the
+// squared spectral norms (i.e. largest singular values)
+// of various weight matrices.
+//
+// Each weight variable is a row-major matrix with Rows
+// rows and Cols columns.
+// The spectral norm is estimated with power iteration,
+// which yields singular vectors u and v such that the
+// spectral norm is u*W*v.
+// The singular vectors are treated as constants, which
+// gives the exact gradient once the iteration converges.
+// CostR also treats them as constants, so the second
+// derivative ignores how the singular vectors depend on
+// the weights and is only an approximation.
+type SpectralNormCost struct {
+	Weights []*autofunc.Variable
+	Rows    int
+	Cols    int
+
+	// Penalty is used as a coefficient for the squared
+	// spectral norms.
+	Penalty float64
+
+	CostFunc CostFunc
+}
+
+func (s *SpectralNormCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	cost := s.CostFunc.Cost(x, a)
+	for _, w := range s.Weights {
+		outer := &autofunc.Variable{Vector: s.singularOuter(w.Vector)}
+		sigma := dotProduct(w, outer)
+		cost = autofunc.Add(cost, autofunc.Scale(autofunc.Square(sigma), s.Penalty))
+	}
+	return cost
+}
+
+func (s *SpectralNormCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	cost := s.CostFunc.CostR(v, x, a)
+	for _, w := range s.Weights {
+		outer := &autofunc.Variable{Vector: s.singularOuter(w.Vector)}
+		sigma := dotProductR(autofunc.NewRVariable(w, v), autofunc.NewRVariable(outer, v))
+		cost = autofunc.AddR(cost, autofunc.ScaleR(autofunc.SquareR(sigma), s.Penalty))
+	}
+	return cost
+}
+
+// singularOuter computes the outer product u*v^T of the
+// estimated top singular vectors of a matrix, so that
+// its dot product with the matrix is the spectral norm.
+func (s *SpectralNormCost) singularOuter(w linalg.Vector) linalg.Vector {
+	if len(w) != s.Rows*s.Cols {
+		panic("weight size must match Rows*Cols")
+	}
+	u, v, _ := powerIteration(w, s.Rows, s.Cols, spectralNormIterations)
+	res := make(linalg.Vector, len(w))
+	for i, x := range u {
+		for j, y := range v {
+			res[i*s.Cols+j] = x * y
+		}
+	}
+	return res
+}
+
+// powerIteration estimates the top singular value of a
+// row-major matrix along with its left and right
+// singular vectors.
+func powerIteration(w linalg.Vector, rows, cols, iters int) (u, v linalg.Vector,
+	sigma float64) {
+	v = make(linalg.Vector, cols)
+	for i := range v {
+		v[i] = 1 / math.Sqrt(float64(cols))
+	}
+	u = make(linalg.Vector, rows)
+	for iter := 0; iter < iters; iter++ {
+		for i := range u {
+			u[i] = w[i*cols : (i+1)*cols].Dot(v)
+		}
+		if mag := u.Mag(); mag != 0 {
+			u.Scale(1 / mag)
+		}
+		for j := range v {
+			var sum float64
+			for i, x := range u {
+				sum += x * w[i*cols+j]
+			}
+			v[j] = sum
+		}
+		sigma = v.Mag()
+		if sigma != 0 {
+			v.Scale(1 / sigma)
+		}
+	}
+	return
+}
+
+// EntropyRegularizedCost adds an entropy term onto
+// another cost function, where the actual vector holds
+// logits and the entropy is that of their softmax.
+//
+// The cost is CostFunc's cost minus Penalty times the
+// entropy.
+// Thus, a positive Penalty is an entropy bonus which
+// pushes predictions toward uniform (encouraging
+// exploration), while a negative Penalty penalizes
+// entropy and pushes predictions toward one-hot (as in
+// entropy minimization for semi-supervised learning).
+//
+// If CostFunc is nil, only the entropy term is used,
+// which is useful for unlabeled samples.
+type EntropyRegularizedCost struct {
+	Penalty  float64
+	CostFunc CostFunc
+}
+
+func (e EntropyRegularizedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logProbs := (&LogSoftmaxLayer{}).Apply(a)
+		negEntropy := dotProduct(autofunc.Exp{}.Apply(logProbs), logProbs)
+		reg := autofunc.Scale(negEntropy, e.Penalty)
+		if e.CostFunc == nil {
+			return reg
+		}
+		return autofunc.Add(e.CostFunc.Cost(x, a), reg)
+	})
+}
+
+func (e EntropyRegularizedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		logProbs := (&LogSoftmaxLayer{}).ApplyR(v, a)
+		negEntropy := dotProductR(autofunc.Exp{}.ApplyR(v, logProbs), logProbs)
+		reg := autofunc.ScaleR(negEntropy, e.Penalty)
+		if e.CostFunc == nil {
+			return reg
+		}
+		return autofunc.AddR(e.CostFunc.CostR(v, x, a), reg)
+	})
+}
@@ -0,0 +1,97 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestPowerIteration(t *testing.T) {
+	diag := linalg.Vector{1, 0, 0, 0, 3, 0}
+	_, _, sigma := powerIteration(diag, 2, 3, spectralNormIterations)
+	if math.Abs(sigma-3) > 1e-6 {
+		t.Errorf("diagonal matrix: expected 3 but got %f", sigma)
+	}
+
+	// The outer product of [1, 2] and [2, -1, 2] has a
+	// spectral norm of sqrt(5)*3.
+	rankOne := linalg.Vector{2, -1, 2, 4, -2, 4}
+	expected := math.Sqrt(5) * 3
+	_, _, sigma = powerIteration(rankOne, 2, 3, spectralNormIterations)
+	if math.Abs(sigma-expected) > 1e-6 {
+		t.Errorf("rank one matrix: expected %f but got %f", expected, sigma)
+	}
+
+	general := linalg.Vector{2, 1, 1, 3}
+	expected = math.Sqrt((15 + math.Sqrt(125)) / 2)
+	_, _, sigma = powerIteration(general, 2, 2, spectralNormIterations)
+	if math.Abs(sigma-expected) > 1e-6 {
+		t.Errorf("general matrix: expected %f but got %f", expected, sigma)
+	}
+}
+
+func TestSpectralNormCostGradient(t *testing.T) {
+	weights := &autofunc.Variable{Vector: linalg.Vector{2, 1, 0.5, -1, 3, 0.2}}
+	actual := &autofunc.Variable{Vector: linalg.RandVector(3)}
+	cost := &SpectralNormCost{
+		Weights:  []*autofunc.Variable{weights},
+		Rows:     2,
+		Cols:     3,
+		Penalty:  0.5,
+		CostFunc: MeanSquaredCost{},
+	}
+	expected := linalg.RandVector(3)
+	grad := autofunc.NewGradient([]*autofunc.Variable{weights, actual})
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+
+	for i := range weights.Vector {
+		old := weights.Vector[i]
+		weights.Vector[i] = old + 1e-5
+		c1 := cost.Cost(expected, actual).Output()[0]
+		weights.Vector[i] = old - 1e-5
+		c2 := cost.Cost(expected, actual).Output()[0]
+		weights.Vector[i] = old
+		if numeric := (c1 - c2) / 2e-5; math.Abs(numeric-grad[weights][i]) > 1e-4 {
+			t.Errorf("weight %d: expected gradient %f but got %f", i, numeric,
+				grad[weights][i])
+		}
+	}
+}
+
+func TestEntropyRegularizedCostGradient(t *testing.T) {
+	for _, penalty := range []float64{0.5, -0.5} {
+		cost := EntropyRegularizedCost{Penalty: penalty, CostFunc: softmaxCETestCost{}}
+		checkCostFuncGradients(t, cost, linalg.Vector{0, 1, 0}, linalg.Vector{1, 0.3, -0.5})
+	}
+}
+
+func TestEntropyRegularizedCostDirection(t *testing.T) {
+	entropy := func(logits linalg.Vector) float64 {
+		probs := (&SoftmaxLayer{}).Apply(&autofunc.Variable{Vector: logits}).Output()
+		var res float64
+		for _, p := range probs {
+			res -= p * math.Log(p)
+		}
+		return res
+	}
+	descend := func(penalty float64) linalg.Vector {
+		logits := &autofunc.Variable{Vector: linalg.Vector{1, 0, -0.5}}
+		cost := EntropyRegularizedCost{Penalty: penalty}
+		for i := 0; i < 100; i++ {
+			grad := autofunc.NewGradient([]*autofunc.Variable{logits})
+			cost.Cost(nil, logits).PropagateGradient(linalg.Vector{1}, grad)
+			grad.AddToVars(-0.1)
+		}
+		return logits.Vector
+	}
+
+	start := entropy(linalg.Vector{1, 0, -0.5})
+	if h := entropy(descend(1)); h <= start+0.1 || h > math.Log(3) {
+		t.Errorf("positive penalty: entropy went from %f to %f", start, h)
+	}
+	if h := entropy(descend(-1)); h >= start-0.1 {
+		t.Errorf("negative penalty: entropy went from %f to %f", start, h)
+	}
+}
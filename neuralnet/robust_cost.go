@@ -0,0 +1,131 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// ClampedCost caps the cost of each sample at Max to
+// limit the influence of outliers and mislabeled
+// samples.
+//
+// When CostFunc's cost exceeds Max, the result is the
+// constant Max, so the sample contributes no gradient.
+// At or below Max, CostFunc's cost and gradient are used
+// unchanged.
+type ClampedCost struct {
+	Max      float64
+	CostFunc CostFunc
+}
+
+func (c ClampedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	cost := c.CostFunc.Cost(x, a)
+	if cost.Output()[0] > c.Max {
+		return &autofunc.Variable{Vector: linalg.Vector{c.Max}}
+	}
+	return cost
+}
+
+func (c ClampedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	cost := c.CostFunc.CostR(v, x, a)
+	if cost.Output()[0] > c.Max {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{c.Max}}, v)
+	}
+	return cost
+}
+
+// ImprovedMAECost is a noise-robust variant of AbsCost
+// whose gradient for each residual r is the L1 gradient
+// scaled by exp(-|r|/Temperature).
+//
+// Equivalently, the cost is the sum of
+// Temperature*(1-exp(-|r|/Temperature)), which is close
+// to |r| for small residuals but saturates at
+// Temperature, so gross outliers contribute almost no
+// gradient.
+// As Temperature grows, the cost approaches AbsCost.
+// Temperature must be positive.
+type ImprovedMAECost struct {
+	Temperature float64
+}
+
+func (i ImprovedMAECost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	i.checkTemperature()
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	diff := autofunc.Add(xVar, a)
+	mask := &autofunc.Variable{Vector: signMask(diff.Output()).Scale(-1 / i.Temperature)}
+	decay := autofunc.Exp{}.Apply(autofunc.Mul(mask, diff))
+	sum := autofunc.SumAll(decay)
+	return autofunc.AddScaler(autofunc.Scale(sum, -i.Temperature), i.Temperature*float64(len(x)))
+}
+
+func (i ImprovedMAECost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	i.checkTemperature()
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	diff := autofunc.AddR(xVar, a)
+	mask := &autofunc.Variable{Vector: signMask(diff.Output()).Scale(-1 / i.Temperature)}
+	decay := autofunc.Exp{}.ApplyR(v, autofunc.MulR(autofunc.NewRVariable(mask, v), diff))
+	sum := autofunc.SumAllR(decay)
+	return autofunc.AddScalerR(autofunc.ScaleR(sum, -i.Temperature),
+		i.Temperature*float64(len(x)))
+}
+
+func (i ImprovedMAECost) checkTemperature() {
+	if i.Temperature <= 0 {
+		panic("Temperature must be positive")
+	}
+}
+
+// ConfidenceMaskedCost avoids reinforcing confident
+// mistakes, which are often caused by noisy labels.
+//
+// The actual vector contains logits, and the expected
+// vector contains a one-hot (or soft) target whose
+// largest entry is taken as the label.
+// If the largest softmax probability exceeds Threshold
+// and belongs to a class other than the label, the cost
+// is still reported, but it is returned as a constant so
+// that no gradient flows.
+// Otherwise, CostFunc's cost and gradient are used
+// unchanged.
+type ConfidenceMaskedCost struct {
+	Threshold float64
+	CostFunc  CostFunc
+}
+
+func (c ConfidenceMaskedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	cost := c.CostFunc.Cost(x, a)
+	if c.confidentlyWrong(x, a.Output()) {
+		return &autofunc.Variable{Vector: cost.Output()}
+	}
+	return cost
+}
+
+func (c ConfidenceMaskedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	cost := c.CostFunc.CostR(v, x, a)
+	if c.confidentlyWrong(x, a.Output()) {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: cost.Output()}, v)
+	}
+	return cost
+}
+
+func (c ConfidenceMaskedCost) confidentlyWrong(x, logits linalg.Vector) bool {
+	probs := (&autofunc.Softmax{}).Apply(&autofunc.Variable{Vector: logits}).Output()
+	predicted := maxIndex(probs)
+	return predicted != maxIndex(x) && probs[predicted] > c.Threshold
+}
+
+// maxIndex returns the index of the first largest entry
+// of v.
+func maxIndex(v linalg.Vector) int {
+	var res int
+	for i, x := range v {
+		if x > v[res] {
+			res = i
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestClampedCost(t *testing.T) {
+	cost := ClampedCost{Max: 1, CostFunc: MeanSquaredCost{}}
+	expected := linalg.Vector{0, 0}
+
+	outlier := &autofunc.Variable{Vector: linalg.Vector{3, 1}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{outlier})
+	out := cost.Cost(expected, outlier)
+	if out.Output()[0] != 1 {
+		t.Errorf("expected capped cost 1 but got %f", out.Output()[0])
+	}
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	for i, g := range grad[outlier] {
+		if g != 0 {
+			t.Errorf("capped sample should have no gradient, got %f at %d", g, i)
+		}
+	}
+
+	rOut := cost.CostR(autofunc.RVector{}, expected, autofunc.NewRVariable(outlier,
+		autofunc.RVector{}))
+	if rOut.Output()[0] != 1 || rOut.ROutput()[0] != 0 {
+		t.Errorf("unexpected R output: %v, %v", rOut.Output(), rOut.ROutput())
+	}
+
+	checkCostFuncGradients(t, cost, expected, linalg.Vector{0.5, -0.3})
+}
+
+func TestImprovedMAECost(t *testing.T) {
+	cost := ImprovedMAECost{Temperature: 1}
+	expected := linalg.Vector{0, 0}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.1, -20}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	small, large := math.Abs(grad[actual][0]), math.Abs(grad[actual][1])
+	if large > 1e-6 || small < 0.9 {
+		t.Errorf("outlier gradient %f should vanish while inlier gradient %f stays near 1",
+			large, small)
+	}
+	if grad[actual][1] > 0 {
+		t.Errorf("outlier gradient should keep the L1 sign")
+	}
+
+	abs := AbsCost{}.Cost(expected, actual).Output()[0]
+	wide := ImprovedMAECost{Temperature: 1e6}.Cost(expected, actual).Output()[0]
+	if math.Abs(abs-wide) > 1e-3 {
+		t.Errorf("large temperature should approach AbsCost: %f vs %f", wide, abs)
+	}
+
+	checkCostFuncGradients(t, ImprovedMAECost{Temperature: 0.7}, linalg.Vector{1, -1, 0.5},
+		linalg.Vector{0.2, 0.4, 2})
+}
+
+func TestImprovedMAECostValidation(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for zero temperature")
+		}
+	}()
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.1, -20}}
+	ImprovedMAECost{}.Cost(linalg.Vector{0, 0}, actual)
+}
+
+func TestConfidenceMaskedCost(t *testing.T) {
+	cost := ConfidenceMaskedCost{Threshold: 0.9, CostFunc: softmaxCETestCost{}}
+	expected := linalg.Vector{0, 1, 0}
+	gradient := func(logits linalg.Vector) (float64, linalg.Vector) {
+		actual := &autofunc.Variable{Vector: logits}
+		out := cost.Cost(expected, actual)
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		out.PropagateGradient(linalg.Vector{1}, grad)
+		return out.Output()[0], grad[actual]
+	}
+
+	wrong := linalg.Vector{5, 0, -1}
+	c, g := gradient(wrong)
+	exp := softmaxCETestCost{}.Cost(expected, &autofunc.Variable{Vector: wrong}).Output()[0]
+	if math.Abs(c-exp) > 1e-10 {
+		t.Errorf("confident-wrong: expected cost %f but got %f", exp, c)
+	}
+	if g.MaxAbs() != 0 {
+		t.Errorf("confident-wrong: expected no gradient but got %v", g)
+	}
+
+	for _, logits := range []linalg.Vector{{0, 5, -1}, {1, 0.5, -1}} {
+		if _, g := gradient(logits); g.MaxAbs() == 0 {
+			t.Errorf("logits %v: expected a gradient", logits)
+		}
+		checkCostFuncGradients(t, cost, expected, logits)
+	}
+}
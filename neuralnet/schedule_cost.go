@@ -0,0 +1,182 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// WarmupScaledCost scales the output of CostFunc (and
+// thus its gradient) by a factor which grows linearly
+// from 0 to 1 over the first WarmupSteps training steps.
+//
+// Call Step once after every training step to advance
+// the schedule.
+type WarmupScaledCost struct {
+	WarmupSteps int
+	CostFunc    CostFunc
+
+	step int
+}
+
+// Step advances the warmup schedule by one step.
+func (w *WarmupScaledCost) Step() {
+	w.step++
+}
+
+// Scale returns the current scale factor.
+func (w *WarmupScaledCost) Scale() float64 {
+	if w.step >= w.WarmupSteps {
+		return 1
+	}
+	return float64(w.step) / float64(w.WarmupSteps)
+}
+
+// CostContributions returns the scaled contributions of
+// CostFunc.
+func (w *WarmupScaledCost) CostContributions(x linalg.Vector,
+	a autofunc.Result) linalg.Vector {
+	return CostContributions(w.CostFunc, x, a).Copy().Scale(w.Scale())
+}
+
+func (w *WarmupScaledCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return autofunc.Scale(w.CostFunc.Cost(x, a), w.Scale())
+}
+
+func (w *WarmupScaledCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return autofunc.ScaleR(w.CostFunc.CostR(v, x, a), w.Scale())
+}
+
+// CyclicalCost alternates between two cost functions,
+// switching every Period training steps.
+//
+// CostA is active for the first Period steps, then CostB
+// for the next Period steps, and so on.
+// Call Step once after every training step to advance
+// the schedule.
+type CyclicalCost struct {
+	CostA  CostFunc
+	CostB  CostFunc
+	Period int
+
+	step int
+}
+
+// Step advances the schedule by one step.
+func (c *CyclicalCost) Step() {
+	c.step++
+}
+
+// Active returns the currently active cost function.
+func (c *CyclicalCost) Active() CostFunc {
+	if c.Period <= 0 {
+		panic("Period must be positive")
+	}
+	if (c.step/c.Period)%2 == 0 {
+		return c.CostA
+	}
+	return c.CostB
+}
+
+// CostContributions returns the contributions of the
+// active cost function.
+func (c *CyclicalCost) CostContributions(x linalg.Vector, a autofunc.Result) linalg.Vector {
+	return CostContributions(c.Active(), x, a)
+}
+
+func (c *CyclicalCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return c.Active().Cost(x, a)
+}
+
+func (c *CyclicalCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return c.Active().CostR(v, x, a)
+}
+
+// A ScheduledCostComponent is one named term of a
+// WeightedCostScheduler.
+//
+// If Schedule is non-nil, the scheduler's Step method
+// updates Weight to Schedule(step) for the next
+// training step.
+type ScheduledCostComponent struct {
+	Name     string
+	CostFunc CostFunc
+	Weight   float64
+	Schedule func(step int) float64
+}
+
+// WeightedCostScheduler is a weighted sum of named cost
+// functions, each of which has its own weight schedule.
+//
+// Every component is applied to the full expected and
+// actual vectors; use a CompositeCost as a component's
+// CostFunc to restrict it to part of the output.
+// Call Step once after every training step to advance
+// the schedules.
+type WeightedCostScheduler struct {
+	Components []ScheduledCostComponent
+
+	step int
+}
+
+// Step advances the training step and updates the
+// weight of every component which has a Schedule.
+func (w *WeightedCostScheduler) Step() {
+	w.step++
+	for i, comp := range w.Components {
+		if comp.Schedule != nil {
+			w.Components[i].Weight = comp.Schedule(w.step)
+		}
+	}
+}
+
+// Contributions returns the weighted cost of each
+// component, keyed by name, which is useful for logging.
+func (w *WeightedCostScheduler) Contributions(x linalg.Vector,
+	a autofunc.Result) map[string]float64 {
+	res := map[string]float64{}
+	for _, comp := range w.Components {
+		res[comp.Name] += comp.Weight * comp.CostFunc.Cost(x, a).Output()[0]
+	}
+	return res
+}
+
+// CostContributions returns the weighted sum of the
+// components' per-component contributions.
+// If any component does not decompose, the result is a
+// single element containing the total cost.
+func (w *WeightedCostScheduler) CostContributions(x linalg.Vector,
+	a autofunc.Result) linalg.Vector {
+	res := make(linalg.Vector, len(x))
+	for _, comp := range w.Components {
+		if !addContributions(res, 0, comp.CostFunc, comp.Weight, x, a) {
+			return w.Cost(x, a).Output()
+		}
+	}
+	return res
+}
+
+func (w *WeightedCostScheduler) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		var sum autofunc.Result = &autofunc.Variable{Vector: linalg.Vector{0}}
+		for _, comp := range w.Components {
+			cost := comp.CostFunc.Cost(x, a)
+			sum = autofunc.Add(sum, autofunc.Scale(cost, comp.Weight))
+		}
+		return sum
+	})
+}
+
+func (w *WeightedCostScheduler) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+		var sum autofunc.RResult = autofunc.NewRVariable(zero, v)
+		for _, comp := range w.Components {
+			cost := comp.CostFunc.CostR(v, x, a)
+			sum = autofunc.AddR(sum, autofunc.ScaleR(cost, comp.Weight))
+		}
+		return sum
+	})
+}
@@ -0,0 +1,105 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestWarmupScaledCost(t *testing.T) {
+	cost := &WarmupScaledCost{WarmupSteps: 4, CostFunc: MeanSquaredCost{}}
+	expected := linalg.Vector{1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{2, 1}}
+	vars := []*autofunc.Variable{actual}
+
+	fullGrad := autofunc.NewGradient(vars)
+	MeanSquaredCost{}.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, fullGrad)
+
+	for step := 0; step < 7; step++ {
+		grad := autofunc.NewGradient(vars)
+		cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+		scale := math.Min(1, float64(step)/4)
+		for i, x := range fullGrad[actual] {
+			if math.Abs(grad[actual][i]-scale*x) > 1e-10 {
+				t.Errorf("step %d: expected gradient %f but got %f", step, scale*x,
+					grad[actual][i])
+			}
+		}
+		cost.Step()
+	}
+}
+
+func TestCyclicalCost(t *testing.T) {
+	cost := &CyclicalCost{CostA: MeanSquaredCost{}, CostB: AbsCost{}, Period: 3}
+	expected := linalg.Vector{1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{2, 1}}
+
+	mse := MeanSquaredCost{}.Cost(expected, actual).Output()[0]
+	abs := AbsCost{}.Cost(expected, actual).Output()[0]
+	for step := 0; step < 10; step++ {
+		exp := mse
+		if step%6 >= 3 {
+			exp = abs
+		}
+		if c := cost.Cost(expected, actual).Output()[0]; c != exp {
+			t.Errorf("step %d: expected %f but got %f", step, exp, c)
+		}
+		cost.Step()
+	}
+}
+
+func TestWeightedCostScheduler(t *testing.T) {
+	cost := &WeightedCostScheduler{
+		Components: []ScheduledCostComponent{
+			{Name: "mse", CostFunc: MeanSquaredCost{}, Weight: 1},
+			{
+				Name:     "abs",
+				CostFunc: AbsCost{},
+				Schedule: func(step int) float64 {
+					return math.Min(1, float64(step)/4)
+				},
+			},
+			{
+				Name:     "logcosh",
+				CostFunc: LogCoshCost{},
+				Weight:   2,
+				Schedule: func(step int) float64 {
+					return 2 / float64(step+1)
+				},
+			},
+		},
+	}
+	expected := linalg.Vector{1, -1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{2, 1}}
+	costs := map[string]float64{
+		"mse":     MeanSquaredCost{}.Cost(expected, actual).Output()[0],
+		"abs":     AbsCost{}.Cost(expected, actual).Output()[0],
+		"logcosh": LogCoshCost{}.Cost(expected, actual).Output()[0],
+	}
+
+	for step := 0; step < 6; step++ {
+		weights := map[string]float64{
+			"mse":     1,
+			"abs":     math.Min(1, float64(step)/4),
+			"logcosh": 2 / float64(step+1),
+		}
+		contribs := cost.Contributions(expected, actual)
+		var total float64
+		for name, weight := range weights {
+			exp := weight * costs[name]
+			if math.Abs(contribs[name]-exp) > 1e-10 {
+				t.Errorf("step %d: expected %s contribution %f but got %f", step, name, exp,
+					contribs[name])
+			}
+			total += exp
+		}
+		if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-total) > 1e-10 {
+			t.Errorf("step %d: expected total %f but got %f", step, total, c)
+		}
+		cost.Step()
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}
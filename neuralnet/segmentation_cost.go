@@ -0,0 +1,470 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// BoundaryLoss computes a per-pixel weighted binary
+// cross entropy for segmentation masks.
+//
+// The actual vector contains one logit per pixel of a
+// Width by Height image, and the expected vector
+// contains the binary target mask.
+// DistanceMap contains one weight per pixel, typically
+// computed from each pixel's distance to the nearest
+// object boundary (e.g. 1+w*exp(-d^2/s)), so that pixels
+// near boundaries are emphasized.
+type BoundaryLoss struct {
+	Width       int
+	Height      int
+	DistanceMap linalg.Vector
+}
+
+func (b BoundaryLoss) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	b.checkSizes(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		weights := &autofunc.Variable{Vector: b.DistanceMap}
+		return autofunc.SumAll(autofunc.Mul(weights, pixelSigmoidCE(x, a)))
+	})
+}
+
+func (b BoundaryLoss) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	b.checkSizes(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		weights := autofunc.NewRVariable(&autofunc.Variable{Vector: b.DistanceMap}, v)
+		return autofunc.SumAllR(autofunc.MulR(weights, pixelSigmoidCER(v, x, a)))
+	})
+}
+
+func (b BoundaryLoss) checkSizes(x, a linalg.Vector) {
+	size := b.Width * b.Height
+	if len(b.DistanceMap) != size || len(x) != size || len(a) != size {
+		panic("vector sizes must match the image size")
+	}
+}
+
+// pixelSigmoidCE computes the sigmoid cross entropy of
+// each component separately, without summing.
+func pixelSigmoidCE(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	logsig := autofunc.LogSigmoid{}
+	xVar := &autofunc.Variable{Vector: x}
+	oneMinusX := autofunc.AddScaler(autofunc.Scale(xVar, -1), 1)
+	sums := autofunc.Add(autofunc.Mul(xVar, logsig.Apply(a)),
+		autofunc.Mul(oneMinusX, logsig.Apply(autofunc.Scale(a, -1))))
+	return autofunc.Scale(sums, -1)
+}
+
+func pixelSigmoidCER(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	logsig := autofunc.LogSigmoid{}
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x}, v)
+	oneMinusX := autofunc.AddScalerR(autofunc.ScaleR(xVar, -1), 1)
+	sums := autofunc.AddR(autofunc.MulR(xVar, logsig.ApplyR(v, a)),
+		autofunc.MulR(oneMinusX, logsig.ApplyR(v, autofunc.ScaleR(a, -1))))
+	return autofunc.ScaleR(sums, -1)
+}
+
+// tverskySmoothing is added to the numerator and the
+// denominator of Tversky indices to avoid dividing by
+// zero on empty masks.
+const tverskySmoothing = 1e-6
+
+// UnifiedFocalLoss implements the asymmetric unified
+// focal loss from Yeung et al. (2022) for binary
+// segmentation, treating the positive class as rare.
+//
+// The actual vector contains one logit per pixel, and
+// the expected vector contains the binary target mask.
+//
+// The loss is Weight times a modified focal loss plus
+// (1-Weight) times a focal Tversky loss.
+// In both components, Delta weights the positive class
+// against the background (and false negatives against
+// false positives), while Gamma suppresses the focal
+// loss of easy background pixels and enhances the
+// Tversky loss of the positive class.
+type UnifiedFocalLoss struct {
+	Weight float64
+	Delta  float64
+	Gamma  float64
+}
+
+func (u UnifiedFocalLoss) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		return autofunc.Add(
+			autofunc.Scale(u.focal(x, a), u.Weight),
+			autofunc.Scale(u.focalTversky(x, a), 1-u.Weight),
+		)
+	})
+}
+
+func (u UnifiedFocalLoss) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		return autofunc.AddR(
+			autofunc.ScaleR(u.focalR(v, x, a), u.Weight),
+			autofunc.ScaleR(u.focalTverskyR(v, x, a), 1-u.Weight),
+		)
+	})
+}
+
+// focal computes the modified asymmetric focal loss,
+// averaged over pixels.
+func (u UnifiedFocalLoss) focal(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	logsig := autofunc.LogSigmoid{}
+	logP := logsig.Apply(a)
+	log1P := logsig.Apply(autofunc.Scale(a, -1))
+	bgWeight := autofunc.Exp{}.Apply(autofunc.Scale(logP, u.Gamma))
+
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(u.Delta)}
+	oneMinusX := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	for i := range oneMinusX.Vector {
+		oneMinusX.Vector[i] = (1 + oneMinusX.Vector[i]) * (1 - u.Delta)
+	}
+	sums := autofunc.Add(autofunc.Mul(xVar, logP),
+		autofunc.Mul(oneMinusX, autofunc.Mul(bgWeight, log1P)))
+	return autofunc.Scale(autofunc.SumAll(sums), -1/float64(len(x)))
+}
+
+func (u UnifiedFocalLoss) focalR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	logsig := autofunc.LogSigmoid{}
+	logP := logsig.ApplyR(v, a)
+	log1P := logsig.ApplyR(v, autofunc.ScaleR(a, -1))
+	bgWeight := autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(logP, u.Gamma))
+
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(u.Delta)}
+	oneMinusX := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	for i := range oneMinusX.Vector {
+		oneMinusX.Vector[i] = (1 + oneMinusX.Vector[i]) * (1 - u.Delta)
+	}
+	sums := autofunc.AddR(autofunc.MulR(autofunc.NewRVariable(xVar, v), logP),
+		autofunc.MulR(autofunc.NewRVariable(oneMinusX, v), autofunc.MulR(bgWeight, log1P)))
+	return autofunc.ScaleR(autofunc.SumAllR(sums), -1/float64(len(x)))
+}
+
+// focalTversky computes the asymmetric focal Tversky
+// loss, summed over the background and positive class.
+func (u UnifiedFocalLoss) focalTversky(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	probs := autofunc.Sigmoid{}.Apply(a)
+	return autofunc.Pool(probs, func(probs autofunc.Result) autofunc.Result {
+		tp, fn, fp := confusionCounts(x, probs)
+		tn := autofunc.AddScaler(autofunc.Scale(fp, -1), float64(len(x))-sumVector(x))
+
+		posIndex := tverskyIndex(tp, fn, fp, u.Delta, 1-u.Delta, tverskySmoothing)
+		bgIndex := tverskyIndex(tn, fp, fn, u.Delta, 1-u.Delta, tverskySmoothing)
+		posLoss := autofunc.AddScaler(autofunc.Scale(posIndex, -1), 1)
+		posLoss = autofunc.Exp{}.Apply(autofunc.Scale(autofunc.Log{}.Apply(posLoss), 1-u.Gamma))
+		return autofunc.Add(autofunc.AddScaler(autofunc.Scale(bgIndex, -1), 1), posLoss)
+	})
+}
+
+func (u UnifiedFocalLoss) focalTverskyR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	probs := autofunc.Sigmoid{}.ApplyR(v, a)
+	return autofunc.PoolR(probs, func(probs autofunc.RResult) autofunc.RResult {
+		tp, fn, fp := confusionCountsR(v, x, probs)
+		tn := autofunc.AddScalerR(autofunc.ScaleR(fp, -1), float64(len(x))-sumVector(x))
+
+		posIndex := tverskyIndexR(tp, fn, fp, u.Delta, 1-u.Delta, tverskySmoothing)
+		bgIndex := tverskyIndexR(tn, fp, fn, u.Delta, 1-u.Delta, tverskySmoothing)
+		posLoss := autofunc.AddScalerR(autofunc.ScaleR(posIndex, -1), 1)
+		posLoss = autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(autofunc.Log{}.ApplyR(v, posLoss),
+			1-u.Gamma))
+		return autofunc.AddR(autofunc.AddScalerR(autofunc.ScaleR(bgIndex, -1), 1), posLoss)
+	})
+}
+
+// tverskyIndex computes the smoothed Tversky index
+// (tp+smooth)/(tp + alpha*fn + beta*fp + smooth).
+func tverskyIndex(tp, fn, fp autofunc.Result, alpha, beta, smooth float64) autofunc.Result {
+	num := autofunc.AddScaler(tp, smooth)
+	denom := autofunc.Add(num, autofunc.Add(autofunc.Scale(fn, alpha),
+		autofunc.Scale(fp, beta)))
+	return autofunc.Mul(num, autofunc.Inverse(denom))
+}
+
+func tverskyIndexR(tp, fn, fp autofunc.RResult, alpha, beta, smooth float64) autofunc.RResult {
+	num := autofunc.AddScalerR(tp, smooth)
+	denom := autofunc.AddR(num, autofunc.AddR(autofunc.ScaleR(fn, alpha),
+		autofunc.ScaleR(fp, beta)))
+	return autofunc.MulR(num, autofunc.InverseR(denom))
+}
+
+// confusionCounts computes the soft true positive, false
+// negative, and false positive counts of predicted
+// probabilities against a binary mask.
+func confusionCounts(x linalg.Vector, probs autofunc.Result) (tp, fn, fp autofunc.Result) {
+	tp = dotProduct(&autofunc.Variable{Vector: x}, probs)
+	negTP := autofunc.Scale(tp, -1)
+	fn = autofunc.AddScaler(negTP, sumVector(x))
+	fp = autofunc.Add(autofunc.SumAll(probs), negTP)
+	return
+}
+
+func confusionCountsR(v autofunc.RVector, x linalg.Vector,
+	probs autofunc.RResult) (tp, fn, fp autofunc.RResult) {
+	tp = dotProductR(autofunc.NewRVariable(&autofunc.Variable{Vector: x}, v), probs)
+	negTP := autofunc.ScaleR(tp, -1)
+	fn = autofunc.AddScalerR(negTP, sumVector(x))
+	fp = autofunc.AddR(autofunc.SumAllR(probs), negTP)
+	return
+}
+
+func sumVector(x linalg.Vector) float64 {
+	var sum float64
+	for _, y := range x {
+		sum += y
+	}
+	return sum
+}
+
+// SelfAdjustingDiceLoss implements the self-adjusting
+// Dice loss from Li et al. (2020).
+//
+// The actual vector contains one logit per pixel (or
+// token), and the expected vector contains the binary
+// targets.
+// For each pixel with probability p and target y, the
+// cost is
+//
+//	1 - (2*q*y + 1) / (q + y + 1)
+//
+// where q = (1-p)^Alpha * p.
+// The (1-p)^Alpha factor pushes q toward zero for
+// confident predictions, so easy negatives contribute
+// almost nothing and training focuses on hard pixels.
+//
+// As in the original formulation, q never exceeds 1/4
+// for Alpha = 1, so positive pixels keep a non-zero cost
+// even when predicted correctly.
+type SelfAdjustingDiceLoss struct {
+	Alpha float64
+}
+
+func (s SelfAdjustingDiceLoss) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		logsig := autofunc.LogSigmoid{}
+		logQ := autofunc.Add(logsig.Apply(a),
+			autofunc.Scale(logsig.Apply(autofunc.Scale(a, -1)), s.Alpha))
+		q := autofunc.Exp{}.Apply(logQ)
+		xVar := &autofunc.Variable{Vector: x}
+		num := autofunc.AddScaler(autofunc.Scale(autofunc.Mul(q, xVar), 2), 1)
+		denom := autofunc.AddScaler(autofunc.Add(q, xVar), 1)
+		dice := autofunc.Mul(num, autofunc.Inverse(denom))
+		return autofunc.AddScaler(autofunc.Scale(autofunc.SumAll(dice), -1), float64(len(x)))
+	})
+}
+
+func (s SelfAdjustingDiceLoss) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		logsig := autofunc.LogSigmoid{}
+		logQ := autofunc.AddR(logsig.ApplyR(v, a),
+			autofunc.ScaleR(logsig.ApplyR(v, autofunc.ScaleR(a, -1)), s.Alpha))
+		q := autofunc.Exp{}.ApplyR(v, logQ)
+		xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x}, v)
+		num := autofunc.AddScalerR(autofunc.ScaleR(autofunc.MulR(q, xVar), 2), 1)
+		denom := autofunc.AddScalerR(autofunc.AddR(q, xVar), 1)
+		dice := autofunc.MulR(num, autofunc.InverseR(denom))
+		return autofunc.AddScalerR(autofunc.ScaleR(autofunc.SumAllR(dice), -1),
+			float64(len(x)))
+	})
+}
+
+// FocalTverskyLoss implements the focal Tversky loss
+// from Abraham and Khan (2019) for binary segmentation.
+//
+// The actual vector contains one logit per pixel, and
+// the expected vector contains the binary target mask.
+// The Tversky index is
+//
+//	(TP+Smooth) / (TP + Alpha*FN + Beta*FP + Smooth)
+//
+// where TP, FN, and FP are soft counts computed from the
+// predicted probabilities.
+// The cost is (1-index)^Gamma, which reduces to the
+// plain Tversky loss when Gamma is 1.
+type FocalTverskyLoss struct {
+	Alpha  float64
+	Beta   float64
+	Gamma  float64
+	Smooth float64
+}
+
+func (f FocalTverskyLoss) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	return autofunc.Pool(autofunc.Sigmoid{}.Apply(a), func(probs autofunc.Result) autofunc.Result {
+		tp, fn, fp := confusionCounts(x, probs)
+		index := tverskyIndex(tp, fn, fp, f.Alpha, f.Beta, f.Smooth)
+		loss := autofunc.AddScaler(autofunc.Scale(index, -1), 1)
+		if f.Gamma == 1 {
+			return loss
+		}
+		return autofunc.Exp{}.Apply(autofunc.Scale(autofunc.Log{}.Apply(loss), f.Gamma))
+	})
+}
+
+func (f FocalTverskyLoss) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	probs := autofunc.Sigmoid{}.ApplyR(v, a)
+	return autofunc.PoolR(probs, func(probs autofunc.RResult) autofunc.RResult {
+		tp, fn, fp := confusionCountsR(v, x, probs)
+		index := tverskyIndexR(tp, fn, fp, f.Alpha, f.Beta, f.Smooth)
+		loss := autofunc.AddScalerR(autofunc.ScaleR(index, -1), 1)
+		if f.Gamma == 1 {
+			return loss
+		}
+		return autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(autofunc.Log{}.ApplyR(v, loss), f.Gamma))
+	})
+}
+
+// FocalDiceLoss implements a focal variant of the Dice
+// loss for binary segmentation of small objects.
+//
+// The actual vector contains one logit per pixel, and
+// the expected vector contains the binary target mask.
+// The Dice coefficient is
+//
+//	(2*TP+Smooth) / (2*TP + FN + FP + Smooth)
+//
+// and the cost is (1-Dice)^Gamma.
+// With Gamma < 1, poorly segmented samples are weighted
+// more heavily than with the plain Dice loss, which is
+// obtained when Gamma is 1.
+type FocalDiceLoss struct {
+	Gamma  float64
+	Smooth float64
+}
+
+func (f FocalDiceLoss) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return f.tversky().Cost(x, a)
+}
+
+func (f FocalDiceLoss) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return f.tversky().CostR(v, x, a)
+}
+
+// tversky returns the equivalent FocalTverskyLoss, since
+// the Dice coefficient is the Tversky index with equal
+// weights of 1/2.
+func (f FocalDiceLoss) tversky() FocalTverskyLoss {
+	return FocalTverskyLoss{Alpha: 0.5, Beta: 0.5, Gamma: f.Gamma, Smooth: f.Smooth / 2}
+}
+
+// DiceCost implements the soft Dice (or F1) loss
+//
+//	1 - (2*sum(a*x) + Smooth) / (sum(a) + sum(x) + Smooth)
+//
+// where a is the actual output and x is the desired
+// mask.
+//
+// Unlike FocalDiceLoss, the actual vector is used as is,
+// so it should contain probabilities, e.g. from a
+// sigmoid.
+// Smooth keeps the cost and its gradient finite when
+// both the mask and the prediction are empty, in which
+// case the cost is 0.
+type DiceCost struct {
+	Smooth float64
+}
+
+func (d DiceCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		overlap := dotProduct(&autofunc.Variable{Vector: x}, a)
+		num := autofunc.AddScaler(autofunc.Scale(overlap, 2), d.Smooth)
+		denom := autofunc.AddScaler(autofunc.SumAll(a), sumVector(x)+d.Smooth)
+		dice := autofunc.Mul(num, autofunc.Inverse(denom))
+		return autofunc.AddScaler(autofunc.Scale(dice, -1), 1)
+	})
+}
+
+func (d DiceCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x}, v)
+		overlap := dotProductR(xVar, a)
+		num := autofunc.AddScalerR(autofunc.ScaleR(overlap, 2), d.Smooth)
+		denom := autofunc.AddScalerR(autofunc.SumAllR(a), sumVector(x)+d.Smooth)
+		dice := autofunc.MulR(num, autofunc.InverseR(denom))
+		return autofunc.AddScalerR(autofunc.ScaleR(dice, -1), 1)
+	})
+}
+
+// FBetaSurrogateCost computes 1 - F_beta, where F_beta
+// is computed from soft counts of true positives, false
+// negatives, and false positives:
+//
+//	((1+B^2)*TP + Smooth) / ((1+B^2)*TP + B^2*FN + FP + Smooth)
+//
+// where B is Beta.
+// Like DiceCost, the actual vector should contain
+// probabilities, and the expected vector contains the
+// binary targets.
+//
+// Larger values of Beta weight recall more heavily than
+// precision, and with Beta=1 the cost is equivalent to
+// DiceCost.
+type FBetaSurrogateCost struct {
+	Beta   float64
+	Smooth float64
+}
+
+func (f FBetaSurrogateCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	alpha, beta, smooth := f.tverskyParams()
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		tp, fn, fp := confusionCounts(x, a)
+		index := tverskyIndex(tp, fn, fp, alpha, beta, smooth)
+		return autofunc.AddScaler(autofunc.Scale(index, -1), 1)
+	})
+}
+
+func (f FBetaSurrogateCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(x) != len(a.Output()) {
+		panic("expected and actual sizes must match")
+	}
+	alpha, beta, smooth := f.tverskyParams()
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		tp, fn, fp := confusionCountsR(v, x, a)
+		index := tverskyIndexR(tp, fn, fp, alpha, beta, smooth)
+		return autofunc.AddScalerR(autofunc.ScaleR(index, -1), 1)
+	})
+}
+
+// tverskyParams returns the parameters of the Tversky
+// index which equals F_beta, obtained by dividing the
+// numerator and denominator by 1+Beta^2.
+func (f FBetaSurrogateCost) tverskyParams() (alpha, beta, smooth float64) {
+	scale := 1 + f.Beta*f.Beta
+	return f.Beta * f.Beta / scale, 1 / scale, f.Smooth / scale
+}
@@ -0,0 +1,214 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestBoundaryLossWeighting(t *testing.T) {
+	// A 3x1 image whose middle pixel lies on a boundary.
+	cost := BoundaryLoss{Width: 3, Height: 1, DistanceMap: linalg.Vector{1, 5, 1}}
+	expected := linalg.Vector{0, 1, 1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, -0.5, -0.5}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	boundary, interior := math.Abs(grad[actual][1]), math.Abs(grad[actual][2])
+	if math.Abs(boundary-5*interior) > 1e-8 {
+		t.Errorf("boundary gradient %f should be 5x interior gradient %f", boundary, interior)
+	}
+
+	unweighted := SigmoidCECost{}.Cost(expected, actual).Output()[0]
+	uniform := BoundaryLoss{Width: 3, Height: 1, DistanceMap: linalg.Vector{1, 1, 1}}
+	if c := uniform.Cost(expected, actual).Output()[0]; math.Abs(c-unweighted) > 1e-8 {
+		t.Errorf("uniform weights should give %f but got %f", unweighted, c)
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}
+
+func TestUnifiedFocalLossComponents(t *testing.T) {
+	expected := linalg.Vector{1, 0, 0, 1, 0}
+	logits := linalg.Vector{0.8, -1.2, 0.3, -0.4, -2}
+	delta, gamma := 0.6, 0.5
+
+	var focal float64
+	var tp, fn, fp, tn float64
+	for i, y := range expected {
+		p := 1 / (1 + math.Exp(-logits[i]))
+		if y == 1 {
+			focal -= delta * math.Log(p)
+			tp += p
+			fn += 1 - p
+		} else {
+			focal -= (1 - delta) * math.Pow(p, gamma) * math.Log(1-p)
+			fp += p
+			tn += 1 - p
+		}
+	}
+	focal /= float64(len(expected))
+	posIndex := tp / (tp + delta*fn + (1-delta)*fp)
+	bgIndex := tn / (tn + delta*fp + (1-delta)*fn)
+	tversky := (1 - bgIndex) + math.Pow(1-posIndex, 1-gamma)
+
+	for _, weight := range []float64{0, 0.3, 1} {
+		cost := UnifiedFocalLoss{Weight: weight, Delta: delta, Gamma: gamma}
+		actual := cost.Cost(expected, &autofunc.Variable{Vector: logits}).Output()[0]
+		exp := weight*focal + (1-weight)*tversky
+		if math.Abs(actual-exp) > 1e-5 {
+			t.Errorf("weight %f: expected %f but got %f", weight, exp, actual)
+		}
+	}
+
+	checkCostFuncGradients(t, UnifiedFocalLoss{Weight: 0.5, Delta: delta, Gamma: gamma},
+		expected, logits)
+}
+
+func TestSelfAdjustingDiceLossEasyPixels(t *testing.T) {
+	cost := SelfAdjustingDiceLoss{Alpha: 1}
+	expected := linalg.Vector{0}
+	confident := cost.Cost(expected, &autofunc.Variable{Vector: linalg.Vector{-5}}).Output()[0]
+	uncertain := cost.Cost(expected, &autofunc.Variable{Vector: linalg.Vector{0}}).Output()[0]
+	if confident*10 > uncertain {
+		t.Errorf("confident pixel cost %f should be far below uncertain cost %f",
+			confident, uncertain)
+	}
+
+	// With a larger Alpha, the same moderately confident
+	// pixel contributes less.
+	moderate := &autofunc.Variable{Vector: linalg.Vector{-1}}
+	low := SelfAdjustingDiceLoss{Alpha: 0}.Cost(expected, moderate).Output()[0]
+	high := SelfAdjustingDiceLoss{Alpha: 2}.Cost(expected, moderate).Output()[0]
+	if high >= low {
+		t.Errorf("higher Alpha should lower cost: %f vs %f", high, low)
+	}
+
+	checkCostFuncGradients(t, SelfAdjustingDiceLoss{Alpha: 1.5},
+		linalg.Vector{1, 0, 1, 0}, linalg.Vector{0.5, -0.3, 2, 1})
+}
+
+func TestFocalTverskyLoss(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1, 1, 0}
+	logits := linalg.Vector{1.5, 0.2, -0.3, 0.8, -1}
+
+	var tp, fn, fp float64
+	for i, y := range expected {
+		p := 1 / (1 + math.Exp(-logits[i]))
+		tp += y * p
+		fn += y * (1 - p)
+		fp += (1 - y) * p
+	}
+	tversky := 1 - (tp+1)/(tp+0.7*fn+0.3*fp+1)
+
+	plain := FocalTverskyLoss{Alpha: 0.7, Beta: 0.3, Gamma: 1, Smooth: 1}
+	actual := &autofunc.Variable{Vector: logits}
+	if c := plain.Cost(expected, actual).Output()[0]; math.Abs(c-tversky) > 1e-10 {
+		t.Errorf("expected plain Tversky loss %f but got %f", tversky, c)
+	}
+
+	focal := FocalTverskyLoss{Alpha: 0.7, Beta: 0.3, Gamma: 0.75, Smooth: 1}
+	exp := math.Pow(tversky, 0.75)
+	if c := focal.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected focal Tversky loss %f but got %f", exp, c)
+	}
+
+	checkCostFuncGradients(t, plain, expected, logits)
+	checkCostFuncGradients(t, focal, expected, logits)
+}
+
+func TestFocalDiceLoss(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1, 1, 0}
+	logits := linalg.Vector{1.5, 0.2, -0.3, 0.8, -1}
+
+	var tp, fn, fp float64
+	for i, y := range expected {
+		p := 1 / (1 + math.Exp(-logits[i]))
+		tp += y * p
+		fn += y * (1 - p)
+		fp += (1 - y) * p
+	}
+	dice := 1 - (2*tp+1)/(2*tp+fn+fp+1)
+
+	plain := FocalDiceLoss{Gamma: 1, Smooth: 1}
+	actual := &autofunc.Variable{Vector: logits}
+	if c := plain.Cost(expected, actual).Output()[0]; math.Abs(c-dice) > 1e-10 {
+		t.Errorf("expected plain Dice loss %f but got %f", dice, c)
+	}
+
+	focal := FocalDiceLoss{Gamma: 0.5, Smooth: 1}
+	exp := math.Pow(dice, 0.5)
+	if c := focal.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected focal Dice loss %f but got %f", exp, c)
+	}
+
+	checkCostFuncGradients(t, plain, expected, logits)
+	checkCostFuncGradients(t, focal, expected, logits)
+}
+
+func TestDiceCost(t *testing.T) {
+	cost := DiceCost{Smooth: 1}
+	expected := linalg.Vector{1, 0, 1, 1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.9, 0.2, 0.6, 0.1}}
+	exp := 1 - (2*1.6+1)/(1.8+3+1)
+	if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}
+
+func TestDiceCostEmpty(t *testing.T) {
+	cost := DiceCost{Smooth: 1}
+	expected := linalg.Vector{0, 0, 0}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0, 0, 0}}
+	out := cost.Cost(expected, actual)
+	if c := out.Output()[0]; c != 0 {
+		t.Errorf("expected 0 but got %f", c)
+	}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	for _, x := range grad[actual] {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			t.Fatalf("non-finite gradient %v", grad[actual])
+		}
+	}
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}
+
+func TestFBetaSurrogateCost(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1, 1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.9, 0.2, 0.6, 0.1}}
+
+	dice := DiceCost{Smooth: 1}.Cost(expected, actual).Output()[0]
+	f1 := FBetaSurrogateCost{Beta: 1, Smooth: 1}.Cost(expected, actual).Output()[0]
+	if math.Abs(dice-f1) > 1e-10 {
+		t.Errorf("Beta=1: expected Dice cost %f but got %f", dice, f1)
+	}
+
+	// tp=1.6, fn=1.4, fp=0.2
+	exp := 1 - (5*1.6+1)/(5*1.6+4*1.4+0.2+1)
+	f2 := FBetaSurrogateCost{Beta: 2, Smooth: 1}.Cost(expected, actual).Output()[0]
+	if math.Abs(f2-exp) > 1e-10 {
+		t.Errorf("Beta=2: expected %f but got %f", exp, f2)
+	}
+
+	checkCostFuncGradients(t, FBetaSurrogateCost{Beta: 2, Smooth: 1}, expected, actual.Vector)
+}
+
+func TestFBetaSurrogateCostRecall(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1, 1}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.9, 0.2, 0.6, 0.1}}
+	// recallWeight compares the gradient for raising a
+	// missed positive to the one for lowering a false
+	// positive.
+	recallWeight := func(beta float64) float64 {
+		grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+		cost := FBetaSurrogateCost{Beta: beta, Smooth: 1}.Cost(expected, actual)
+		cost.PropagateGradient(linalg.Vector{1}, grad)
+		return -grad[actual][3] / grad[actual][1]
+	}
+	if low, high := recallWeight(0.5), recallWeight(2); high <= low {
+		t.Errorf("higher Beta should weight recall more: %f vs %f", high, low)
+	}
+}
@@ -0,0 +1,189 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// ConsistencyCost implements consistency regularization
+// for semi-supervised learning, as in the Pi-model and
+// Mean Teacher.
+//
+// The actual vector contains the predictions for two
+// augmented views of the same input, packed one after
+// the other.
+// The cost is Weight times the squared distance between
+// the two predictions.
+// If the expected vector is non-empty, CostFunc's cost of
+// the first prediction is added, so that labeled and
+// unlabeled samples can share one cost function.
+//
+// If DetachTarget is true, the second prediction is
+// treated as a constant target, so that only the first
+// prediction is pulled toward it.
+// This is useful when the second view comes from a
+// teacher model, or to avoid collapsing both views.
+type ConsistencyCost struct {
+	Weight       float64
+	CostFunc     CostFunc
+	DetachTarget bool
+}
+
+func (c ConsistencyCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	n := consistencyViewSize(a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		first := autofunc.Slice(a, 0, n)
+		second := autofunc.Slice(a, n, n*2)
+		var consistency autofunc.Result
+		if c.DetachTarget {
+			consistency = MeanSquaredCost{}.Cost(second.Output(), first)
+		} else {
+			diff := autofunc.Add(first, autofunc.Scale(second, -1))
+			consistency = autofunc.SquaredNorm{}.Apply(diff)
+		}
+		consistency = autofunc.Scale(consistency, c.Weight)
+		if len(x) == 0 {
+			return consistency
+		}
+		return autofunc.Add(c.CostFunc.Cost(x, first), consistency)
+	})
+}
+
+func (c ConsistencyCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n := consistencyViewSize(a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		first := autofunc.SliceR(a, 0, n)
+		second := autofunc.SliceR(a, n, n*2)
+		var consistency autofunc.RResult
+		if c.DetachTarget {
+			consistency = MeanSquaredCost{}.CostR(v, second.Output(), first)
+		} else {
+			diff := autofunc.AddR(first, autofunc.ScaleR(second, -1))
+			consistency = autofunc.SquaredNorm{}.ApplyR(v, diff)
+		}
+		consistency = autofunc.ScaleR(consistency, c.Weight)
+		if len(x) == 0 {
+			return consistency
+		}
+		return autofunc.AddR(c.CostFunc.CostR(v, x, first), consistency)
+	})
+}
+
+func consistencyViewSize(a linalg.Vector) int {
+	if len(a)%2 != 0 {
+		panic("actual vector must contain two predictions")
+	}
+	return len(a) / 2
+}
+
+// PseudoLabelCost implements pseudo-labeling for
+// semi-supervised self-training.
+//
+// The actual vector contains the logits for an unlabeled
+// sample, and the expected vector is ignored.
+// If the largest softmax probability exceeds Threshold,
+// the cost is CostFunc's cost of the logits against a
+// one-hot pseudo-label for the most likely class.
+// Otherwise, the sample is ignored, and the cost and its
+// gradient are zero.
+//
+// The pseudo-label is a constant target, so no gradient
+// flows through the choice of class.
+type PseudoLabelCost struct {
+	Threshold float64
+	CostFunc  CostFunc
+}
+
+func (p PseudoLabelCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	label, ok := p.pseudoLabel(a.Output())
+	if !ok {
+		return &autofunc.Variable{Vector: linalg.Vector{0}}
+	}
+	return p.CostFunc.Cost(label, a)
+}
+
+func (p PseudoLabelCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	label, ok := p.pseudoLabel(a.Output())
+	if !ok {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+	}
+	return p.CostFunc.CostR(v, label, a)
+}
+
+// pseudoLabel returns a one-hot vector for the most
+// likely class, or false if the prediction is not
+// confident enough.
+func (p PseudoLabelCost) pseudoLabel(logits linalg.Vector) (linalg.Vector, bool) {
+	probs := (&autofunc.Softmax{}).Apply(&autofunc.Variable{Vector: logits}).Output()
+	best := maxIndex(probs)
+	if probs[best] <= p.Threshold {
+		return nil, false
+	}
+	label := make(linalg.Vector, len(logits))
+	label[best] = 1
+	return label, true
+}
+
+// FixMatchCost implements the unlabeled loss of FixMatch
+// (Sohn et al., 2020).
+//
+// The actual vector contains the logits for a weakly
+// augmented view of an unlabeled sample followed by the
+// logits for a strongly augmented view of it, and the
+// expected vector is ignored.
+// If the largest softmax probability of the weak view
+// exceeds Threshold, the cost is CostFunc's cost of the
+// strong view's logits against a pseudo-label, which is
+// the softmax of the weak view's logits divided by
+// Temperature.
+// Otherwise, the sample is ignored, and the cost and its
+// gradient are zero.
+//
+// Temperatures below 1 sharpen the pseudo-label, and a
+// Temperature of 0 makes it one-hot.
+// The pseudo-label is a constant target, so no gradient
+// flows into the weak view.
+type FixMatchCost struct {
+	Threshold   float64
+	Temperature float64
+	CostFunc    CostFunc
+}
+
+func (f FixMatchCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	n := consistencyViewSize(a.Output())
+	label, ok := f.pseudoLabel(a.Output()[:n])
+	if !ok {
+		return &autofunc.Variable{Vector: linalg.Vector{0}}
+	}
+	return f.CostFunc.Cost(label, autofunc.Slice(a, n, n*2))
+}
+
+func (f FixMatchCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	n := consistencyViewSize(a.Output())
+	label, ok := f.pseudoLabel(a.Output()[:n])
+	if !ok {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+	}
+	return f.CostFunc.CostR(v, label, autofunc.SliceR(a, n, n*2))
+}
+
+// pseudoLabel returns the sharpened distribution for the
+// weak view, or false if the prediction is not confident
+// enough.
+func (f FixMatchCost) pseudoLabel(logits linalg.Vector) (linalg.Vector, bool) {
+	probs := (&autofunc.Softmax{}).Apply(&autofunc.Variable{Vector: logits}).Output()
+	best := maxIndex(probs)
+	if probs[best] <= f.Threshold {
+		return nil, false
+	}
+	if f.Temperature == 0 {
+		label := make(linalg.Vector, len(logits))
+		label[best] = 1
+		return label, true
+	}
+	softmax := &autofunc.Softmax{Temperature: f.Temperature}
+	return softmax.Apply(&autofunc.Variable{Vector: logits}).Output(), true
+}
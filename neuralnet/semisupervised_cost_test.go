@@ -0,0 +1,89 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestConsistencyCostGradient(t *testing.T) {
+	actual := linalg.Vector{0.3, -0.2, 0.7, 0.1, 0.5, -0.4}
+	cost := ConsistencyCost{Weight: 0.5, CostFunc: MeanSquaredCost{}}
+	checkCostFuncGradients(t, cost, nil, actual)
+	checkCostFuncGradients(t, cost, linalg.Vector{1, 0, -1}, actual)
+}
+
+func TestConsistencyCostConvergence(t *testing.T) {
+	for _, detach := range []bool{false, true} {
+		views := &autofunc.Variable{Vector: linalg.Vector{1, -2, 0.5, 3}}
+		cost := ConsistencyCost{Weight: 1, DetachTarget: detach}
+		for i := 0; i < 100; i++ {
+			grad := autofunc.NewGradient([]*autofunc.Variable{views})
+			cost.Cost(nil, views).PropagateGradient(linalg.Vector{1}, grad)
+			grad.AddToVars(-0.1)
+		}
+		v := views.Vector
+		if math.Abs(v[0]-v[2]) > 1e-3 || math.Abs(v[1]-v[3]) > 1e-3 {
+			t.Errorf("detach %v: predictions did not converge: %v", detach, v)
+		}
+		if detach && (v[2] != 0.5 || v[3] != 3) {
+			t.Errorf("detached target should not move: %v", v)
+		}
+	}
+}
+
+func TestPseudoLabelCost(t *testing.T) {
+	cost := PseudoLabelCost{Threshold: 0.9, CostFunc: softmaxCETestCost{}}
+
+	confident := &autofunc.Variable{Vector: linalg.Vector{0, 4, -1}}
+	exp := softmaxCETestCost{}.Cost(linalg.Vector{0, 1, 0}, confident).Output()[0]
+	if c := cost.Cost(nil, confident).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected cost %f but got %f", exp, c)
+	}
+	checkCostFuncGradients(t, cost, nil, confident.Vector)
+
+	unsure := &autofunc.Variable{Vector: linalg.Vector{0.5, 1, -1}}
+	out := cost.Cost(nil, unsure)
+	grad := autofunc.NewGradient([]*autofunc.Variable{unsure})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	if out.Output()[0] != 0 || grad[unsure].MaxAbs() != 0 {
+		t.Errorf("expected no cost or gradient but got %f and %v", out.Output()[0],
+			grad[unsure])
+	}
+}
+
+func TestFixMatchCost(t *testing.T) {
+	cost := FixMatchCost{Threshold: 0.9, Temperature: 0.5, CostFunc: softmaxCETestCost{}}
+
+	weak := linalg.Vector{0, 4, -1}
+	strong := linalg.Vector{0.5, 1, 0.2}
+	actual := &autofunc.Variable{Vector: append(weak.Copy(), strong...)}
+	label, ok := cost.pseudoLabel(weak)
+	if !ok {
+		t.Fatal("confident prediction was skipped")
+	}
+	probs := (&autofunc.Softmax{}).Apply(&autofunc.Variable{Vector: weak}).Output()
+	if label[1] <= probs[1] {
+		t.Errorf("sharpened label %v is not more concentrated than %v", label, probs)
+	}
+	exp := softmaxCETestCost{}.Cost(label, &autofunc.Variable{Vector: strong}).Output()[0]
+	if c := cost.Cost(nil, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected cost %f but got %f", exp, c)
+	}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.Cost(nil, actual).PropagateGradient(linalg.Vector{1}, grad)
+	if grad[actual][:3].MaxAbs() != 0 {
+		t.Errorf("expected no gradient for weak view but got %v", grad[actual][:3])
+	}
+
+	unsure := &autofunc.Variable{Vector: linalg.Vector{0.5, 1, -1, 0.5, 1, 0.2}}
+	out := cost.Cost(nil, unsure)
+	grad = autofunc.NewGradient([]*autofunc.Variable{unsure})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	if out.Output()[0] != 0 || grad[unsure].MaxAbs() != 0 {
+		t.Errorf("expected no cost or gradient but got %f and %v", out.Output()[0],
+			grad[unsure])
+	}
+}
@@ -0,0 +1,185 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// MineTriplets selects (anchor, positive, negative)
+// index triplets from a batch of labeled embeddings.
+//
+// The strategy must be one of the following:
+// "all" returns every valid triplet; "hard" returns, for
+// each anchor-positive pair, the negative closest to the
+// anchor; and "semi-hard" returns, for each
+// anchor-positive pair, the closest negative which is
+// still farther from the anchor than the positive.
+// Anchor-positive pairs with no semi-hard negative are
+// skipped.
+//
+// Embeddings whose class has no other members have no
+// valid positive, and a batch with a single class has no
+// valid negatives, so neither produces triplets.
+func MineTriplets(embeddings []linalg.Vector, labels []int, strategy string) [][3]int {
+	if len(embeddings) != len(labels) {
+		panic("embedding and label counts must match")
+	}
+	if strategy != "all" && strategy != "hard" && strategy != "semi-hard" {
+		panic("unknown mining strategy: " + strategy)
+	}
+
+	dists := make([][]float64, len(embeddings))
+	for i, emb1 := range embeddings {
+		dists[i] = make([]float64, len(embeddings))
+		for j, emb2 := range embeddings {
+			diff := emb1.Copy().Scale(-1).Add(emb2)
+			dists[i][j] = diff.Dot(diff)
+		}
+	}
+
+	var res [][3]int
+	for anchor, anchorLabel := range labels {
+		for pos, posLabel := range labels {
+			if pos == anchor || posLabel != anchorLabel {
+				continue
+			}
+			bestNeg := -1
+			bestDist := math.Inf(1)
+			for neg, negLabel := range labels {
+				if negLabel == anchorLabel {
+					continue
+				}
+				negDist := dists[anchor][neg]
+				switch strategy {
+				case "all":
+					res = append(res, [3]int{anchor, pos, neg})
+				case "semi-hard":
+					if negDist <= dists[anchor][pos] {
+						continue
+					}
+					fallthrough
+				case "hard":
+					if negDist < bestDist {
+						bestDist = negDist
+						bestNeg = neg
+					}
+				}
+			}
+			if bestNeg >= 0 {
+				res = append(res, [3]int{anchor, pos, bestNeg})
+			}
+		}
+	}
+	return res
+}
+
+const (
+	// distanceWeightedMinDist is the smallest distance used
+	// to compute sampling weights, which keeps the weights
+	// of very close negatives from blowing up.
+	distanceWeightedMinDist = 0.5
+
+	// distanceWeightedMaxDist is the distance beyond which
+	// negatives are never sampled, since they are too far
+	// away to produce a non-zero triplet loss.
+	distanceWeightedMaxDist = 1.4
+)
+
+// DistanceWeightedSampler selects (anchor, positive,
+// negative) index triplets using the distance weighted
+// sampling of Wu et al. (2017).
+//
+// The embeddings should have unit magnitude.
+// For embeddings of dimension n, pairwise distances on
+// the unit sphere are distributed with density
+//
+//	q(d) ~ d^(n-2) * (1 - d^2/4)^((n-3)/2)
+//
+// and each negative is sampled with probability
+// proportional to 1/q(d), so that negatives at every
+// distance are equally likely to be chosen.
+// Distances below 0.5 are treated as 0.5, preventing
+// collapsed embeddings from receiving huge weights, and
+// negatives farther than 1.4 from the anchor are never
+// chosen.
+// If every negative is that far away, one is chosen
+// uniformly at random.
+type DistanceWeightedSampler struct{}
+
+// Sample chooses one negative for every anchor-positive
+// pair in a batch of labeled embeddings.
+// Pairs whose anchor has no negatives are skipped.
+func (d DistanceWeightedSampler) Sample(embeddings []linalg.Vector, labels []int) [][3]int {
+	if len(embeddings) != len(labels) {
+		panic("embedding and label counts must match")
+	}
+	var res [][3]int
+	for anchor, anchorLabel := range labels {
+		var negs []int
+		var dists []float64
+		for neg, negLabel := range labels {
+			if negLabel != anchorLabel {
+				diff := embeddings[anchor].Copy().Scale(-1).Add(embeddings[neg])
+				negs = append(negs, neg)
+				dists = append(dists, diff.Mag())
+			}
+		}
+		if len(negs) == 0 {
+			continue
+		}
+		probs := d.probabilities(dists, len(embeddings[anchor]))
+		for pos, posLabel := range labels {
+			if pos == anchor || posLabel != anchorLabel {
+				continue
+			}
+			res = append(res, [3]int{anchor, pos, negs[sampleIndex(probs)]})
+		}
+	}
+	return res
+}
+
+// probabilities computes the sampling distribution for
+// negatives at the given distances from an anchor.
+// The weights are computed in log space and shifted by
+// their maximum before exponentiating.
+func (d DistanceWeightedSampler) probabilities(dists []float64, dim int) []float64 {
+	n := float64(dim)
+	logWeights := make([]float64, len(dists))
+	maxLog := math.Inf(-1)
+	for i, dist := range dists {
+		if dist > distanceWeightedMaxDist {
+			logWeights[i] = math.Inf(-1)
+			continue
+		}
+		dist = math.Max(dist, distanceWeightedMinDist)
+		logWeights[i] = -(n-2)*math.Log(dist) - (n-3)/2*math.Log(1-dist*dist/4)
+		maxLog = math.Max(maxLog, logWeights[i])
+	}
+	probs := make([]float64, len(dists))
+	var sum float64
+	for i, logWeight := range logWeights {
+		if math.IsInf(maxLog, -1) {
+			probs[i] = 1
+		} else {
+			probs[i] = math.Exp(logWeight - maxLog)
+		}
+		sum += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	return probs
+}
+
+func sampleIndex(probs []float64) int {
+	x := rand.Float64()
+	for i, p := range probs {
+		x -= p
+		if x < 0 {
+			return i
+		}
+	}
+	return len(probs) - 1
+}
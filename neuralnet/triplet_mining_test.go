@@ -0,0 +1,111 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestMineTripletsHard(t *testing.T) {
+	embeddings := []linalg.Vector{{0}, {1}, {3}, {1.5}, {10}}
+	labels := []int{0, 0, 1, 1, 2}
+	actual := MineTriplets(embeddings, labels, "hard")
+	expected := [][3]int{{0, 1, 3}, {1, 0, 3}, {2, 3, 1}, {3, 2, 1}}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+	for i, x := range expected {
+		if actual[i] != x {
+			t.Errorf("triplet %d: expected %v but got %v", i, x, actual[i])
+		}
+	}
+}
+
+func TestMineTripletsSemiHard(t *testing.T) {
+	embeddings := []linalg.Vector{{0}, {2}, {1}, {3}}
+	labels := []int{0, 0, 1, 1}
+	actual := MineTriplets(embeddings, labels, "semi-hard")
+	expected := [][3]int{{0, 1, 3}, {3, 2, 0}}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+	for i, x := range expected {
+		if actual[i] != x {
+			t.Errorf("triplet %d: expected %v but got %v", i, x, actual[i])
+		}
+	}
+}
+
+func TestMineTripletsEdgeCases(t *testing.T) {
+	embeddings := []linalg.Vector{{0}, {1}, {2}}
+	if res := MineTriplets(embeddings, []int{0, 1, 2}, "all"); len(res) != 0 {
+		t.Errorf("singleton classes should give no triplets, got %v", res)
+	}
+	if res := MineTriplets(embeddings, []int{0, 0, 0}, "hard"); len(res) != 0 {
+		t.Errorf("a single class should give no triplets, got %v", res)
+	}
+	if res := MineTriplets(embeddings, []int{0, 0, 1}, "all"); len(res) != 2 {
+		t.Errorf("expected 2 triplets but got %v", res)
+	}
+}
+
+func TestDistanceWeightedSamplerProbabilities(t *testing.T) {
+	dists := []float64{0.1, 0.5, 0.9, 1.3, 1.8}
+	probs := DistanceWeightedSampler{}.probabilities(dists, 8)
+	weight := func(d float64) float64 {
+		return 1 / (math.Pow(d, 6) * math.Pow(1-d*d/4, 2.5))
+	}
+	weights := []float64{weight(0.5), weight(0.5), weight(0.9), weight(1.3), 0}
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	for i, w := range weights {
+		if math.Abs(probs[i]-w/sum) > 1e-10 {
+			t.Errorf("distance %f: expected probability %f but got %f", dists[i], w/sum,
+				probs[i])
+		}
+	}
+
+	probs = DistanceWeightedSampler{}.probabilities([]float64{1.5, 1.9}, 8)
+	if probs[0] != 0.5 || probs[1] != 0.5 {
+		t.Errorf("expected uniform fallback but got %v", probs)
+	}
+}
+
+func TestDistanceWeightedSamplerSample(t *testing.T) {
+	embeddings := []linalg.Vector{
+		{1, 0},
+		{1, 0},
+		{math.Cos(0.9), math.Sin(0.9)},
+		{math.Cos(1.2), math.Sin(1.2)},
+		{-1, 0},
+	}
+	labels := []int{0, 0, 1, 1, 2}
+
+	dists := make([]float64, 3)
+	for i, neg := range embeddings[2:] {
+		dists[i] = neg.Copy().Scale(-1).Add(embeddings[0]).Mag()
+	}
+	probs := DistanceWeightedSampler{}.probabilities(dists, 2)
+
+	const trials = 20000
+	counts := make([]int, 3)
+	for i := 0; i < trials; i++ {
+		triplets := DistanceWeightedSampler{}.Sample(embeddings, labels)
+		if triplets[0][0] != 0 || triplets[0][1] != 1 {
+			t.Fatalf("unexpected first triplet %v", triplets[0])
+		}
+		counts[triplets[0][2]-2]++
+	}
+	for i, p := range probs {
+		freq := float64(counts[i]) / trials
+		if math.Abs(freq-p) > 0.02 {
+			t.Errorf("negative %d: expected frequency %f but got %f", i+2, p, freq)
+		}
+	}
+	if counts[2] != 0 {
+		t.Errorf("negative beyond the cutoff was sampled %d times", counts[2])
+	}
+}
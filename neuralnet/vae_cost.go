@@ -0,0 +1,145 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// KLAnnealedCost is the training objective of a
+// variational autoencoder with an annealed KL weight.
+//
+// For an expected vector of length n, the actual vector
+// contains the n reconstructed outputs, followed by d
+// posterior means and d posterior log-variances for a
+// d-dimensional latent space.
+//
+// The cost is ReconCost applied to the reconstruction
+// plus Beta times the KL divergence between the diagonal
+// Gaussian posterior and a standard normal prior.
+// A Beta of 0 gives a pure reconstruction cost.
+//
+// If BetaSchedule is non-nil, Step updates Beta to
+// BetaSchedule(step) for the next training step.
+type KLAnnealedCost struct {
+	ReconCost    CostFunc
+	Beta         float64
+	BetaSchedule func(step int) float64
+
+	step int
+}
+
+// Step advances the training step and, if there is a
+// BetaSchedule, updates Beta accordingly.
+func (k *KLAnnealedCost) Step() {
+	k.step++
+	if k.BetaSchedule != nil {
+		k.Beta = k.BetaSchedule(k.step)
+	}
+}
+
+func (k *KLAnnealedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	latentSize := vaeLatentSize(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		n := len(x)
+		recon := k.ReconCost.Cost(x, autofunc.Slice(a, 0, n))
+		if k.Beta == 0 {
+			return recon
+		}
+		kl := standardNormalKL(autofunc.Slice(a, n, n+latentSize),
+			autofunc.Slice(a, n+latentSize, n+latentSize*2))
+		return autofunc.Add(recon, autofunc.Scale(autofunc.SumAll(kl), k.Beta))
+	})
+}
+
+func (k *KLAnnealedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	latentSize := vaeLatentSize(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		n := len(x)
+		recon := k.ReconCost.CostR(v, x, autofunc.SliceR(a, 0, n))
+		if k.Beta == 0 {
+			return recon
+		}
+		kl := standardNormalKLR(v, autofunc.SliceR(a, n, n+latentSize),
+			autofunc.SliceR(a, n+latentSize, n+latentSize*2))
+		return autofunc.AddR(recon, autofunc.ScaleR(autofunc.SumAllR(kl), k.Beta))
+	})
+}
+
+func vaeLatentSize(x, a linalg.Vector) int {
+	if len(a) < len(x) || (len(a)-len(x))%2 != 0 {
+		panic("actual vector must contain a reconstruction, means, and log-variances")
+	}
+	return (len(a) - len(x)) / 2
+}
+
+// standardNormalKL computes, for each latent dimension,
+// the KL divergence between N(mean, exp(logVar)) and
+// N(0, 1).
+func standardNormalKL(mean, logVar autofunc.Result) autofunc.Result {
+	terms := autofunc.Add(autofunc.Exp{}.Apply(logVar),
+		autofunc.Add(autofunc.Square(mean), autofunc.Scale(logVar, -1)))
+	return autofunc.Scale(autofunc.AddScaler(terms, -1), 0.5)
+}
+
+func standardNormalKLR(v autofunc.RVector, mean, logVar autofunc.RResult) autofunc.RResult {
+	terms := autofunc.AddR(autofunc.Exp{}.ApplyR(v, logVar),
+		autofunc.AddR(autofunc.SquareR(mean), autofunc.ScaleR(logVar, -1)))
+	return autofunc.ScaleR(autofunc.AddScalerR(terms, -1), 0.5)
+}
+
+// FreeBitsKLCost computes the KL divergence between a
+// diagonal Gaussian posterior and a standard normal
+// prior, using the free bits technique from Kingma et al.
+// (2016) to prevent posterior collapse.
+//
+// The actual vector contains d posterior means followed
+// by d posterior log-variances.
+// The expected vector is ignored.
+//
+// Each latent dimension contributes the larger of its KL
+// divergence and FreeBits (in nats).
+// Dimensions below the floor contribute the constant
+// FreeBits and receive no gradient, so the model gains
+// nothing by pushing them further toward the prior.
+type FreeBitsKLCost struct {
+	FreeBits float64
+}
+
+func (f FreeBitsKLCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	latentSize := vaeLatentSize(nil, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		kl := standardNormalKL(autofunc.Slice(a, 0, latentSize),
+			autofunc.Slice(a, latentSize, latentSize*2))
+		mask, floor := f.floorMask(kl.Output())
+		return autofunc.AddScaler(autofunc.SumAll(autofunc.Mul(
+			&autofunc.Variable{Vector: mask}, kl)), floor)
+	})
+}
+
+func (f FreeBitsKLCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	latentSize := vaeLatentSize(nil, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		kl := standardNormalKLR(v, autofunc.SliceR(a, 0, latentSize),
+			autofunc.SliceR(a, latentSize, latentSize*2))
+		mask, floor := f.floorMask(kl.Output())
+		maskVar := autofunc.NewRVariable(&autofunc.Variable{Vector: mask}, v)
+		return autofunc.AddScalerR(autofunc.SumAllR(autofunc.MulR(maskVar, kl)), floor)
+	})
+}
+
+// floorMask returns a mask selecting the dimensions
+// above the free bits threshold, and the total floor
+// contributed by the remaining dimensions.
+func (f FreeBitsKLCost) floorMask(kl linalg.Vector) (mask linalg.Vector, floor float64) {
+	mask = make(linalg.Vector, len(kl))
+	for i, x := range kl {
+		if x > f.FreeBits {
+			mask[i] = 1
+		} else {
+			floor += f.FreeBits
+		}
+	}
+	return
+}
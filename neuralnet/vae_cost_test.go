@@ -0,0 +1,56 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestKLAnnealedCost(t *testing.T) {
+	cost := &KLAnnealedCost{
+		ReconCost: MeanSquaredCost{},
+		BetaSchedule: func(step int) float64 {
+			return math.Min(1, float64(step)/2)
+		},
+	}
+	expected := linalg.Vector{1, 2}
+	actual := &autofunc.Variable{Vector: linalg.Vector{1.5, 2, 0.5, -1, 0.2, -0.4}}
+
+	recon := 0.25
+	kl := 0.5 * (math.Exp(0.2) + 0.25 - 1 - 0.2 + math.Exp(-0.4) + 1 - 1 + 0.4)
+	for step := 0; step < 4; step++ {
+		beta := math.Min(1, float64(step)/2)
+		exp := recon + beta*kl
+		if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+			t.Errorf("step %d: expected %f but got %f", step, exp, c)
+		}
+		cost.Step()
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}
+
+func TestFreeBitsKLCost(t *testing.T) {
+	cost := FreeBitsKLCost{FreeBits: 0.1}
+
+	// The first dimension is almost at the prior, while the
+	// second has a KL of 0.5*(1+4-1-0) = 2.
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.01, 2, 0, 0}}
+	out := cost.Cost(nil, actual)
+	if exp := 0.1 + 2; math.Abs(out.Output()[0]-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, out.Output()[0])
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	if grad[actual][0] != 0 || grad[actual][2] != 0 {
+		t.Errorf("dimension below the floor got gradient %v", grad[actual])
+	}
+	if math.Abs(grad[actual][1]-2) > 1e-10 {
+		t.Errorf("dimension above the floor should get gradient 2, got %f", grad[actual][1])
+	}
+
+	checkCostFuncGradients(t, cost, nil, linalg.Vector{0.5, -1, 0.3, 0.2})
+}
@@ -0,0 +1,331 @@
+package neuralnet
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// AttentionWeightedCost applies CostFunc to each output
+// component separately and combines the per-output costs
+// with trainable weights.
+//
+// The weights are the softmax of WeightVar, which must
+// have one entry per output, so they always sum to 1.
+// WeightVar receives gradients like any other parameter,
+// allowing a trainer to learn which outputs to emphasize.
+type AttentionWeightedCost struct {
+	WeightVar *autofunc.Variable
+	CostFunc  CostFunc
+}
+
+func (w *AttentionWeightedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	w.checkSize(x)
+	weights := (&autofunc.Softmax{}).Apply(w.WeightVar)
+	return dotProduct(weights, elementCosts(w.CostFunc, x, a))
+}
+
+func (w *AttentionWeightedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	w.checkSize(x)
+	weights := (&autofunc.Softmax{}).ApplyR(v, autofunc.NewRVariable(w.WeightVar, v))
+	return dotProductR(weights, elementCostsR(v, w.CostFunc, x, a))
+}
+
+func (w *AttentionWeightedCost) checkSize(x linalg.Vector) {
+	if len(w.WeightVar.Vector) != len(x) {
+		panic("weight count must match expected size")
+	}
+}
+
+// elementCosts applies a cost function to each component
+// of the actual vector and concatenates the results.
+func elementCosts(c CostFunc, x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		costs := make([]autofunc.Result, len(x))
+		for i := range x {
+			costs[i] = c.Cost(x[i:i+1], autofunc.Slice(a, i, i+1))
+		}
+		return autofunc.Concat(costs...)
+	})
+}
+
+func elementCostsR(v autofunc.RVector, c CostFunc, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		costs := make([]autofunc.RResult, len(x))
+		for i := range x {
+			costs[i] = c.CostR(v, x[i:i+1], autofunc.SliceR(a, i, i+1))
+		}
+		return autofunc.ConcatR(costs...)
+	})
+}
+
+// BatchBalancedCECost computes a class-weighted softmax
+// cross entropy over a batch of samples, where the class
+// weights are derived from the batch's own labels.
+//
+// The expected vector contains concatenated one-hot (or
+// soft) targets, and the actual vector contains the
+// corresponding concatenated logits, with NumClasses
+// entries per sample.
+// This matches the layout which TotalCostBatcher passes
+// to the cost, so TotalCostBatcher weights each of its
+// batches on its own.
+// TotalCost, TotalCostMatrix, and MeanCostBatcher
+// evaluate one sample at a time, so every class present
+// gets a weight of 1 and the cost reduces to a plain
+// softmax cross entropy.
+//
+// Each class c which appears in the batch is weighted by
+// n/(k*count_c), where n is the number of samples, k is
+// the number of classes present, and count_c is the
+// total target mass of class c.
+// Rare classes are thus weighted up and common classes
+// are weighted down, adapting to the class balance of
+// every batch.
+type BatchBalancedCECost struct {
+	NumClasses int
+}
+
+func (b BatchBalancedCECost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	weighted := b.weightedTargets(x, a.Output())
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		n := len(x) / b.NumClasses
+		logits := autofunc.Split(n, a)
+		logProbs := make([]autofunc.Result, n)
+		for i, l := range logits {
+			logProbs[i] = (&LogSoftmaxLayer{}).Apply(l)
+		}
+		return DotCost{}.Cost(weighted, autofunc.Concat(logProbs...))
+	})
+}
+
+func (b BatchBalancedCECost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	weighted := b.weightedTargets(x, a.Output())
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		n := len(x) / b.NumClasses
+		logits := autofunc.SplitR(n, a)
+		logProbs := make([]autofunc.RResult, n)
+		for i, l := range logits {
+			logProbs[i] = (&LogSoftmaxLayer{}).ApplyR(v, l)
+		}
+		return DotCost{}.CostR(v, weighted, autofunc.ConcatR(logProbs...))
+	})
+}
+
+// weightedTargets scales each target component by the
+// batch weight of its class.
+func (b BatchBalancedCECost) weightedTargets(x, a linalg.Vector) linalg.Vector {
+	if b.NumClasses <= 0 || len(x)%b.NumClasses != 0 || len(a) != len(x) {
+		panic("vector sizes must be multiples of NumClasses")
+	}
+	counts := make([]float64, b.NumClasses)
+	for i, target := range x {
+		counts[i%b.NumClasses] += target
+	}
+	var present int
+	for _, count := range counts {
+		if count > 0 {
+			present++
+		}
+	}
+	n := float64(len(x) / b.NumClasses)
+	res := make(linalg.Vector, len(x))
+	for i, target := range x {
+		if count := counts[i%b.NumClasses]; count > 0 {
+			res[i] = target * n / (float64(present) * count)
+		}
+	}
+	return res
+}
+
+// MaskedMeanSquaredCost computes the mean squared error
+// over the components for which Mask is non-zero.
+//
+// Each squared difference is multiplied by the
+// corresponding entry of Mask (which is typically 0 or
+// 1), and the sum is divided by the number of non-zero
+// mask entries rather than by the full length.
+// If every mask entry is zero, the cost is zero.
+type MaskedMeanSquaredCost struct {
+	Mask linalg.Vector
+}
+
+func (m MaskedMeanSquaredCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	count := m.validCount(x)
+	if count == 0 {
+		return &autofunc.Variable{Vector: linalg.Vector{0}}
+	}
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	diff := autofunc.Add(xVar, a)
+	maskVar := &autofunc.Variable{Vector: m.Mask}
+	sum := autofunc.SumAll(autofunc.Mul(maskVar, autofunc.Square(diff)))
+	return autofunc.Scale(sum, 1/float64(count))
+}
+
+func (m MaskedMeanSquaredCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	count := m.validCount(x)
+	if count == 0 {
+		return autofunc.NewRVariable(&autofunc.Variable{Vector: linalg.Vector{0}}, v)
+	}
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	diff := autofunc.AddR(xVar, a)
+	maskVar := autofunc.NewRVariable(&autofunc.Variable{Vector: m.Mask}, v)
+	sum := autofunc.SumAllR(autofunc.MulR(maskVar, autofunc.SquareR(diff)))
+	return autofunc.ScaleR(sum, 1/float64(count))
+}
+
+func (m MaskedMeanSquaredCost) validCount(x linalg.Vector) int {
+	if len(m.Mask) != len(x) {
+		panic("mask size must match expected size")
+	}
+	var count int
+	for _, y := range m.Mask {
+		if y != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// WeightedMeanSquaredCost is like MeanSquaredCost, but
+// each squared difference is multiplied by the
+// corresponding entry of Weights before summing.
+//
+// If Weights is empty, this is equivalent to
+// MeanSquaredCost.
+// Otherwise, Weights must be the same length as the
+// expected vector, or Cost and CostR will panic.
+type WeightedMeanSquaredCost struct {
+	Weights linalg.Vector
+}
+
+func (w WeightedMeanSquaredCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(w.Weights) == 0 {
+		return MeanSquaredCost{}.Cost(x, a)
+	}
+	w.checkSize(x)
+	xVar := &autofunc.Variable{Vector: x.Copy().Scale(-1)}
+	diff := autofunc.Add(xVar, a)
+	weightVar := &autofunc.Variable{Vector: w.Weights}
+	return autofunc.SumAll(autofunc.Mul(weightVar, autofunc.Square(diff)))
+}
+
+func (w WeightedMeanSquaredCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(w.Weights) == 0 {
+		return MeanSquaredCost{}.CostR(v, x, a)
+	}
+	w.checkSize(x)
+	xVar := autofunc.NewRVariable(&autofunc.Variable{Vector: x.Copy().Scale(-1)}, v)
+	diff := autofunc.AddR(xVar, a)
+	weightVar := autofunc.NewRVariable(&autofunc.Variable{Vector: w.Weights}, v)
+	return autofunc.SumAllR(autofunc.MulR(weightVar, autofunc.SquareR(diff)))
+}
+
+func (w WeightedMeanSquaredCost) checkSize(x linalg.Vector) {
+	if len(w.Weights) != len(x) {
+		panic("weight count must match expected size")
+	}
+}
+
+// WeightedCrossEntropyCost is like CrossEntropyCost, but
+// the cross entropy of each class is multiplied by the
+// corresponding entry of ClassWeights, e.g. to up-weight
+// rare classes.
+//
+// If ClassWeights is empty, this is equivalent to
+// CrossEntropyCost.
+// Otherwise, ClassWeights must be the same length as the
+// expected vector, or Cost and CostR will panic.
+//
+// Epsilon clips the actual values exactly as it does for
+// CrossEntropyCost.
+type WeightedCrossEntropyCost struct {
+	ClassWeights linalg.Vector
+	Epsilon      float64
+}
+
+func (w WeightedCrossEntropyCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	if len(w.ClassWeights) == 0 {
+		return CrossEntropyCost{Epsilon: w.Epsilon}.Cost(x, a)
+	}
+	w.checkSize(x)
+	if w.Epsilon != 0 {
+		a = clamp(a, w.Epsilon, 1-w.Epsilon)
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		weightVar := &autofunc.Variable{Vector: w.ClassWeights}
+		weighted := autofunc.Mul(weightVar, crossEntropyTerms(x, a))
+		return autofunc.Scale(autofunc.SumAll(weighted), -1)
+	})
+}
+
+func (w WeightedCrossEntropyCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	if len(w.ClassWeights) == 0 {
+		return CrossEntropyCost{Epsilon: w.Epsilon}.CostR(v, x, a)
+	}
+	w.checkSize(x)
+	if w.Epsilon != 0 {
+		a = clampR(v, a, w.Epsilon, 1-w.Epsilon)
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		weightVar := autofunc.NewRVariable(&autofunc.Variable{Vector: w.ClassWeights}, v)
+		weighted := autofunc.MulR(weightVar, crossEntropyTermsR(v, x, a))
+		return autofunc.ScaleR(autofunc.SumAllR(weighted), -1)
+	})
+}
+
+func (w WeightedCrossEntropyCost) checkSize(x linalg.Vector) {
+	if len(w.ClassWeights) != len(x) {
+		panic("class weight count must match expected size")
+	}
+}
+
+// MaskedCost ignores some output components, such as
+// the padding of variable-length sequences.
+//
+// Mask contains a 1 for every valid component and a 0
+// for every masked one.
+// Both the expected and actual vectors are multiplied by
+// Mask before being passed to CostFunc, so masked actual
+// components receive no gradient.
+//
+// Masked components compare 0 against 0, so they only
+// contribute nothing for costs which are 0 when the
+// expected and actual components match, such as
+// MeanSquaredCost, AbsCost, or DotCost.
+type MaskedCost struct {
+	CostFunc CostFunc
+	Mask     linalg.Vector
+}
+
+func (m MaskedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	m.checkSize(x, a.Output())
+	maskVar := &autofunc.Variable{Vector: m.Mask}
+	maskedX := x.Copy()
+	for i, mask := range m.Mask {
+		maskedX[i] *= mask
+	}
+	return m.CostFunc.Cost(maskedX, autofunc.Mul(maskVar, a))
+}
+
+func (m MaskedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	m.checkSize(x, a.Output())
+	maskVar := autofunc.NewRVariable(&autofunc.Variable{Vector: m.Mask}, v)
+	maskedX := x.Copy()
+	for i, mask := range m.Mask {
+		maskedX[i] *= mask
+	}
+	return m.CostFunc.CostR(v, maskedX, autofunc.MulR(maskVar, a))
+}
+
+func (m MaskedCost) checkSize(x, a linalg.Vector) {
+	if len(m.Mask) != len(x) || len(m.Mask) != len(a) {
+		panic("mask size must match expected and actual sizes")
+	}
+}
@@ -0,0 +1,209 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestAttentionWeightedCostGradient(t *testing.T) {
+	weights := &autofunc.Variable{Vector: linalg.RandVector(3)}
+	actual := &autofunc.Variable{Vector: linalg.RandVector(3)}
+	cost := &AttentionWeightedCost{WeightVar: weights, CostFunc: MeanSquaredCost{}}
+	funcTest := &functest.RFuncChecker{
+		F:     costFuncTestFunc{Cost: cost, Expected: linalg.RandVector(3)},
+		Vars:  []*autofunc.Variable{weights, actual},
+		Input: actual,
+		RV: autofunc.RVector{
+			weights: linalg.RandVector(3),
+			actual:  linalg.RandVector(3),
+		},
+	}
+	funcTest.FullCheck(t)
+}
+
+func TestAttentionWeightedCostEmphasis(t *testing.T) {
+	weights := &autofunc.Variable{Vector: linalg.Vector{0, 0, 0}}
+	cost := &AttentionWeightedCost{WeightVar: weights, CostFunc: MeanSquaredCost{}}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.1, 2, 0.5}}
+	grad := autofunc.NewGradient([]*autofunc.Variable{weights})
+	cost.Cost(linalg.Vector{0, 0, 0}, actual).PropagateGradient(linalg.Vector{1}, grad)
+	g := grad[weights]
+	if !(g[1] > g[2] && g[2] > g[0]) {
+		t.Errorf("gradient should be ordered by error but got %v", g)
+	}
+	if g[1] <= 0 {
+		t.Errorf("highest-error output should have positive gradient but got %v", g)
+	}
+}
+
+func TestBatchBalancedCECostWeights(t *testing.T) {
+	cost := BatchBalancedCECost{NumClasses: 2}
+	expected := linalg.Vector{1, 0, 1, 0, 1, 0, 0, 1}
+	weighted := cost.weightedTargets(expected, expected)
+
+	// Three samples of class 0 and one of class 1 give
+	// weights of 4/(2*3) and 4/(2*1).
+	if math.Abs(weighted[0]-2.0/3) > 1e-8 || math.Abs(weighted[7]-2) > 1e-8 {
+		t.Errorf("unexpected weights: %v", weighted)
+	}
+
+	// With uniform logits, every sample has the same
+	// unweighted gradient magnitude, so the rare class
+	// should receive a larger one.
+	actual := &autofunc.Variable{Vector: make(linalg.Vector, len(expected))}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	if common, rare := math.Abs(grad[actual][0]), math.Abs(grad[actual][7]); rare <= common {
+		t.Errorf("rare class gradient %f should exceed common class gradient %f", rare, common)
+	}
+}
+
+func TestBatchBalancedCECostGradient(t *testing.T) {
+	checkCostFuncGradients(t, BatchBalancedCECost{NumClasses: 3},
+		linalg.Vector{1, 0, 0, 0, 0, 1, 1, 0, 0}, linalg.RandVector(9))
+}
+
+func TestBatchBalancedCECostBatcher(t *testing.T) {
+	net := Network{NewDenseLayer(2, 2)}
+	samples := sgd.SliceSampleSet{
+		VectorSample{Input: []float64{1, -1}, Output: []float64{1, 0}},
+		VectorSample{Input: []float64{1, 1}, Output: []float64{1, 0}},
+		VectorSample{Input: []float64{-1, 0.5}, Output: []float64{1, 0}},
+		VectorSample{Input: []float64{0.5, 2}, Output: []float64{0, 1}},
+	}
+	var input, expected linalg.Vector
+	for _, s := range samples {
+		input = append(input, s.(VectorSample).Input...)
+		expected = append(expected, s.(VectorSample).Output...)
+	}
+	cost := BatchBalancedCECost{NumClasses: 2}
+	logits := net.BatchLearner().Batch(&autofunc.Variable{Vector: input}, len(samples))
+	direct := cost.Cost(expected, logits).Output()[0]
+	actual := TotalCostBatcher(cost, net.BatchLearner(), samples, 0)
+	if math.Abs(actual-direct) > 1e-8 {
+		t.Errorf("expected whole-batch cost %f but got %f", direct, actual)
+	}
+}
+
+func TestMaskedMeanSquaredCost(t *testing.T) {
+	cost := MaskedMeanSquaredCost{Mask: linalg.Vector{1, 0, 1, 0}}
+	expected := linalg.Vector{1, 2, 3, 4}
+	actual := &autofunc.Variable{Vector: linalg.Vector{2, 10, 1, -3}}
+	if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-2.5) > 1e-10 {
+		t.Errorf("expected (1+4)/2 = 2.5 but got %f", c)
+	}
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+
+	empty := MaskedMeanSquaredCost{Mask: make(linalg.Vector, 4)}
+	out := empty.Cost(expected, actual)
+	if out.Output()[0] != 0 {
+		t.Errorf("empty mask should give zero cost but got %f", out.Output()[0])
+	}
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	for i, g := range grad[actual] {
+		if g != 0 {
+			t.Errorf("empty mask gave gradient %f at %d", g, i)
+		}
+	}
+}
+
+func TestWeightedMeanSquaredCost(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5}
+	actual := &autofunc.Variable{Vector: linalg.Vector{2, 0, 0.5}}
+
+	cost := WeightedMeanSquaredCost{Weights: linalg.Vector{3, 0.5, 2}}
+	if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-5) > 1e-10 {
+		t.Errorf("expected 5 but got %f", c)
+	}
+
+	mse := MeanSquaredCost{}.Cost(expected, actual).Output()[0]
+	if c := (WeightedMeanSquaredCost{}).Cost(expected, actual).Output()[0]; c != mse {
+		t.Errorf("empty weights: expected %f but got %f", mse, c)
+	}
+
+	checkCostFuncGradients(t, cost, expected, linalg.Vector{2, 0.3, -0.7})
+}
+
+func TestWeightedCrossEntropyCost(t *testing.T) {
+	expected := linalg.Vector{0, 1, 0, 0.3}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.2, 0.6, 0.1, 0.45}}
+
+	ce := CrossEntropyCost{}.Cost(expected, actual).Output()[0]
+	ones := WeightedCrossEntropyCost{ClassWeights: linalg.Vector{1, 1, 1, 1}}
+	if c := ones.Cost(expected, actual).Output()[0]; c != ce {
+		t.Errorf("uniform weights: expected %f but got %f", ce, c)
+	}
+
+	weights := linalg.Vector{1, 5, 0.5, 2}
+	var exp float64
+	for i, x := range expected {
+		a := actual.Vector[i]
+		exp -= weights[i] * (x*math.Log(a) + (1-x)*math.Log(1-a))
+	}
+	cost := WeightedCrossEntropyCost{ClassWeights: weights}
+	if c := cost.Cost(expected, actual).Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}
+
+func TestWeightedCrossEntropyCostEpsilon(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1, 0}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0, 1, 1, 0.3}}
+	weights := linalg.Vector{2, 1, 0.5, 3}
+	cost := WeightedCrossEntropyCost{ClassWeights: weights, Epsilon: 1e-6}
+
+	out := cost.Cost(expected, actual)
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	exp := -2*math.Log(1e-6) - math.Log(1e-6) - 0.5*math.Log(1-1e-6) - 3*math.Log(0.7)
+	if c := out.Output()[0]; math.Abs(c-exp) > 1e-6 {
+		t.Errorf("expected cost %f but got %f", exp, c)
+	}
+	for i, g := range grad[actual] {
+		if math.IsNaN(g) || math.IsInf(g, 0) {
+			t.Errorf("gradient %d: expected finite value but got %f", i, g)
+		}
+	}
+	checkCostFuncGradients(t, cost, expected, linalg.Vector{0.2, 0.6, 0.9, 0.3})
+}
+
+func TestMaskedCost(t *testing.T) {
+	cost := MaskedCost{CostFunc: MeanSquaredCost{}, Mask: linalg.Vector{1, 1, 0, 0}}
+	expected := linalg.Vector{1, -1, 3, 0.5}
+	actual := &autofunc.Variable{Vector: linalg.Vector{0.5, 0, -2, 4}}
+
+	exp := MeanSquaredCost{}.Cost(expected[:2],
+		&autofunc.Variable{Vector: actual.Vector[:2]}).Output()[0]
+	out := cost.Cost(expected, actual)
+	if c := out.Output()[0]; math.Abs(c-exp) > 1e-10 {
+		t.Errorf("expected %f but got %f", exp, c)
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	out.PropagateGradient(linalg.Vector{1}, grad)
+	if grad[actual][2] != 0 || grad[actual][3] != 0 {
+		t.Errorf("masked positions received gradient %v", grad[actual])
+	}
+	if grad[actual][0] == 0 || grad[actual][1] == 0 {
+		t.Errorf("valid positions received no gradient %v", grad[actual])
+	}
+
+	rv := autofunc.RVector{actual: linalg.Vector{1, 1, 1, 1}}
+	rgrad := autofunc.NewRGradient([]*autofunc.Variable{actual})
+	outR := cost.CostR(rv, expected, autofunc.NewRVariable(actual, rv))
+	outR.PropagateRGradient(linalg.Vector{1}, linalg.Vector{0}, rgrad,
+		autofunc.NewGradient([]*autofunc.Variable{actual}))
+	if rgrad[actual][2] != 0 || rgrad[actual][3] != 0 {
+		t.Errorf("masked positions received r-gradient %v", rgrad[actual])
+	}
+
+	checkCostFuncGradients(t, cost, expected, actual.Vector)
+}